@@ -2,9 +2,11 @@ package cli
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 
 	"github.com/dantedelordran/maniplacer/internal/templates"
 	"github.com/dantedelordran/maniplacer/internal/utils"
@@ -30,6 +32,43 @@ Available components:
 - ConfigMap     (Provide configuration values and environment variables as key-value pairs)
 - HPA           (Horizontal Pod Autoscaler for automatic scaling)
 - HCPolicy      (Health Check Policy configuration)
+- StatefulSet   (Stateful workload with per-pod volumes, together with its headless Service)
+- DaemonSet     (Run a pod on every node, e.g. for log collectors or node agents)
+- Job           (Run pods to completion for one-off tasks)
+- CronJob       (Run a Job on a schedule)
+- Ingress       (Route external HTTP traffic to a Service through an Ingress controller)
+- NetworkPolicy (Deny ingress traffic by default and allow it from a namespace)
+- PDB           (Pod Disruption Budget keeping pods available during voluntary disruptions)
+- Gateway       (Gateway API entry point for HttpRoute)
+- ServiceAccount (Identity the app pods run as)
+- Role          (Namespaced Role and the RoleBinding granting it to the ServiceAccount)
+- ClusterRole   (ClusterRole and the ClusterRoleBinding granting it to the ServiceAccount)
+- PVC           (PersistentVolumeClaim requesting storage for the app)
+
+Presets add a whole bundle of components at once with --preset:
+- web-service   (deployment, service, httproute, hpa, pdb)
+- worker        (deployment, configmap, hpa, pdb)
+- cron-task     (cronjob, configmap, secret)
+Projects can define their own presets in their .maniplacer file, run 'maniplacer components presets' to list them.
+Components given as arguments are added on top of the presets, each component is written only once.
+
+Components that refer to each other are scaffolded consistently. With --name, the ServiceAccount, the roles, their
+bindings and binding subjects all use '{{ .name }}'. When a ServiceAccount is added together with workloads
+(Deployment, StatefulSet, DaemonSet, Job, CronJob), or already exists in the namespace, the workloads get a
+'serviceAccountName' pointing at it. The PVC is not mounted into workloads: add a 'persistentVolumeClaim'
+volume and a volume mount to the pod template yourself. The ClusterRoleBinding subject is left without a namespace,
+it is filled with the namespace of the settings on generate, or with the namespace applied to.
+
+Besides the built-in components, add resolves components from the project's 'components/' directory and from the user-level components directory (~/.config/maniplacer/components), which take precedence over built-ins with the same name.
+Run 'maniplacer components list' to see every available component and where it comes from.
+
+Built-in components are valid, apply-able objects out of the box: they are named 'app', run 'nginx:stable'
+and listen on port 80. They can be filled in on creation with --name, --image and --port instead. The fields
+those values belong to (metadata name, app labels and selectors, container name, image and ports, backend
+references...) are written as '{{ .name }}', '{{ .image }}' and '{{ .port }}' expressions, and the values
+are seeded as top-level keys of the repo config file (config.json is created when the repo has none). Keys already
+present in the config are left untouched, the missing ones are appended without rewriting the rest of the file.
+Components coming from the project or user catalog are always written as they are.
 
 If a file already exists, you will be prompted to confirm before overwriting it, preventing accidental data loss.
 
@@ -37,8 +76,20 @@ Example usage:
   maniplacer add deployment service -n staging -r myrepo
 
 This command generates deployment.yaml and service.yaml in the
-templates/staging directory of the "myrepo" project.`,
-	Args: cobra.MinimumNArgs(1),
+templates/staging directory of the "myrepo" project.
+
+  maniplacer add deployment service --name api --image registry.example.com/api:1.4.0 --port 8080 -r myrepo
+
+This command generates both templates wired to the name, image and port keys of myrepo's config,
+and adds those keys to the config with the given values.
+
+  maniplacer add serviceaccount role deployment --name api -r myrepo
+
+This command generates a ServiceAccount, a Role bound to it and a Deployment whose pods run as it.
+
+  maniplacer add --preset web-service --name api --image registry.example.com/api:1.4.0 --port 8080 -r myrepo
+
+This command generates every component of a web service, all named after the 'name' config key.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		logger := utils.LoggerFromContext(cmd.Context())
 
@@ -46,6 +97,16 @@ templates/staging directory of the "myrepo" project.`,
 			return fmt.Errorf("current directory is not a valid Maniplacer project")
 		}
 
+		presetNames, err := cmd.Flags().GetStringSlice("preset")
+		if err != nil {
+			logger.Debug("could not get preset flag, using none", "error", err)
+			presetNames = nil
+		}
+
+		if len(args) == 0 && len(presetNames) == 0 {
+			return fmt.Errorf("at least one component or --preset is required")
+		}
+
 		namespace, err := cmd.Flags().GetString("namespace")
 		if err != nil {
 			logger.Debug("could not get namespace flag, using default", "error", err)
@@ -86,11 +147,55 @@ templates/staging directory of the "myrepo" project.`,
 			return fmt.Errorf("repository '%s' does not exist", repo)
 		}
 
+		params, values, err := scaffoldValues(cmd)
+		if err != nil {
+			return err
+		}
+
+		catalog, err := loadComponentCatalog(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		if len(presetNames) > 0 {
+			presets, err := loadPresets(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if args, err = templates.ExpandPresets(presets, presetNames, args); err != nil {
+				return err
+			}
+			logger.Info("expanded presets", "presets", presetNames, "components", args)
+		}
+
+		// Workloads run as the ServiceAccount component when it is added with them or already in place
+		linkServiceAccount := false
 		for _, comp := range args {
-			if slices.Contains(templates.AllowedComponents, comp) {
-				logger.Info("creating component template", "component", comp, "namespace", namespace)
+			if component, ok := catalog.Get(comp); ok && component.Name == templates.ServiceAccountComponent {
+				linkServiceAccount = true
+			}
+		}
+		serviceAccountPath := filepath.Join(repoPath, "templates", namespace, fmt.Sprintf("%s.yaml", templates.ServiceAccountComponent))
+		if _, err := os.Stat(serviceAccountPath); err == nil {
+			linkServiceAccount = true
+		}
+
+		scaffolded := 0
+		for _, comp := range args {
+			if component, ok := catalog.Get(comp); ok {
+				comp = component.Name
+				logger.Info("creating component template", "component", comp, "source", component.Source, "namespace", namespace)
 
-				t := templates.TemplateRegistry[comp]
+				t, applied, err := scaffoldComponent(component, params, linkServiceAccount)
+				if err != nil {
+					return fmt.Errorf("could not scaffold %s: %w", comp, err)
+				}
+				if applied {
+					scaffolded++
+				} else if len(params) > 0 {
+					logger.Warn("component has no scaffold parameters, writing it as is", "component", comp, "source", component.Source)
+					fmt.Printf("%s has no fields for the given parameters, writing it as is\n", comp)
+				}
 
 				templateDir := filepath.Join(repoPath, "templates", namespace)
 				if err := os.MkdirAll(templateDir, utils.DirPermission); err != nil {
@@ -126,6 +231,12 @@ templates/staging directory of the "myrepo" project.`,
 			}
 		}
 
+		if scaffolded > 0 {
+			if err := seedRepoConfig(os.Stdout, current, repo, values); err != nil {
+				return err
+			}
+		}
+
 		return nil
 	},
 }
@@ -134,4 +245,142 @@ func init() {
 	rootCmd.AddCommand(addCmd)
 	addCmd.Flags().StringP("namespace", "n", utils.DefaultNamespace, "Namespace for your component template")
 	addCmd.Flags().StringP("repo", "r", "", "Repo name")
+	addCmd.Flags().String("name", "", "Fill the component name, app labels and references from the 'name' config key, seeded with this value")
+	addCmd.Flags().String("image", "", "Fill the container image from the 'image' config key, seeded with this value")
+	addCmd.Flags().StringSlice("preset", nil, "Add every component of the given presets (e.g. web-service, worker, cron-task)")
+	addCmd.Flags().Int("port", 0, "Fill the container and service ports from the 'port' config key, seeded with this value")
+}
+
+// scaffoldValues reads the scaffold parameters given to add, returning their
+// names and the values to seed into the repo config
+func scaffoldValues(cmd *cobra.Command) ([]string, map[string]any, error) {
+	var params []string
+	values := make(map[string]any)
+
+	if cmd.Flags().Changed("name") {
+		name, err := cmd.Flags().GetString("name")
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not get name flag: %w", err)
+		}
+		if err := utils.ValidateResourceName(name); err != nil {
+			return nil, nil, fmt.Errorf("invalid name: %w", err)
+		}
+		params = append(params, templates.ParamName)
+		values[templates.ParamName] = name
+	}
+
+	if cmd.Flags().Changed("image") {
+		image, err := cmd.Flags().GetString("image")
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not get image flag: %w", err)
+		}
+		if strings.TrimSpace(image) == "" || strings.ContainsAny(image, " \t\n") {
+			return nil, nil, fmt.Errorf("invalid image '%s'", image)
+		}
+		params = append(params, templates.ParamImage)
+		values[templates.ParamImage] = image
+	}
+
+	if cmd.Flags().Changed("port") {
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not get port flag: %w", err)
+		}
+		if port < 1 || port > 65535 {
+			return nil, nil, fmt.Errorf("invalid port %d: must be between 1 and 65535", port)
+		}
+		params = append(params, templates.ParamPort)
+		values[templates.ParamPort] = port
+	}
+
+	return params, values, nil
+}
+
+// scaffoldComponent returns the content to write for a component and whether
+// any of params applied to it. Built-in components get the fields bound to
+// params replaced by template expressions and, with linkServiceAccount,
+// workloads run as the ServiceAccount component. Any other component is
+// returned as is.
+func scaffoldComponent(component templates.Component, params []string, linkServiceAccount bool) ([]byte, bool, error) {
+	if component.Source != templates.SourceBuiltin {
+		return component.Content, false, nil
+	}
+
+	content := component.Content
+	bindings := templates.ComponentParams[component.Name]
+
+	if linkServiceAccount {
+		if binding, ok := templates.ServiceAccountBinding(component.Name); ok {
+			linked, err := templates.LinkServiceAccount(component.Name, content)
+			if err != nil {
+				return nil, false, fmt.Errorf("could not link the service account: %w", err)
+			}
+			content = linked
+			bindings = append(slices.Clone(bindings), binding)
+		}
+	}
+
+	applied := slices.ContainsFunc(bindings, func(binding templates.ParamBinding) bool {
+		return slices.Contains(params, binding.Param)
+	})
+	if !applied {
+		return content, false, nil
+	}
+
+	scaffolded, err := templates.Scaffold(content, bindings, params)
+	if err != nil {
+		return nil, false, err
+	}
+	return scaffolded, true, nil
+}
+
+// seedRepoConfig adds the scaffold values to the repo config file, creating a
+// config.json when the repo has none. Keys already set are never overwritten and
+// the rest of the file is left as it is.
+func seedRepoConfig(out io.Writer, baseDir, repo string, values map[string]any) error {
+	configPath, format, err := FindConfigFile(baseDir, repo, "")
+	if err != nil {
+		configPath = filepath.Join(baseDir, repo, fmt.Sprintf("%s.%s", utils.ConfigFileName, utils.FormatJSON))
+		format = FormatJSON
+		if _, statErr := os.Stat(configPath); statErr == nil {
+			return err
+		}
+	}
+
+	loader := &ConfigLoader{FilePath: configPath, Format: format}
+
+	config := make(map[string]any)
+	if _, err := os.Stat(configPath); err == nil {
+		if config, err = loader.LoadConfig(); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	missing := make(map[string]any)
+	for _, key := range keys {
+		existing, ok := config[key]
+		if !ok {
+			missing[key] = values[key]
+			continue
+		}
+		if fmt.Sprint(existing) != fmt.Sprint(values[key]) {
+			fmt.Fprintf(out, "Keeping existing '%s: %v' in %s, update it by hand to use %v\n", key, existing, filepath.Base(configPath), values[key])
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if err := loader.AddKeys(missing); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Seeded %d keys into %s\n", len(missing), filepath.Base(configPath))
+	return nil
 }
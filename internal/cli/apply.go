@@ -5,11 +5,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/dantedelordran/maniplacer/internal/utils"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/discovery/cached/memory"
@@ -49,11 +50,6 @@ var applyCmd = &cobra.Command{
 		//	fmt.Printf("Using latest manifest...\n")
 		//}
 
-		if err := initKubeClients(); err != nil {
-			fmt.Printf("Error initializing Kubernetes client: %s\n", err)
-			os.Exit(1)
-		}
-
 		currentPath, err := os.Getwd()
 		if err != nil {
 			fmt.Printf("Could not get current path: %s\n", err)
@@ -62,7 +58,24 @@ var applyCmd = &cobra.Command{
 
 		projectPath := filepath.Join(currentPath, repoName, "manifests", namespace)
 
-		createResources(projectPath, namespace)
+		ignorePolicies, err := cmd.Flags().GetBool("ignore-policies")
+		if err != nil {
+			fmt.Printf("Could not get ignore-policies flag, enforcing policies\n")
+			ignorePolicies = false
+		}
+
+		runDir := getLatestManifest(projectPath)
+		if err := enforcePolicies(os.Stdout, currentPath, repoName, namespace, runDir, ignorePolicies); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		if err := initKubeClients(); err != nil {
+			fmt.Printf("Error initializing Kubernetes client: %s\n", err)
+			os.Exit(1)
+		}
+
+		createResources(runDir, namespace)
 
 	},
 }
@@ -70,6 +83,7 @@ var applyCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(applyCmd)
 	applyCmd.Flags().StringP("namespace", "n", "default", "Namespace to apply resources")
+	applyCmd.Flags().Bool("ignore-policies", false, "Apply the run even when it fails project policies")
 	applyCmd.Flags().StringP("pick", "p", "", "Specify a repo manifest version to apply (by default maniplacer applys the latest)")
 }
 
@@ -100,33 +114,33 @@ func initKubeClients() error {
 
 func getLatestManifest(projectPath string) string {
 
-	entries, err := os.ReadDir(projectPath)
+	run, err := LatestRun(projectPath)
 	if err != nil {
-		fmt.Printf("Could not read dir: %s\n", err)
+		fmt.Printf("Could not find latest manifest version: %s\n", err)
 		os.Exit(1)
 	}
 
-	if len(entries) == 0 {
-		fmt.Printf("No manifest versions found in %s\n", projectPath)
-		os.Exit(1)
-	}
-
-	return filepath.Join(projectPath, entries[len(entries)-1].Name())
+	return filepath.Join(projectPath, run.Name)
 
 }
 
-func createResources(projectPath string, defaultNamespace string) {
+// createResources applies every object of a run, the one policies were checked against
+func createResources(latestManifestPath string, defaultNamespace string) {
 	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(k8sClient.Discovery()))
 	ctx := context.TODO()
-	latestManifestPath := getLatestManifest(projectPath)
 	entries, err := os.ReadDir(latestManifestPath)
 	if err != nil {
 		fmt.Printf("Could not read dir: %s\n", err)
 		os.Exit(1)
 	}
 
-	// Creates the k8s resources found in each entry
+	// Creates the k8s resources found in each entry, a file may hold several
+	// '---' separated documents
 	for _, entry := range entries {
+		// kustomization.yaml describes the run for Kustomize, it is not an object
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || entry.Name() == kustomizationFileName {
+			continue
+		}
 
 		data, err := os.ReadFile(filepath.Join(latestManifestPath, entry.Name()))
 		if err != nil {
@@ -134,74 +148,118 @@ func createResources(projectPath string, defaultNamespace string) {
 			continue
 		}
 
-		obj := &unstructured.Unstructured{}
-		err = yaml.Unmarshal(data, &obj.Object)
+		docs, err := decodeDocuments(data)
 		if err != nil {
 			fmt.Printf("Could not parse YAML: %s\n", err)
 			continue
 		}
 
-		// Skip empty documents
-		if obj.GetKind() == "" {
-			continue
-		}
+		for _, doc := range docs {
+			obj := &unstructured.Unstructured{Object: doc}
 
-		gvk := obj.GroupVersionKind()
+			// Skip empty documents
+			if obj.GetKind() == "" {
+				continue
+			}
 
-		restMapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
-		if err != nil {
-			fmt.Printf("Could not create rest mapper: %s\n", err)
-			continue
+			if applyObject(ctx, mapper, obj, defaultNamespace) {
+				fmt.Printf("%s (%s/%s) - Applied!\n", entry.Name(), obj.GetKind(), obj.GetName())
+			}
 		}
+	}
 
-		gvr := restMapping.Resource
+}
 
-		namespace := obj.GetNamespace()
-		if namespace == "" {
-			// Check if this resource is namespaced
-			if restMapping.Scope.Name() == "namespace" {
-				namespace = defaultNamespace
-				obj.SetNamespace(namespace)
-			}
-		}
+// applyObject server-side applies a single object, creating its namespace on
+// confirmation. It reports whether the object was applied.
+func applyObject(ctx context.Context, mapper *restmapper.DeferredDiscoveryRESTMapper, obj *unstructured.Unstructured, defaultNamespace string) bool {
+	gvk := obj.GroupVersionKind()
 
-		existingNamespace, err := k8sClient.CoreV1().Namespaces().Get(ctx, namespace, v1.GetOptions{})
-		fmt.Println(existingNamespace)
-		if err != nil {
-			fmt.Printf("Could not get existing namespace %s\n", err)
-		}
-		if existingNamespace.Name == "" {
-			fmt.Printf("The namespace %s does not exists, do you want to create it? (y/N)\n", namespace)
-			var response string
-			fmt.Scanln(&response)
-			if response != "y" && response != "Y" && response != "yes" && response != "Yes" {
-				fmt.Printf("namespace '%s' does not exist and creation was declined", namespace)
-				continue
-			}
+	restMapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		fmt.Printf("Could not create rest mapper: %s\n", err)
+		return false
+	}
 
-			ns := &corev1.Namespace{
-				ObjectMeta: v1.ObjectMeta{
-					Name: namespace,
-					Labels: map[string]string{
-						"applier": "maniplacer",
-					},
-				},
-			}
+	gvr := restMapping.Resource
 
-			k8sClient.CoreV1().Namespaces().Create(ctx, ns, v1.CreateOptions{})
+	namespaced := restMapping.Scope.Name() == meta.RESTScopeNameNamespace
+	namespace := obj.GetNamespace()
+	if namespace == "" && namespaced {
+		namespace = defaultNamespace
+		obj.SetNamespace(namespace)
+	}
+	fillSubjectNamespaces(obj, defaultNamespace)
 
-		}
+	// Cluster-scoped objects (ClusterRoles, ClusterRoleBindings, ...) need no namespace
+	if namespaced && !ensureNamespace(ctx, namespace) {
+		return false
+	}
 
-		applyOpts := v1.ApplyOptions{FieldManager: "maniplacer"}
+	applyOpts := v1.ApplyOptions{FieldManager: "maniplacer"}
 
-		_, err = dynamicClient.Resource(gvr).Namespace(namespace).Apply(context.TODO(), obj.GetName(), obj, applyOpts)
-		if err != nil {
-			fmt.Printf("apply error: %s\n", err)
-			os.Exit(1)
+	_, err = dynamicClient.Resource(gvr).Namespace(namespace).Apply(ctx, obj.GetName(), obj, applyOpts)
+	if err != nil {
+		fmt.Printf("apply error: %s\n", err)
+		os.Exit(1)
+	}
+
+	return true
+}
+
+// ensureNamespace checks that a namespace exists and creates it on
+// confirmation. It reports whether the namespace is there.
+func ensureNamespace(ctx context.Context, namespace string) bool {
+	existingNamespace, err := k8sClient.CoreV1().Namespaces().Get(ctx, namespace, v1.GetOptions{})
+	if err != nil {
+		fmt.Printf("Could not get existing namespace %s\n", err)
+	}
+	if existingNamespace.Name == "" {
+		fmt.Printf("The namespace %s does not exists, do you want to create it? (y/N)\n", namespace)
+		var response string
+		fmt.Scanln(&response)
+		if response != "y" && response != "Y" && response != "yes" && response != "Yes" {
+			fmt.Printf("namespace '%s' does not exist and creation was declined", namespace)
+			return false
+		}
+
+		ns := &corev1.Namespace{
+			ObjectMeta: v1.ObjectMeta{
+				Name: namespace,
+				Labels: map[string]string{
+					"applier": "maniplacer",
+				},
+			},
 		}
 
-		fmt.Printf("%s - Applied!\n", entry.Name())
+		k8sClient.CoreV1().Namespaces().Create(ctx, ns, v1.CreateOptions{})
+
+	}
+
+	return true
+}
+
+// fillSubjectNamespaces sets the namespace of ServiceAccount subjects of
+// RoleBindings and ClusterRoleBindings left without one, like the namespace
+// of the objects themselves. The API server requires it for ClusterRoleBindings.
+func fillSubjectNamespaces(obj *unstructured.Unstructured, defaultNamespace string) {
+	if obj.GetKind() != "RoleBinding" && obj.GetKind() != "ClusterRoleBinding" {
+		return
+	}
 
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = defaultNamespace
 	}
 
+	subjects, _ := obj.Object["subjects"].([]any)
+	for _, subject := range subjects {
+		subject, ok := subject.(map[string]any)
+		if !ok || subject["kind"] != "ServiceAccount" {
+			continue
+		}
+		if current, _ := subject["namespace"].(string); current == "" {
+			subject["namespace"] = namespace
+		}
+	}
 }
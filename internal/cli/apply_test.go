@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestFillSubjectNamespaces(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      string
+		namespace string
+		subject   map[string]any
+		want      any
+	}{
+		{"cluster role binding", "ClusterRoleBinding", "", map[string]any{"kind": "ServiceAccount", "name": "app", "namespace": ""}, "staging"},
+		{"role binding namespace", "RoleBinding", "team", map[string]any{"kind": "ServiceAccount", "name": "app"}, "team"},
+		{"namespace kept", "ClusterRoleBinding", "", map[string]any{"kind": "ServiceAccount", "name": "app", "namespace": "ops"}, "ops"},
+		{"users left alone", "ClusterRoleBinding", "", map[string]any{"kind": "User", "name": "jane"}, nil},
+		{"other kinds left alone", "Deployment", "", map[string]any{"kind": "ServiceAccount", "name": "app"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: map[string]any{
+				"kind":     tt.kind,
+				"metadata": map[string]any{"name": "app", "namespace": tt.namespace},
+				"subjects": []any{tt.subject},
+			}}
+			fillSubjectNamespaces(obj, "staging")
+			if got := tt.subject["namespace"]; got != tt.want {
+				t.Errorf("subject namespace = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dantedelordran/maniplacer/internal/templates"
+	"github.com/dantedelordran/maniplacer/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var componentsCmd = &cobra.Command{
+	Use:   "components",
+	Short: "Manages the component catalog used by add",
+	Long: `The components command inspects the catalog of components that 'maniplacer add' can scaffold.
+
+Components are resolved from three sources, highest precedence first:
+  project   → the 'components/' directory at the root of the current Maniplacer project
+  user      → the user-level directory ($XDG_CONFIG_HOME/maniplacer/components, usually ~/.config/maniplacer/components,
+              or MANIPLACER_COMPONENTS_DIR when set)
+  builtin   → the components embedded in Maniplacer
+
+A component is a single .yaml, .yml or .tmpl file named after the component. A project or user component with the same name as a built-in one overrides it, which lets teams share their own house-standard components.
+An optional leading '# description: ...' comment is shown by 'components list'.
+
+Presets bundle several components under one name for 'maniplacer add --preset'. The built-in presets are
+web-service, worker and cron-task, projects can define their own (or redefine a built-in one) in the
+"presets" object of their .maniplacer file:
+
+  "presets": {
+    "grpc-service": ["deployment", "service", "pdb", "networkpolicy"]
+  }
+
+Example usage:
+  maniplacer components list
+  maniplacer components presets`,
+}
+
+var componentsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists every available component with its source and description",
+	Args:  cobra.MaximumNArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := utils.LoggerFromContext(cmd.Context())
+
+		catalog, err := loadComponentCatalog(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		components := catalog.List()
+		logger.Info("listing components", "count", len(components))
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "NAME\tSOURCE\tDESCRIPTION\n")
+		for _, component := range components {
+			source := component.Source
+			if component.Overrides != "" {
+				source = fmt.Sprintf("%s (overrides %s)", component.Source, component.Overrides)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", component.Name, source, component.Description)
+		}
+		return w.Flush()
+	},
+}
+
+var componentsPresetsCmd = &cobra.Command{
+	Use:   "presets",
+	Short: "Lists every preset that add --preset can expand",
+	Args:  cobra.MaximumNArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := utils.LoggerFromContext(cmd.Context())
+
+		presets, err := loadPresets(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(presets))
+		for name := range presets {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		logger.Info("listing presets", "count", len(names))
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "NAME\tSOURCE\tCOMPONENTS\tDESCRIPTION\n")
+		for _, name := range names {
+			preset := presets[name]
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", preset.Name, preset.Source, strings.Join(preset.Components, ","), preset.Description)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(componentsCmd)
+	componentsCmd.AddCommand(componentsListCmd)
+	componentsCmd.AddCommand(componentsPresetsCmd)
+}
+
+// loadComponentCatalog builds the catalog from the built-in components, the
+// user-level components directory and, inside a project, its components directory
+func loadComponentCatalog(ctx context.Context) (*templates.Catalog, error) {
+	logger := utils.LoggerFromContext(ctx)
+
+	var dirs []templates.CatalogDir
+
+	userDir, err := utils.UserComponentsDir()
+	if err != nil {
+		logger.Debug("could not resolve user components directory, skipping", "error", err)
+	} else {
+		dirs = append(dirs, templates.CatalogDir{Path: userDir, Source: templates.SourceUser})
+	}
+
+	if utils.IsValidProject() {
+		currentDir, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("could not get current directory: %w", err)
+		}
+		dirs = append(dirs, templates.CatalogDir{Path: filepath.Join(currentDir, utils.ComponentsDir), Source: templates.SourceProject})
+	}
+
+	catalog, err := templates.LoadCatalog(dirs...)
+	if err != nil {
+		return nil, fmt.Errorf("could not load component catalog: %w", err)
+	}
+	return catalog, nil
+}
+
+// loadPresets returns the built-in presets plus, inside a project, the ones
+// defined in its project file
+func loadPresets(ctx context.Context) (map[string]templates.Preset, error) {
+	logger := utils.LoggerFromContext(ctx)
+
+	var project map[string][]string
+	if utils.IsValidProject() {
+		cfg, err := utils.LoadManiplacerProject()
+		if err != nil {
+			return nil, err
+		}
+		project = cfg.Presets
+		logger.Debug("loaded project presets", "count", len(project))
+	}
+
+	return templates.LoadPresets(project), nil
+}
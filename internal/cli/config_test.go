@@ -1,9 +1,12 @@
 package cli
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -253,3 +256,122 @@ func TestFindConfigFile(t *testing.T) {
 		}
 	})
 }
+
+func TestSeedRepoConfig(t *testing.T) {
+	values := map[string]any{"name": "api", "image": "repo/api:1.0", "port": 8080}
+
+	t.Run("empty config", func(t *testing.T) {
+		baseDir := t.TempDir()
+		configPath := filepath.Join(baseDir, "repo", "config.json")
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(configPath, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := seedRepoConfig(io.Discard, baseDir, "repo", values); err != nil {
+			t.Fatalf("seedRepoConfig() error = %v", err)
+		}
+
+		config, err := (&ConfigLoader{FilePath: configPath, Format: FormatJSON}).LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		if config["name"] != "api" || config["image"] != "repo/api:1.0" || config["port"] != float64(8080) {
+			t.Errorf("seeded config = %v", config)
+		}
+	})
+
+	t.Run("no config", func(t *testing.T) {
+		baseDir := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(baseDir, "repo"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := seedRepoConfig(io.Discard, baseDir, "repo", values); err != nil {
+			t.Fatalf("seedRepoConfig() error = %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(baseDir, "repo", "config.json")); err != nil {
+			t.Errorf("config.json not created: %v", err)
+		}
+	})
+
+	t.Run("existing keys are kept", func(t *testing.T) {
+		baseDir := t.TempDir()
+		configPath := filepath.Join(baseDir, "repo", "config.yaml")
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(configPath, []byte("name: web\nreplicas: 2\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		if err := seedRepoConfig(&out, baseDir, "repo", values); err != nil {
+			t.Fatalf("seedRepoConfig() error = %v", err)
+		}
+
+		config, err := (&ConfigLoader{FilePath: configPath, Format: FormatYAML}).LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		if config["name"] != "web" || config["replicas"] != 2 || config["port"] != 8080 {
+			t.Errorf("seeded config = %v", config)
+		}
+		if !strings.Contains(out.String(), "Keeping existing 'name: web'") {
+			t.Errorf("expected a notice about the kept name, got %q", out.String())
+		}
+	})
+
+	t.Run("rest of the file is kept", func(t *testing.T) {
+		tests := []struct {
+			filename string
+			content  string
+			want     string
+		}{
+			{
+				"config.yaml",
+				"# Web frontend\nreplicas: 2   # scaled by hand\nname: web\nlabels:\n    tier: front\n",
+				"# Web frontend\nreplicas: 2   # scaled by hand\nname: web\nlabels:\n    tier: front\nimage: repo/api:1.0\nport: 8080\n",
+			},
+			{
+				"config.yaml",
+				"name: web\nreplicas: 2",
+				"name: web\nreplicas: 2\nimage: repo/api:1.0\nport: 8080\n",
+			},
+			{
+				"config.json",
+				"{\n    \"replicas\": 2,\n    \"name\": \"web\"\n}\n",
+				"{\n    \"replicas\": 2,\n    \"name\": \"web\",\n    \"image\": \"repo/api:1.0\",\n    \"port\": 8080\n}\n",
+			},
+			{
+				"config.json",
+				"{}",
+				"{\n  \"image\": \"repo/api:1.0\",\n  \"name\": \"api\",\n  \"port\": 8080}",
+			},
+		}
+
+		for _, tt := range tests {
+			baseDir := t.TempDir()
+			configPath := filepath.Join(baseDir, "repo", tt.filename)
+			if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := seedRepoConfig(io.Discard, baseDir, "repo", values); err != nil {
+				t.Fatalf("seedRepoConfig() error = %v", err)
+			}
+			got, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("seeded %s =\n%s\nwant\n%s", tt.filename, got, tt.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffLines bounds the size of inputs compared line by line, larger inputs
+// are only reported as changed
+const maxDiffLines = 2000
+
+// compactDiff returns the changed lines between two texts, prefixed with '-'
+// for removed lines and '+' for added ones, each preceded by the line number
+// it applies to in the new text. It returns an empty string when both are equal.
+func compactDiff(oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	oldLines := splitLines(oldText)
+	newLines := splitLines(newText)
+
+	if len(oldLines) > maxDiffLines || len(newLines) > maxDiffLines {
+		return fmt.Sprintf("  (%d lines -> %d lines, too large to diff)\n", len(oldLines), len(newLines))
+	}
+
+	// lcs[i][j] holds the length of the longest common subsequence of
+	// oldLines[i:] and newLines[j:]
+	lcs := make([][]int, len(oldLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var b strings.Builder
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			i++
+			j++
+		case i < len(oldLines) && (j == len(newLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&b, "  %4d - %s\n", j+1, oldLines[i])
+			i++
+		default:
+			fmt.Fprintf(&b, "  %4d + %s\n", j+1, newLines[j])
+			j++
+		}
+	}
+
+	return b.String()
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,347 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dantedelordran/maniplacer/internal/templates"
+	"github.com/dantedelordran/maniplacer/internal/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports a repo to other packaging formats",
+	Long: `The export command converts the templates and config of a repo into formats other tools consume.
+
+Available formats:
+  helm   → a Helm chart directory
+
+Example usage:
+  maniplacer export helm -r myrepo -n production`,
+}
+
+var exportHelmCmd = &cobra.Command{
+	Use:   "helm",
+	Short: "Exports the templates and config of a repo as a Helm chart",
+	Long: `The helm command writes a Helm chart built from the templates of a repo namespace and the repo config.
+
+The chart directory contains:
+  Chart.yaml     → named after the repo, with the version given by --chart-version (and --app-version if set)
+  values.yaml    → the repo config
+  templates/     → every template of 'templates/<namespace>/', translated for Helm
+
+Templates are translated without touching anything outside template actions:
+  - config references move under .Values ('{{ .image }}' becomes '{{ .Values.image }}', '$.x' becomes '$.Values.x')
+  - Maniplacer functions are renamed to their Sprig equivalents: Base64 → b64enc, ToUpper → upper, ToLower → lower, Quote → quote
+  - '.tmpl' templates are renamed to '.yaml'
+  - partials ('_' prefixed templates such as '_helpers.tpl') stay partials, Helm does not render them either
+
+Anything that cannot be translated is reported once the chart is written:
+  - templates that do not parse are left out of the chart
+  - templates named NOTES.txt, which Helm would not render as a manifest
+  - names given to 'define' in several templates, since they are global across a Helm chart
+
+Example usage:
+  maniplacer export helm -r myrepo -n production
+  maniplacer export helm -r myrepo -n production -o charts/api --chart-version 1.2.0 --app-version 4.1.0
+
+Notes:
+  - The chart is written to 'charts/<repo>' at the project root unless --output is given
+  - An existing chart directory (one holding a Chart.yaml) is replaced after confirmation, any other existing path is refused
+  - Helm cannot read SOPS encrypted values, an encrypted config is refused unless --plaintext-values allows writing its
+    decrypted values to values.yaml`,
+	Args: cobra.MaximumNArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := utils.LoggerFromContext(cmd.Context())
+
+		if !utils.IsValidProject() {
+			return fmt.Errorf("current directory is not a valid Maniplacer project")
+		}
+
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			logger.Debug("could not get namespace flag, using default", "error", err)
+			namespace = utils.DefaultNamespace
+		}
+		if err := utils.ValidateNamespace(namespace); err != nil {
+			return fmt.Errorf("invalid namespace: %w", err)
+		}
+
+		repo, err := cmd.Flags().GetString("repo")
+		if err != nil {
+			return fmt.Errorf("could not get repo flag: %w", err)
+		}
+		if repo == "" {
+			return fmt.Errorf("repository name is required (use --repo flag)")
+		}
+		if err := utils.ValidateRepoName(repo); err != nil {
+			return fmt.Errorf("invalid repository name: %w", err)
+		}
+		if err := utils.ValidateSafePath(repo); err != nil {
+			return err
+		}
+
+		customConfigPath, err := cmd.Flags().GetString("config")
+		if err != nil {
+			logger.Debug("could not get config flag, auto-detecting", "error", err)
+			customConfigPath = ""
+		}
+
+		formatFlag, err := cmd.Flags().GetString("format")
+		if err != nil {
+			logger.Debug("could not get format flag, auto-detecting", "error", err)
+			formatFlag = ""
+		}
+
+		chartVersion, err := cmd.Flags().GetString("chart-version")
+		if err != nil {
+			return fmt.Errorf("could not get chart-version flag: %w", err)
+		}
+
+		appVersion, err := cmd.Flags().GetString("app-version")
+		if err != nil {
+			logger.Debug("could not get app-version flag, leaving it out", "error", err)
+			appVersion = ""
+		}
+
+		current, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("could not get current directory: %w", err)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil || output == "" {
+			output = filepath.Join(current, "charts", repo)
+		}
+		if err := utils.ValidateSafePath(output); err != nil {
+			return err
+		}
+
+		templateDir := filepath.Join(current, repo, "templates", namespace)
+		if _, err := os.Stat(templateDir); err != nil {
+			return fmt.Errorf("template directory '%s' not found: %w", templateDir, err)
+		}
+
+		configPath, configFormat, err := resolveConfigPath(current, repo, customConfigPath, formatFlag)
+		if err != nil {
+			return err
+		}
+		plaintextValues, err := cmd.Flags().GetBool("plaintext-values")
+		if err != nil {
+			logger.Debug("could not get plaintext-values flag, refusing encrypted configs", "error", err)
+			plaintextValues = false
+		}
+
+		config, err := loadChartValues(&ConfigLoader{FilePath: configPath, Format: configFormat}, plaintextValues)
+		if err != nil {
+			return err
+		}
+
+		chart, err := buildHelmChart(templateDir, config, helmChartMeta{
+			Name:        repo,
+			Description: fmt.Sprintf("Helm chart exported by Maniplacer from the %s repo (%s namespace)", repo, namespace),
+			Version:     chartVersion,
+			AppVersion:  appVersion,
+		})
+		if err != nil {
+			return err
+		}
+
+		exists, err := existingChartDir(output)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if !utils.ConfirmMessage(fmt.Sprintf("%s already exists, do you want to replace it?", output)) {
+				fmt.Printf("Skipping export...\n")
+				return nil
+			}
+		}
+
+		if err := chart.write(output); err != nil {
+			return err
+		}
+
+		logger.Info("helm chart exported", "repo", repo, "namespace", namespace, "templates", len(chart.Templates), "issues", len(chart.Issues))
+		fmt.Printf("Helm chart with %d templates written to %s\n", len(chart.Templates), output)
+		printHelmIssues(os.Stdout, chart.Issues)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.AddCommand(exportHelmCmd)
+	exportHelmCmd.Flags().StringP("namespace", "n", utils.DefaultNamespace, "Namespace whose templates are exported")
+	exportHelmCmd.Flags().StringP("repo", "r", "", "Repo name")
+	exportHelmCmd.Flags().StringP("output", "o", "", "Chart directory (default: charts/<repo>)")
+	exportHelmCmd.Flags().StringP("config", "c", "", "Custom config file path, written as values.yaml")
+	exportHelmCmd.Flags().StringP("format", "f", "", "Config file format (json, yaml, yml) - auto-detected if not specified")
+	exportHelmCmd.Flags().String("chart-version", "0.1.0", "Chart version written to Chart.yaml")
+	exportHelmCmd.Flags().String("app-version", "", "App version written to Chart.yaml")
+	exportHelmCmd.Flags().Bool("plaintext-values", false, "Write the decrypted values of an encrypted config to values.yaml")
+}
+
+// loadChartValues loads the config written as values.yaml. Helm cannot read
+// SOPS encrypted values, so an encrypted config is only exported decrypted
+// when plaintext allows it.
+func loadChartValues(loader *ConfigLoader, plaintext bool) (map[string]any, error) {
+	config, err := loader.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if loader.key != nil && !plaintext {
+		return nil, fmt.Errorf("config file '%s' is encrypted and values.yaml would hold its secrets in plaintext, use --plaintext-values to export it anyway", loader.FilePath)
+	}
+	return config, nil
+}
+
+// helmChartMeta is the content of Chart.yaml
+type helmChartMeta struct {
+	APIVersion  string `yaml:"apiVersion"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Type        string `yaml:"type"`
+	Version     string `yaml:"version"`
+	AppVersion  string `yaml:"appVersion,omitempty"`
+
+	Dependencies []helmDependency `yaml:"dependencies,omitempty"`
+}
+
+// helmDependency is a subchart listed in Chart.yaml
+type helmDependency struct {
+	Name string `yaml:"name"`
+}
+
+// helmChart is a chart ready to be written
+type helmChart struct {
+	Meta      helmChartMeta
+	Values    map[string]any
+	Templates []renderedManifest
+	Issues    []string
+}
+
+// buildHelmChart translates every template of templateDir into a chart
+// template, collecting what could not be translated
+func buildHelmChart(templateDir string, config map[string]any, meta helmChartMeta) (*helmChart, error) {
+	meta.APIVersion = "v2"
+	meta.Type = "application"
+
+	entries, err := os.ReadDir(templateDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read template directory: %w", err)
+	}
+
+	chart := &helmChart{Meta: meta, Values: config}
+	defined := make(map[string]string)
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(templateDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not read template '%s': %w", entry.Name(), err)
+		}
+
+		translated, err := templates.ToHelmTemplate(entry.Name(), content)
+		if err != nil {
+			chart.Issues = append(chart.Issues, fmt.Sprintf("%s: left out, %s", entry.Name(), err))
+			continue
+		}
+
+		name := entry.Name()
+		if filepath.Ext(name) == ".tmpl" {
+			name = strings.TrimSuffix(name, ".tmpl") + ".yaml"
+		}
+		if name == "NOTES.txt" {
+			chart.Issues = append(chart.Issues, fmt.Sprintf("%s: Helm does not render this file as a manifest, rename the template", entry.Name()))
+		}
+
+		for _, define := range translated.Defines {
+			if other, ok := defined[define]; ok {
+				chart.Issues = append(chart.Issues, fmt.Sprintf("%s: template %q is also defined in %s, define names are global in a Helm chart", entry.Name(), define, other))
+				continue
+			}
+			defined[define] = entry.Name()
+		}
+
+		chart.Templates = append(chart.Templates, renderedManifest{Name: name, Content: translated.Content})
+	}
+
+	return chart, nil
+}
+
+// write stores the chart in dir, replacing any previous content once the new chart is complete
+func (c *helmChart) write(dir string) error {
+	if _, err := existingChartDir(dir); err != nil {
+		return err
+	}
+
+	meta, err := yaml.Marshal(c.Meta)
+	if err != nil {
+		return fmt.Errorf("could not encode Chart.yaml: %w", err)
+	}
+
+	values := []byte("{}\n")
+	if len(c.Values) > 0 {
+		if values, err = yaml.Marshal(c.Values); err != nil {
+			return fmt.Errorf("could not encode values.yaml: %w", err)
+		}
+	}
+
+	files := []renderedManifest{
+		{Name: "Chart.yaml", Content: meta},
+		{Name: "values.yaml", Content: values},
+	}
+	for _, template := range c.Templates {
+		files = append(files, renderedManifest{Name: filepath.Join("templates", template.Name), Content: template.Content})
+	}
+
+	if err := replaceDirAtomically(dir, files); err != nil {
+		return fmt.Errorf("could not write chart: %w", err)
+	}
+	return nil
+}
+
+// existingChartDir reports whether dir holds a chart that may be replaced.
+// Anything else at dir is never replaced, so a mistyped --output cannot wipe
+// out a repo or a home directory.
+func existingChartDir(dir string) (bool, error) {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not check '%s': %w", dir, err)
+	}
+	if !info.IsDir() {
+		return false, fmt.Errorf("'%s' exists and is not a directory", dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Chart.yaml")); err != nil {
+		return false, fmt.Errorf("'%s' exists and is not a Helm chart (no Chart.yaml), refusing to replace it", dir)
+	}
+	return true, nil
+}
+
+// printHelmIssues lists what could not be translated to Helm
+func printHelmIssues(out io.Writer, issues []string) {
+	if len(issues) == 0 {
+		return
+	}
+
+	sorted := slices.Clone(issues)
+	slices.Sort(sorted)
+
+	fmt.Fprintf(out, "Could not translate %d constructs:\n", len(sorted))
+	for _, issue := range sorted {
+		fmt.Fprintf(out, "  - %s\n", issue)
+	}
+}
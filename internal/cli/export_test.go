@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildHelmChart(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"deployment.tmpl":  "image: {{ .image | ToLower }}\n",
+		"service.yaml":     `{{ define "labels" }}app: {{ .name }}{{ end }}{{ template "labels" . }}` + "\n",
+		"configmap.yaml":   `{{ define "labels" }}{{ end }}kind: ConfigMap` + "\n",
+		"NOTES.txt":        "Installed\n",
+		"broken.yaml":      "{{ .image \n",
+		".hidden.yaml":     "{{ .skipped }}\n",
+		"nested/more.yaml": "kind: Pod\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chart, err := buildHelmChart(dir, map[string]any{"image": "nginx"}, helmChartMeta{Name: "app", Version: "0.1.0"})
+	if err != nil {
+		t.Fatalf("buildHelmChart() error = %v", err)
+	}
+
+	if chart.Meta.APIVersion != "v2" || chart.Meta.Type != "application" {
+		t.Errorf("Meta = %+v, want apiVersion v2 and type application", chart.Meta)
+	}
+
+	got := make(map[string]string)
+	for _, tmpl := range chart.Templates {
+		got[tmpl.Name] = string(tmpl.Content)
+	}
+	if len(got) != 4 {
+		t.Errorf("templates = %v, want 4 (broken and hidden ones left out)", got)
+	}
+	if got["deployment.yaml"] != "image: {{ .Values.image | lower }}\n" {
+		t.Errorf("deployment.yaml = %q", got["deployment.yaml"])
+	}
+
+	wantIssues := []string{"broken.yaml: left out", "NOTES.txt: Helm does not render", `template "labels" is also defined`}
+	if len(chart.Issues) != len(wantIssues) {
+		t.Fatalf("Issues = %v, want %d", chart.Issues, len(wantIssues))
+	}
+	for _, want := range wantIssues {
+		found := false
+		for _, issue := range chart.Issues {
+			found = found || strings.Contains(issue, want)
+		}
+		if !found {
+			t.Errorf("Issues = %v, missing %q", chart.Issues, want)
+		}
+	}
+}
+
+func TestHelmChartWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "charts", "app")
+	if err := os.MkdirAll(filepath.Join(dir, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "templates", "stale.yaml"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("name: app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chart := &helmChart{
+		Meta:      helmChartMeta{APIVersion: "v2", Name: "app", Type: "application", Version: "0.1.0"},
+		Values:    map[string]any{"replicas": 2},
+		Templates: []renderedManifest{{Name: "deployment.yaml", Content: []byte("replicas: {{ .Values.replicas }}\n")}},
+	}
+	if err := chart.write(dir); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"Chart.yaml":                "apiVersion: v2\nname: app\n",
+		"values.yaml":               "replicas: 2\n",
+		"templates/deployment.yaml": "replicas: {{ .Values.replicas }}\n",
+	} {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("could not read %s: %v", name, err)
+		}
+		if !strings.HasPrefix(string(content), want) {
+			t.Errorf("%s = %q, want prefix %q", name, content, want)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "templates", "stale.yaml")); !os.IsNotExist(err) {
+		t.Error("stale template of the previous chart was kept")
+	}
+}
+
+func TestHelmChartWriteRefusesOtherDirectories(t *testing.T) {
+	base := t.TempDir()
+	repo := filepath.Join(base, "myrepo")
+	if err := os.MkdirAll(filepath.Join(repo, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(base, "notes.txt")
+	if err := os.WriteFile(file, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chart := &helmChart{Meta: helmChartMeta{APIVersion: "v2", Name: "app", Type: "application", Version: "0.1.0"}}
+	for _, dir := range []string{repo, file} {
+		if err := chart.write(dir); err == nil {
+			t.Errorf("write(%s) expected an error", dir)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(repo, "templates")); err != nil {
+		t.Errorf("directory that is not a chart was replaced: %v", err)
+	}
+	if content, err := os.ReadFile(file); err != nil || string(content) != "keep" {
+		t.Errorf("file was replaced: %q, %v", content, err)
+	}
+
+	if exists, err := existingChartDir(filepath.Join(base, "charts", "app")); exists || err != nil {
+		t.Errorf("existingChartDir() of a missing directory = %v, %v", exists, err)
+	}
+}
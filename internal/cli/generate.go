@@ -2,16 +2,24 @@ package cli
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/dantedelordran/maniplacer/internal/lint"
+	"github.com/dantedelordran/maniplacer/internal/secrets"
 	"github.com/dantedelordran/maniplacer/internal/templates"
 	"github.com/dantedelordran/maniplacer/internal/utils"
 	"github.com/spf13/cobra"
@@ -29,8 +37,19 @@ const (
 type ConfigLoader struct {
 	FilePath string
 	Format   ConfigFormat
+	key      *secrets.Key // Set when the file is SOPS encrypted, SaveConfig and AddKeys encrypt with it
 }
 
+// secretsFormat returns the format of the config for encryption
+func (f ConfigFormat) secretsFormat() secrets.Format {
+	if f == FormatJSON {
+		return secrets.FormatJSON
+	}
+	return secrets.FormatYAML
+}
+
+// LoadConfig reads the config file. SOPS encrypted files are decrypted in
+// memory with the local age key.
 func (cl *ConfigLoader) LoadConfig() (map[string]any, error) {
 	content, err := os.ReadFile(cl.FilePath)
 	if err != nil {
@@ -39,6 +58,21 @@ func (cl *ConfigLoader) LoadConfig() (map[string]any, error) {
 
 	var config map[string]any
 
+	// A freshly created repo has an empty config file
+	if len(bytes.TrimSpace(content)) == 0 {
+		return map[string]any{}, nil
+	}
+
+	if secrets.IsEncrypted(content) {
+		identities, err := secrets.LoadIdentities()
+		if err != nil {
+			return nil, fmt.Errorf("config file '%s' is encrypted: %w", cl.FilePath, err)
+		}
+		if content, cl.key, err = secrets.Decrypt(content, cl.Format.secretsFormat(), identities); err != nil {
+			return nil, fmt.Errorf("failed to decrypt config file '%s': %w", cl.FilePath, err)
+		}
+	}
+
 	switch cl.Format {
 	case FormatJSON:
 		if err := json.Unmarshal(content, &config); err != nil {
@@ -55,6 +89,171 @@ func (cl *ConfigLoader) LoadConfig() (map[string]any, error) {
 	return config, nil
 }
 
+// SaveConfig writes config back to the file in the loader format, encrypted
+// again when it was loaded from an encrypted file
+func (cl *ConfigLoader) SaveConfig(config map[string]any) error {
+	var content []byte
+	var err error
+
+	switch cl.Format {
+	case FormatJSON:
+		content, err = json.MarshalIndent(config, "", "  ")
+		content = append(content, '\n')
+	case FormatYAML, FormatYML:
+		content, err = yaml.Marshal(config)
+	default:
+		return fmt.Errorf("unsupported config format: %s", cl.Format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode config file '%s': %w", cl.FilePath, err)
+	}
+
+	if cl.key != nil {
+		if content, err = cl.key.Encrypt(content, cl.Format.secretsFormat()); err != nil {
+			return fmt.Errorf("failed to encrypt config file '%s': %w", cl.FilePath, err)
+		}
+	} else if existing, err := os.ReadFile(cl.FilePath); err == nil && secrets.IsEncrypted(existing) {
+		return fmt.Errorf("config file '%s' is encrypted, load it before saving so it stays encrypted", cl.FilePath)
+	}
+
+	if err := os.WriteFile(cl.FilePath, content, utils.FilePermission); err != nil {
+		return fmt.Errorf("failed to write config file '%s': %w", cl.FilePath, err)
+	}
+	return nil
+}
+
+// AddKeys adds top-level keys to the config file without rewriting it: the
+// keys are inserted after the existing ones, whose order, formatting and
+// comments are left as they are. A missing or empty file is written anew.
+// In an encrypted file only the new values are encrypted, before the SOPS
+// metadata whose MAC is updated.
+func (cl *ConfigLoader) AddKeys(values map[string]any) error {
+	content, err := os.ReadFile(cl.FilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file '%s': %w", cl.FilePath, err)
+	}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return cl.SaveConfig(values)
+	}
+
+	var additions yaml.Node
+	if err := additions.Encode(values); err != nil {
+		return fmt.Errorf("failed to encode config keys: %w", err)
+	}
+
+	if !secrets.IsEncrypted(content) {
+		if content, err = insertConfigKeys(content, cl.Format, &additions, ""); err != nil {
+			return fmt.Errorf("failed to add keys to config file '%s': %w", cl.FilePath, err)
+		}
+	} else {
+		if cl.key == nil {
+			return fmt.Errorf("config file '%s' is encrypted, load it before adding keys so they are encrypted", cl.FilePath)
+		}
+		if err := cl.key.EncryptValues(&additions); err != nil {
+			return fmt.Errorf("failed to encrypt config keys: %w", err)
+		}
+		if content, err = insertConfigKeys(content, cl.Format, &additions, "sops"); err != nil {
+			return fmt.Errorf("failed to add keys to config file '%s': %w", cl.FilePath, err)
+		}
+		if content, err = cl.key.UpdateMAC(content); err != nil {
+			return fmt.Errorf("failed to encrypt config file '%s': %w", cl.FilePath, err)
+		}
+	}
+
+	if err := os.WriteFile(cl.FilePath, content, utils.FilePermission); err != nil {
+		return fmt.Errorf("failed to write config file '%s': %w", cl.FilePath, err)
+	}
+	return nil
+}
+
+// jsonIndentRegex matches the indentation of the first key of a JSON object
+var jsonIndentRegex = regexp.MustCompile(`(?m)^([ \t]+)"`)
+
+// insertConfigKeys inserts the keys of a map node in the top-level map of a
+// YAML or JSON file, before the top-level key 'before' when the file has it
+// and at the end otherwise, leaving the bytes around them untouched
+func insertConfigKeys(content []byte, format ConfigFormat, additions *yaml.Node, before string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		end := bytes.LastIndexByte(content, '}')
+		last := len(bytes.TrimRight(content[:max(end, 0)], " \t\r\n"))
+		if end < 0 || last == 0 {
+			return nil, fmt.Errorf("the top level of the file is not an object")
+		}
+
+		indent := "  "
+		if match := jsonIndentRegex.FindSubmatch(content); match != nil {
+			indent = string(match[1])
+		}
+
+		members := make([]string, 0, len(additions.Content)/2)
+		for i := 0; i+1 < len(additions.Content); i += 2 {
+			var value any
+			if err := additions.Content[i+1].Decode(&value); err != nil {
+				return nil, err
+			}
+			key, err := json.Marshal(additions.Content[i].Value)
+			if err != nil {
+				return nil, err
+			}
+			encoded, err := json.MarshalIndent(value, indent, indent)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, fmt.Sprintf("%s%s: %s", indent, key, encoded))
+		}
+
+		if at := keyLineIndex(content, `[ \t]*"`+regexp.QuoteMeta(before)+`"`); before != "" && at >= 0 {
+			return slices.Concat(content[:at], []byte(strings.Join(members, ",\n")+",\n"), content[at:]), nil
+		}
+		separator := ",\n"
+		if content[last-1] == '{' {
+			separator = "\n"
+		}
+		return slices.Concat(content[:last], []byte(separator+strings.Join(members, ",\n")), content[last:]), nil
+
+	case FormatYAML, FormatYML:
+		var doc yaml.Node
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return nil, err
+		}
+		if len(doc.Content) > 0 && (doc.Content[0].Kind != yaml.MappingNode || doc.Content[0].Style&yaml.FlowStyle != 0) {
+			return nil, fmt.Errorf("the top level of the file is not a block map")
+		}
+
+		var fragment bytes.Buffer
+		encoder := yaml.NewEncoder(&fragment)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(additions); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+
+		if at := keyLineIndex(content, regexp.QuoteMeta(before)); before != "" && at >= 0 {
+			return slices.Concat(content[:at], fragment.Bytes(), content[at:]), nil
+		}
+		if !bytes.HasSuffix(content, []byte("\n")) {
+			content = append(content, '\n')
+		}
+		return append(content, fragment.Bytes()...), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", format)
+	}
+}
+
+// keyLineIndex returns where the last line starting with the key pattern
+// followed by a colon begins, or -1 when there is none
+func keyLineIndex(content []byte, pattern string) int {
+	matches := regexp.MustCompile(`(?m)^`+pattern+`\s*:`).FindAllIndex(content, -1)
+	if len(matches) == 0 {
+		return -1
+	}
+	return matches[len(matches)-1][0]
+}
+
 func DetectConfigFormat(filePath string) ConfigFormat {
 	ext := strings.ToLower(filepath.Ext(filePath))
 	switch ext {
@@ -85,7 +284,7 @@ func FindConfigFile(baseDir, repo string, preferredFormat ConfigFormat) (string,
 			return configPath, preferredFormat, nil
 		}
 		// If preferred format not found, continue with auto-detection
-		fmt.Printf("Warning: Preferred config format '%s' not found, auto-detecting...\n", preferredFormat)
+		fmt.Fprintf(os.Stderr, "Warning: Preferred config format '%s' not found, auto-detecting...\n", preferredFormat)
 	}
 
 	// Define all possible config file candidates
@@ -129,12 +328,12 @@ func FindConfigFile(baseDir, repo string, preferredFormat ConfigFormat) (string,
 
 // promptForConfigChoice asks the user to choose between multiple config files
 func promptForConfigChoice(candidates []ConfigCandidate) (string, ConfigFormat, error) {
-	fmt.Printf("\nMultiple configuration files found:\n")
+	fmt.Fprintf(os.Stderr, "\nMultiple configuration files found:\n")
 	for i, candidate := range candidates {
-		fmt.Printf("  %d) %s\n", i+1, candidate.Filename)
+		fmt.Fprintf(os.Stderr, "  %d) %s\n", i+1, candidate.Filename)
 	}
 
-	fmt.Printf("\nPlease choose which config file to use (1-%d): ", len(candidates))
+	fmt.Fprintf(os.Stderr, "\nPlease choose which config file to use (1-%d): ", len(candidates))
 
 	reader := bufio.NewReader(os.Stdin)
 	input, err := reader.ReadString('\n')
@@ -153,7 +352,7 @@ func promptForConfigChoice(candidates []ConfigCandidate) (string, ConfigFormat,
 	}
 
 	selected := candidates[choice-1]
-	fmt.Printf("Selected: %s\n", selected.Filename)
+	fmt.Fprintf(os.Stderr, "Selected: %s\n", selected.Filename)
 
 	return selected.Path, selected.Format, nil
 }
@@ -193,8 +392,8 @@ var generateCmd = &cobra.Command{
 	Short: "Generates the manifest given a config file and at least one template",
 	Long: `The generate command renders Kubernetes manifests by combining your project's templates with values provided in a configuration file.
 
-It scans the 'templates/<namespace>/' directory of your Maniplacer project, applies the values from the configuration file, and writes the rendered manifests into 'manifests/<namespace>/<timestamp>/'.
-Each run is timestamped, ensuring outputs from previous runs are preserved instead of being overwritten.
+It scans the 'templates/<namespace>/' directory of your Maniplacer project, applies the values from the configuration file, and writes the rendered manifests into 'manifests/<namespace>/<run-id>/'.
+Each run gets its own folder named after its timestamp plus a sequence number (e.g. 2024-01-15_14-30-45-0001), so outputs from previous runs, or from parallel runs started in the same second, are preserved instead of being overwritten.
 
 You can customize the input config format with the --format (or -f) flag, select a template namespace with the --namespace (or -n) flag, and specify the target repository with the --repo (or -r) flag.
 
@@ -212,12 +411,35 @@ Example usage:
   maniplacer generate -c /path/to/custom-config.json
   maniplacer generate -c custom.yaml -f yaml
   maniplacer generate --dry-run
+  maniplacer generate --skip-unchanged
+  maniplacer generate -r myrepo -n production -o - | kubectl apply -f -
+  maniplacer generate -r myrepo -o - --format-out json
+  maniplacer generate -r myrepo -n production --format-out kustomize
+  maniplacer generate --repos myrepo --all-namespaces --format-out kustomize --kustomize-overlays
+  maniplacer generate --all-repos --all-namespaces
+  maniplacer generate -r myrepo -n staging --watch
+  maniplacer generate --repos 'api-*' --namespaces 'staging,prod*' --concurrency 4
+  maniplacer generate -r myrepo -n production --image myapp=ghcr.io/acme/myapp:1.4.2 --resolve-digests
 
 Notes:
 - The current directory must be a valid Maniplacer project (contain a '.maniplacer' file).
 - The specified namespace must exist under the 'templates' directory.
 - Each run creates a unique timestamped output folder for safe, repeatable generation.
-- Use --dry-run to preview without writing files.`,
+- Runs are only published once every template rendered, use --allow-partial to write the ones that did.
+- Use --dry-run to preview without writing files.
+- Use --output - to stream the rendered manifests to stdout, informational output then goes to stderr.
+- An optional '<repo>/settings.yaml' adds common labels and annotations and can force the namespace.
+- Use --image name=repo:tag (repeatable) to override workload images, the settings 'images' list does the same.
+- Use --resolve-digests to pin every workload image to the digest its tag points to.
+- Patches in '<repo>/patches/<namespace>/' are applied to the rendered objects before anything is written.
+- CEL policies in the project 'policies/' directory are checked on every run and enforced by 'apply'.
+- Config files encrypted with 'maniplacer secrets' are decrypted in memory.
+- Every run records how it was produced in a hidden '.maniplacer-run.json'.
+- Use --format-out kustomize to add a kustomization.yaml to every run, 'apply' skips it.
+- Add --kustomize-overlays, with every namespace of a repo selected, to write a base and overlays to '<repo>/kustomize/'.
+- Use --all-repos, --all-namespaces or the --repos/--namespaces globs to render several targets in parallel.
+- Use --watch to re-render as you edit, nothing is written unless --watch-write is given.
+- Use --skip-unchanged to skip writing a run identical to the latest one, the command then exits with code 3.`,
 	Args: cobra.MaximumNArgs(0),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		logger := utils.LoggerFromContext(cmd.Context())
@@ -232,11 +454,6 @@ Notes:
 			namespace = utils.DefaultNamespace
 		}
 
-		// Validate namespace
-		if err := utils.ValidateNamespace(namespace); err != nil {
-			return fmt.Errorf("invalid namespace: %w", err)
-		}
-
 		formatFlag, err := cmd.Flags().GetString("format")
 		if err != nil {
 			logger.Debug("could not parse format flag, using auto-detection", "error", err)
@@ -255,217 +472,620 @@ Notes:
 			dryRun = false
 		}
 
-		repo, err := cmd.Flags().GetString("repo")
+		skipUnchanged, err := cmd.Flags().GetBool("skip-unchanged")
 		if err != nil {
-			return fmt.Errorf("could not get repo flag: %w", err)
+			logger.Debug("could not parse skip-unchanged flag", "error", err)
+			skipUnchanged = false
 		}
 
-		if repo == "" {
-			return fmt.Errorf("repository name is required (use --repo flag)")
+		allowPartial, err := cmd.Flags().GetBool("allow-partial")
+		if err != nil {
+			logger.Debug("could not parse allow-partial flag", "error", err)
+			allowPartial = false
 		}
 
-		// Validate repo name and check for path traversal
-		if err := utils.ValidateRepoName(repo); err != nil {
-			return fmt.Errorf("invalid repository name: %w", err)
+		outputFlag, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logger.Debug("could not parse output flag, writing a run", "error", err)
+			outputFlag = ""
 		}
-		if err := utils.ValidateSafePath(repo); err != nil {
-			return err
+
+		formatOut, err := cmd.Flags().GetString("format-out")
+		if err != nil {
+			logger.Debug("could not parse format-out flag, using yaml", "error", err)
+			formatOut = outputFormatYAML
 		}
 
-		currentDir, err := os.Getwd()
+		allRepos, err := cmd.Flags().GetBool("all-repos")
 		if err != nil {
-			return fmt.Errorf("could not get current directory: %w", err)
+			logger.Debug("could not parse all-repos flag", "error", err)
+			allRepos = false
 		}
 
-		templateDir := filepath.Join(currentDir, repo, "templates", namespace)
-		if _, err := os.Stat(templateDir); err != nil {
-			return fmt.Errorf("template directory '%s' not found: %w", templateDir, err)
+		allNamespaces, err := cmd.Flags().GetBool("all-namespaces")
+		if err != nil {
+			logger.Debug("could not parse all-namespaces flag", "error", err)
+			allNamespaces = false
 		}
 
-		files, err := os.ReadDir(templateDir)
+		repoPatterns, err := cmd.Flags().GetStringSlice("repos")
 		if err != nil {
-			return fmt.Errorf("could not read template directory: %w", err)
+			logger.Debug("could not parse repos flag", "error", err)
+			repoPatterns = nil
 		}
 
-		if len(files) == 0 {
-			return fmt.Errorf("template namespace '%s' is empty", namespace)
+		namespacePatterns, err := cmd.Flags().GetStringSlice("namespaces")
+		if err != nil {
+			logger.Debug("could not parse namespaces flag", "error", err)
+			namespacePatterns = nil
 		}
 
-		// Find and load configuration file
-		var configPath string
-		var detectedFormat ConfigFormat
+		concurrency, err := cmd.Flags().GetInt("concurrency")
+		if err != nil || concurrency < 1 {
+			logger.Debug("invalid concurrency flag, using number of CPUs", "error", err)
+			concurrency = runtime.NumCPU()
+		}
 
-		if customConfigPath != "" {
-			// Use custom config file path
-			if !filepath.IsAbs(customConfigPath) {
-				customConfigPath = filepath.Join(currentDir, repo, customConfigPath)
-			}
+		watch, err := cmd.Flags().GetBool("watch")
+		if err != nil {
+			logger.Debug("could not parse watch flag", "error", err)
+			watch = false
+		}
+
+		watchWrite, err := cmd.Flags().GetBool("watch-write")
+		if err != nil {
+			logger.Debug("could not parse watch-write flag", "error", err)
+			watchWrite = false
+		}
+
+		kustomizeOverlays, err := cmd.Flags().GetBool("kustomize-overlays")
+		if err != nil {
+			logger.Debug("could not parse kustomize-overlays flag", "error", err)
+			kustomizeOverlays = false
+		}
+
+		imageFlags, err := cmd.Flags().GetStringArray("image")
+		if err != nil {
+			logger.Debug("could not parse image flag", "error", err)
+			imageFlags = nil
+		}
 
-			// Validate custom config path for path traversal
-			if err := utils.ValidateSafePath(customConfigPath); err != nil {
+		resolveDigests, err := cmd.Flags().GetBool("resolve-digests")
+		if err != nil {
+			logger.Debug("could not parse resolve-digests flag", "error", err)
+			resolveDigests = false
+		}
+
+		repo, err := cmd.Flags().GetString("repo")
+		if err != nil {
+			return fmt.Errorf("could not get repo flag: %w", err)
+		}
+
+		var images []imageOverride
+		for _, value := range imageFlags {
+			override, err := parseImageFlag(value)
+			if err != nil {
 				return err
 			}
+			images = mergeImageOverrides(images, []imageOverride{override})
+		}
+
+		toStdout := outputFlag == stdoutOutput
+		if err := validateOutputFormat(formatOut, toStdout); err != nil {
+			return err
+		}
 
-			if _, err := os.Stat(customConfigPath); err != nil {
-				return fmt.Errorf("custom config file not found: %s", customConfigPath)
+		if kustomizeOverlays && formatOut != outputFormatKustomize {
+			return fmt.Errorf("--kustomize-overlays requires --format-out %s", outputFormatKustomize)
+		}
+
+		if formatFlag != "" {
+			switch ConfigFormat(strings.ToLower(formatFlag)) {
+			case FormatJSON, FormatYAML, FormatYML:
+				// Valid format
+			default:
+				return fmt.Errorf("unsupported format '%s'. Supported formats: json, yaml, yml", formatFlag)
 			}
+		}
 
-			configPath = customConfigPath
-
-			// Determine format for custom config file
-			if formatFlag != "" {
-				// Format explicitly specified
-				detectedFormat = ConfigFormat(strings.ToLower(formatFlag))
-				// Validate the format flag
-				switch detectedFormat {
-				case FormatJSON, FormatYAML, FormatYML:
-					// Valid format
-				default:
-					return fmt.Errorf("unsupported format '%s'. Supported formats: json, yaml, yml", formatFlag)
-				}
-			} else {
-				// Auto-detect format for custom file
-				detectedFormat, err = AutoDetectConfigFormat(customConfigPath)
-				if err != nil {
-					return fmt.Errorf("could not detect format for custom config file: %w", err)
-				}
+		if outputFlag != "" && !toStdout {
+			return fmt.Errorf("unsupported output '%s', only '%s' (stdout) is supported", outputFlag, stdoutOutput)
+		}
+
+		currentDir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("could not get current directory: %w", err)
+		}
+
+		selector := targetSelector{
+			Repo:              repo,
+			Namespace:         namespace,
+			AllRepos:          allRepos,
+			AllNamespaces:     allNamespaces,
+			RepoPatterns:      repoPatterns,
+			NamespacePatterns: namespacePatterns,
+		}
+
+		var targets []generateTarget
+		if selector.isMulti() {
+			targets, err = discoverTargets(currentDir, selector)
+			if err != nil {
+				return err
 			}
 		} else {
-			// Use standard config file detection
-			var preferredFormat ConfigFormat
-			if formatFlag != "" {
-				preferredFormat = ConfigFormat(strings.ToLower(formatFlag))
-				// Validate the format flag
-				switch preferredFormat {
-				case FormatJSON, FormatYAML, FormatYML:
-					// Valid format
-				default:
-					return fmt.Errorf("unsupported format '%s'. Supported formats: json, yaml, yml", formatFlag)
-				}
+			if repo == "" {
+				return fmt.Errorf("repository name is required (use --repo flag)")
 			}
 
-			configPath, detectedFormat, err = FindConfigFile(currentDir, repo, preferredFormat)
-			if err != nil {
+			// Validate namespace
+			if err := utils.ValidateNamespace(namespace); err != nil {
+				return fmt.Errorf("invalid namespace: %w", err)
+			}
+
+			// Validate repo name and check for path traversal
+			if err := utils.ValidateRepoName(repo); err != nil {
+				return fmt.Errorf("invalid repository name: %w", err)
+			}
+			if err := utils.ValidateSafePath(repo); err != nil {
 				return err
 			}
+
+			targets = []generateTarget{newGenerateTarget(currentDir, repo, namespace)}
 		}
 
-		logger.Info("using config file", "format", strings.ToUpper(string(detectedFormat)), "path", configPath)
-		fmt.Printf("Using %s config file: %s\n", strings.ToUpper(string(detectedFormat)), configPath)
+		for i := range targets {
+			targets[i].ManifestsDir = targetManifestsDir(currentDir, outputFlag, targets[i], selector.isMulti())
+		}
 
-		loader := &ConfigLoader{
-			FilePath: configPath,
-			Format:   detectedFormat,
+		// Config files are resolved up front and one target at a time, since
+		// detection may need to prompt the user
+		resolveTargetConfigs(currentDir, targets, customConfigPath, formatFlag)
+
+		opts := generateOptions{
+			DryRun:        dryRun,
+			SkipUnchanged: skipUnchanged,
+			AllowPartial:  allowPartial,
+			Stream:        toStdout,
+			Kustomize:     formatOut == outputFormatKustomize,
+			Images:        images,
+		}
+		if resolveDigests {
+			opts.Resolver = newDigestResolver(nil)
 		}
 
-		config, err := loader.LoadConfig()
-		if err != nil {
-			return fmt.Errorf("failed to load config: %w", err)
+		// When streaming manifests every informational message goes to stderr
+		// so stdout only carries the rendered documents
+		out := cmd.OutOrStdout()
+		if toStdout {
+			out = cmd.ErrOrStderr()
 		}
 
-		if err := ValidateConfig(config); err != nil {
-			return fmt.Errorf("configuration validation failed: %w", err)
+		if watchWrite && !watch {
+			return fmt.Errorf("--watch-write requires --watch")
 		}
 
-		logger.Info("configuration loaded successfully", "keys", len(config))
-		fmt.Printf("Successfully loaded configuration with %d top-level keys\n", len(config))
+		if kustomizeOverlays && !selector.isMulti() {
+			return fmt.Errorf("--kustomize-overlays needs several namespaces of a repo (use --all-namespaces or --namespaces)")
+		}
+
+		if watch {
+			if selector.isMulti() || toStdout {
+				return fmt.Errorf("--watch works on a single repo and namespace and cannot be combined with --output %s", stdoutOutput)
+			}
+			if opts.Kustomize {
+				return fmt.Errorf("--watch cannot be combined with --format-out %s", outputFormatKustomize)
+			}
+			if resolveDigests {
+				return fmt.Errorf("--watch cannot be combined with --resolve-digests")
+			}
 
-		// Generate output directory with timestamp
-		timestamp := time.Now().Format("2006-01-02_15-04-05")
-		outputDir := filepath.Join(currentDir, repo, "manifests", namespace, timestamp)
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
 
-		if !dryRun {
-			if err := os.MkdirAll(outputDir, utils.DirPermission); err != nil {
-				return fmt.Errorf("could not create output directory '%s': %w", outputDir, err)
+			return watchTarget(ctx, out, targets[0], watchWrite, images)
+		}
+
+		if !selector.isMulti() {
+			result := runGenerateTarget(cmd.Context(), out, opts, targets[0])
+			if result.Unchanged {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return &ExitError{Code: ExitCodeNoChanges}
 			}
-			logger.Info("output directory created", "path", outputDir)
-			fmt.Printf("Output directory: %s\n", outputDir)
-		} else {
-			logger.Info("dry-run mode enabled, no files will be written")
-			fmt.Printf("Dry-run mode: no files will be written\n")
+			if toStdout && len(result.Stream) > 0 {
+				if err := writeManifestStream(cmd.OutOrStdout(), result.Stream, formatOut); err != nil {
+					return fmt.Errorf("could not write manifests to stdout: %w", err)
+				}
+			}
+			return result.Err
 		}
 
-		// Process templates
-		successCount := 0
-		errorCount := 0
+		logger.Info("generating targets", "count", len(targets), "concurrency", concurrency)
+		fmt.Fprintf(out, "Generating %d targets with up to %d workers\n", len(targets), concurrency)
 
-		for _, file := range files {
-			if file.IsDir() {
-				continue // Skip directories
-			}
+		results := runGenerateTargets(cmd.Context(), opts, targets, concurrency)
+		for _, result := range results {
+			fmt.Fprintf(out, "\n==> %s\n%s", result.Target, result.Output)
+		}
 
-			templatePath := filepath.Join(templateDir, file.Name())
-
-			if err := processTemplate(cmd.Context(), templatePath, outputDir, file.Name(), config, dryRun); err != nil {
-				logger.Warn("failed to process template", "file", file.Name(), "error", err)
-				fmt.Printf("Warning: Failed to process template '%s': %s\n", file.Name(), err)
-				errorCount++
-			} else {
-				if dryRun {
-					fmt.Printf("Would generate: %s\n", file.Name())
-				} else {
-					logger.Info("manifest generated", "file", file.Name())
-					fmt.Printf("Generated: %s\n", filepath.Join(outputDir, file.Name()))
+		if toStdout {
+			var stream []renderedManifest
+			for _, result := range results {
+				for _, manifest := range result.Stream {
+					manifest.Name = fmt.Sprintf("%s/%s", result.Target, manifest.Name)
+					stream = append(stream, manifest)
+				}
+			}
+			if len(stream) > 0 {
+				if err := writeManifestStream(cmd.OutOrStdout(), stream, formatOut); err != nil {
+					return fmt.Errorf("could not write manifests to stdout: %w", err)
 				}
-				successCount++
 			}
 		}
 
-		logger.Info("generation complete", "successful", successCount, "errors", errorCount)
-		fmt.Printf("\nGeneration complete: %d successful, %d errors\n", successCount, errorCount)
+		var overlaysErr error
+		if kustomizeOverlays {
+			overlaysErr = writeKustomizeOverlays(out, currentDir, results, dryRun)
+		}
+
+		failed, unchanged := printGenerateSummary(out, results)
+		logger.Info("generation summary", "targets", len(results), "failed", failed, "unchanged", unchanged)
 
-		if errorCount > 0 {
-			return fmt.Errorf("generation completed with %d errors", errorCount)
+		if failed > 0 {
+			return fmt.Errorf("generation failed for %d of %d targets", failed, len(results))
+		}
+		if overlaysErr != nil {
+			return overlaysErr
+		}
+		if skipUnchanged && unchanged == len(results) {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+			return &ExitError{Code: ExitCodeNoChanges}
 		}
 
 		return nil
 	},
 }
 
-// processTemplate handles the rendering of a single template file
-func processTemplate(ctx context.Context, templatePath, outputDir, filename string, config map[string]any, dryRun bool) error {
-	logger := utils.LoggerFromContext(ctx)
+// generateOptions holds the flags that shape how a single target is generated
+type generateOptions struct {
+	DryRun        bool
+	SkipUnchanged bool
+	AllowPartial  bool
+	Stream        bool
+	Kustomize     bool
+	Images        []imageOverride // From --image, replacing the settings images of the same name
+	Resolver      *digestResolver // Set with --resolve-digests
+}
 
-	content, err := os.ReadFile(templatePath)
+// generateResult is the outcome of generating a single target
+type generateResult struct {
+	Target    generateTarget
+	Run       RunID
+	Success   int
+	Errors    int
+	Unchanged bool
+	Stream    []renderedManifest
+	Manifests []renderedManifest
+	Output    string
+	Err       error
+}
+
+// resolveConfigPath finds the config file of a repo, honoring a custom path and format flag
+func resolveConfigPath(currentDir, repo, customConfigPath, formatFlag string) (string, ConfigFormat, error) {
+	if customConfigPath != "" {
+		// Use custom config file path
+		if !filepath.IsAbs(customConfigPath) {
+			customConfigPath = filepath.Join(currentDir, repo, customConfigPath)
+		}
+
+		// Validate custom config path for path traversal
+		if err := utils.ValidateSafePath(customConfigPath); err != nil {
+			return "", "", err
+		}
+
+		if _, err := os.Stat(customConfigPath); err != nil {
+			return "", "", fmt.Errorf("custom config file not found: %s", customConfigPath)
+		}
+
+		// Determine format for custom config file
+		if formatFlag != "" {
+			// Format explicitly specified
+			return customConfigPath, ConfigFormat(strings.ToLower(formatFlag)), nil
+		}
+
+		// Auto-detect format for custom file
+		detectedFormat, err := AutoDetectConfigFormat(customConfigPath)
+		if err != nil {
+			return "", "", fmt.Errorf("could not detect format for custom config file: %w", err)
+		}
+		return customConfigPath, detectedFormat, nil
+	}
+
+	// Use standard config file detection
+	return FindConfigFile(currentDir, repo, ConfigFormat(strings.ToLower(formatFlag)))
+}
+
+// runGenerateTarget renders one repo/namespace pair and writes, streams or
+// previews the result depending on opts. Progress is reported to out.
+func runGenerateTarget(ctx context.Context, out io.Writer, opts generateOptions, target generateTarget) generateResult {
+	logger := utils.LoggerFromContext(ctx).With("repo", target.Repo, "namespace", target.Namespace)
+	result := generateResult{Target: target}
+
+	fail := func(err error) generateResult {
+		result.Err = err
+		return result
+	}
+
+	if target.ConfigErr != nil {
+		return fail(target.ConfigErr)
+	}
+
+	if _, err := os.Stat(target.TemplateDir); err != nil {
+		return fail(fmt.Errorf("template directory '%s' not found: %w", target.TemplateDir, err))
+	}
+
+	files, err := os.ReadDir(target.TemplateDir)
+	if err != nil {
+		return fail(fmt.Errorf("could not read template directory: %w", err))
+	}
+
+	if len(files) == 0 {
+		return fail(fmt.Errorf("template namespace '%s' is empty", target.Namespace))
+	}
+
+	logger.Info("using config file", "format", strings.ToUpper(string(target.ConfigFormat)), "path", target.ConfigPath)
+	fmt.Fprintf(out, "Using %s config file: %s\n", strings.ToUpper(string(target.ConfigFormat)), target.ConfigPath)
+
+	loader := &ConfigLoader{
+		FilePath: target.ConfigPath,
+		Format:   target.ConfigFormat,
+	}
+
+	config, err := loader.LoadConfig()
 	if err != nil {
-		return fmt.Errorf("could not read template file: %w", err)
+		return fail(fmt.Errorf("failed to load config: %w", err))
 	}
 
-	templ, err := template.New(filename).Funcs(templates.ManiplacerFuncs).Parse(string(content))
+	if err := ValidateConfig(config); err != nil {
+		return fail(fmt.Errorf("configuration validation failed: %w", err))
+	}
+
+	logger.Info("configuration loaded successfully", "keys", len(config))
+	fmt.Fprintf(out, "Successfully loaded configuration with %d top-level keys\n", len(config))
+
+	if opts.DryRun {
+		logger.Info("dry-run mode enabled, no files will be written")
+		fmt.Fprintf(out, "Dry-run mode: no files will be written\n")
+	}
+
+	// Render every template in memory first so the output can be compared
+	// against the latest run before anything is written
+	manifests, errorCount := renderTemplates(ctx, out, target.TemplateDir, files, config)
+	result.Errors = errorCount
+
+	repoSettings, err := loadRepoSettings(target.SettingsPath)
 	if err != nil {
-		return fmt.Errorf("could not parse template: %w", err)
+		return fail(err)
+	}
+	settings := repoSettings.forNamespace(target.Namespace)
+	if manifests, err = injectSettings(manifests, settings); err != nil {
+		return fail(err)
+	}
+
+	metadata := runMetadata{Repo: target.Repo, Namespace: target.Namespace}
+
+	images := mergeImageOverrides(settings.Images, opts.Images)
+	if manifests, metadata.Images, err = overrideImages(ctx, manifests, images, opts.Resolver); err != nil {
+		return fail(err)
+	}
+	for _, image := range metadata.Images {
+		logger.Info("image rewritten", "original", image.Original, "image", image.Image, "objects", image.Objects)
+		fmt.Fprintf(out, "Image %s → %s (%s)\n", image.Original, image.Image, strings.Join(image.Objects, ", "))
 	}
 
-	if dryRun {
-		// In dry-run mode, just validate the template without writing
-		var output strings.Builder
-		if err := templ.Execute(&output, config); err != nil {
-			return fmt.Errorf("could not execute template: %w", err)
+	patches, err := loadPatches(target.PatchesDir)
+	if err != nil {
+		return fail(err)
+	}
+	if manifests, metadata.Patches, err = applyPatches(manifests, patches); err != nil {
+		return fail(err)
+	}
+	for _, patch := range metadata.Patches {
+		if len(patch.Objects) == 0 {
+			logger.Warn("patch matched no object", "file", patch.File, "document", patch.Document)
+			fmt.Fprintf(out, "Warning: patch %s (document %d) matched no object\n", patch.File, patch.Document)
+			continue
+		}
+		logger.Info("patch applied", "file", patch.File, "document", patch.Document, "objects", patch.Objects)
+		fmt.Fprintf(out, "Patched %s with %s\n", strings.Join(patch.Objects, ", "), patch.File)
+	}
+
+	if metadata.PolicyFindings, err = checkPolicies(target.PoliciesDir, manifests, settings.Lint); err != nil {
+		return fail(err)
+	}
+	for _, finding := range metadata.PolicyFindings {
+		logger.Warn("policy finding", "rule", finding.Rule, "severity", finding.Severity, "object", finding.Object, "message", finding.Message)
+		fmt.Fprintf(out, "Policy: %s\n", formatFinding(finding))
+	}
+	if blocking := (lint.Report{Findings: metadata.PolicyFindings}).Count(lint.SeverityError); blocking > 0 {
+		fmt.Fprintf(out, "Warning: %d policy errors, apply will refuse this run unless --ignore-policies is given\n", blocking)
+	}
+
+	if opts.Kustomize {
+		if manifests, err = withKustomization(manifests, target.Repo, target.Namespace); err != nil {
+			return fail(err)
+		}
+	}
+	result.Manifests = manifests
+
+	if opts.SkipUnchanged && !opts.DryRun && !opts.Stream && errorCount == 0 {
+		if latest, unchanged := latestRunMatches(target.ManifestsDir, manifests); unchanged {
+			logger.Info("rendered output matches latest run", "run", latest)
+			fmt.Fprintf(out, "No changes: rendered output matches run %s\n", latest)
+			result.Run = latest
+			result.Unchanged = true
+			return result
+		}
+	}
+
+	if errorCount > 0 && !opts.AllowPartial && !opts.DryRun {
+		logger.Warn("generation aborted, no run written", "errors", errorCount)
+		fmt.Fprintf(out, "\nGeneration aborted: %d templates failed, no manifests were written (use --allow-partial to keep the successful ones)\n", errorCount)
+		return fail(fmt.Errorf("generation failed with %d errors", errorCount))
+	}
+
+	switch {
+	case opts.DryRun:
+		for _, manifest := range manifests {
+			fmt.Fprintf(out, "Would generate: %s\n", manifest.Name)
+			result.Success++
+		}
+	case opts.Stream:
+		result.Stream = manifests
+		result.Success = len(manifests)
+	case len(manifests) > 0:
+		metadataFile, err := metadata.manifest()
+		if err != nil {
+			return fail(err)
+		}
+		outputDir, run, err := WriteRun(target.ManifestsDir, append(slices.Clone(manifests), metadataFile), time.Now())
+		if err != nil {
+			return fail(fmt.Errorf("could not write manifests: %w", err))
+		}
+		result.Run = run
+		logger.Info("output directory created", "path", outputDir, "run", run)
+		fmt.Fprintf(out, "Output directory: %s\n", outputDir)
+
+		for _, manifest := range manifests {
+			logger.Info("manifest generated", "file", manifest.Name)
+			fmt.Fprintf(out, "Generated: %s\n", filepath.Join(outputDir, manifest.Name))
+			result.Success++
 		}
-		logger.Debug("template validated successfully", "file", filename)
-		return nil
 	}
 
-	outputPath := filepath.Join(outputDir, filename)
-	f, err := os.Create(outputPath)
+	logger.Info("generation complete", "successful", result.Success, "errors", errorCount)
+	fmt.Fprintf(out, "\nGeneration complete: %d successful, %d errors\n", result.Success, errorCount)
+
+	if errorCount > 0 {
+		return fail(fmt.Errorf("generation completed with %d errors", errorCount))
+	}
+
+	return result
+}
+
+// renderedManifest is the in-memory output of a single template
+type renderedManifest struct {
+	Name    string
+	Content []byte
+}
+
+// partialPrefix marks templates that only hold 'define' blocks shared by the
+// other templates of a namespace, like '_helpers.tpl'. They are not rendered.
+const partialPrefix = "_"
+
+// isPartialTemplate reports whether a template file name is a partial
+func isPartialTemplate(name string) bool {
+	return strings.HasPrefix(name, partialPrefix)
+}
+
+// templatePartial is the content of a partial template
+type templatePartial struct {
+	Name    string
+	Content string
+}
+
+// loadPartials reads every partial template of templateDir, sorted by name
+func loadPartials(templateDir string) ([]templatePartial, error) {
+	entries, err := os.ReadDir(templateDir)
 	if err != nil {
-		return fmt.Errorf("could not create output file: %w", err)
+		return nil, fmt.Errorf("could not read template directory: %w", err)
 	}
-	defer func() {
-		if closeErr := f.Close(); closeErr != nil {
-			logger.Warn("failed to close output file", "file", outputPath, "error", closeErr)
+
+	var partials []templatePartial
+	for _, entry := range entries {
+		if entry.IsDir() || !isPartialTemplate(entry.Name()) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(templateDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not read partial '%s': %w", entry.Name(), err)
 		}
-	}()
+		partials = append(partials, templatePartial{Name: entry.Name(), Content: string(content)})
+	}
+	return partials, nil
+}
 
-	if err := templ.Execute(f, config); err != nil {
-		// Clean up the partially written file on error
-		f.Close()
-		if removeErr := os.Remove(outputPath); removeErr != nil {
-			logger.Warn("failed to remove partial output file", "file", outputPath, "error", removeErr)
+// renderTemplates renders every template file in templateDir, returning the
+// successful outputs and the number of templates that failed
+func renderTemplates(ctx context.Context, out io.Writer, templateDir string, files []os.DirEntry, config map[string]any) ([]renderedManifest, int) {
+	logger := utils.LoggerFromContext(ctx)
+
+	var manifests []renderedManifest
+	errorCount := 0
+
+	partials, err := loadPartials(templateDir)
+	if err != nil {
+		logger.Warn("failed to load partials", "error", err)
+		fmt.Fprintf(out, "Warning: %s\n", err)
+		errorCount++
+	}
+
+	for _, file := range files {
+		if file.IsDir() || isPartialTemplate(file.Name()) {
+			continue // Skip directories and partials
+		}
+
+		content, err := renderTemplate(ctx, filepath.Join(templateDir, file.Name()), file.Name(), partials, config)
+		if err != nil {
+			logger.Warn("failed to process template", "file", file.Name(), "error", err)
+			fmt.Fprintf(out, "Warning: Failed to process template '%s': %s\n", file.Name(), err)
+			errorCount++
+			continue
 		}
-		return fmt.Errorf("could not execute template: %w", err)
+
+		manifests = append(manifests, renderedManifest{Name: file.Name(), Content: content})
 	}
 
+	return manifests, errorCount
+}
+
+// renderTemplate handles the rendering of a single template file, with the
+// templates defined by partials available to it
+func renderTemplate(ctx context.Context, templatePath, filename string, partials []templatePartial, config map[string]any) ([]byte, error) {
+	logger := utils.LoggerFromContext(ctx)
+
+	content, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read template file: %w", err)
+	}
+
+	templ := template.New(filename).Funcs(templates.ManiplacerFuncs)
+	for _, partial := range partials {
+		if _, err := templ.New(partial.Name).Parse(partial.Content); err != nil {
+			return nil, fmt.Errorf("could not parse partial '%s': %w", partial.Name, err)
+		}
+	}
+
+	if _, err := templ.Parse(string(content)); err != nil {
+		return nil, fmt.Errorf("could not parse template: %w", err)
+	}
+
+	var output bytes.Buffer
+	if err := templ.Execute(&output, config); err != nil {
+		return nil, fmt.Errorf("could not execute template: %w", err)
+	}
+
+	logger.Debug("template rendered successfully", "file", filename)
+	return output.Bytes(), nil
+}
+
+// writeManifest writes a rendered manifest into outputDir
+func writeManifest(outputDir string, manifest renderedManifest) error {
+	outputPath := filepath.Join(outputDir, manifest.Name)
+	if err := os.WriteFile(outputPath, manifest.Content, utils.FilePermission); err != nil {
+		return fmt.Errorf("could not write output file: %w", err)
+	}
 	return nil
 }
 
@@ -476,4 +1096,18 @@ func init() {
 	generateCmd.Flags().StringP("repo", "r", "", "Repository name")
 	generateCmd.Flags().StringP("config", "c", "", "Custom path to config file (overrides default config file detection)")
 	generateCmd.Flags().Bool("dry-run", false, "Preview generation without writing files")
+	generateCmd.Flags().StringP("output", "o", "", "Use '-' to stream the rendered manifests to stdout instead of writing a run")
+	generateCmd.Flags().String("format-out", outputFormatYAML, "Format of the streamed manifests when using --output - (yaml, json), or kustomize to write every run as a kustomization")
+	generateCmd.Flags().Bool("kustomize-overlays", false, "With --format-out kustomize and every namespace of a repo selected, also write a base and one overlay per namespace to '<repo>/kustomize/'")
+	generateCmd.Flags().Bool("all-repos", false, "Generate every repo in the project")
+	generateCmd.Flags().Bool("all-namespaces", false, "Generate every template namespace of the selected repos")
+	generateCmd.Flags().StringSlice("repos", nil, "Glob patterns selecting the repos to generate (e.g. 'api-*')")
+	generateCmd.Flags().StringSlice("namespaces", nil, "Glob patterns selecting the namespaces to generate (e.g. 'prod*')")
+	generateCmd.Flags().Int("concurrency", runtime.NumCPU(), "Maximum number of targets generated in parallel")
+	generateCmd.Flags().Bool("watch", false, "Re-render templates whenever they or the config file change")
+	generateCmd.Flags().Bool("watch-write", false, "With --watch, also write a new run after every change that renders cleanly")
+	generateCmd.Flags().StringArray("image", nil, "Rewrite the images named 'name' in rendered workloads (name=repo[:tag][@digest], name=:tag), repeatable")
+	generateCmd.Flags().Bool("resolve-digests", false, "Pin every workload image to the digest its tag points to in the registry")
+	generateCmd.Flags().Bool("allow-partial", false, "Write a run even when some templates fail to render")
+	generateCmd.Flags().Bool("skip-unchanged", false, fmt.Sprintf("Skip writing a new run when the output matches the latest run (exits with code %d)", ExitCodeNoChanges))
 }
@@ -0,0 +1,377 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dantedelordran/maniplacer/internal/lint"
+	"github.com/dantedelordran/maniplacer/internal/utils"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// imageOverride rewrites the container images named Name, like the images
+// field of a kustomization. Empty fields keep what the template rendered.
+type imageOverride struct {
+	Name    string `yaml:"name"`
+	NewName string `yaml:"newName,omitempty"`
+	NewTag  string `yaml:"newTag,omitempty"`
+	Digest  string `yaml:"digest,omitempty"`
+}
+
+// imageResult records an image generate rewrote and where
+type imageResult struct {
+	Original string   `json:"original"`
+	Image    string   `json:"image"`
+	Digest   string   `json:"digest,omitempty"`
+	Objects  []string `json:"objects"`
+}
+
+// imageReference is a parsed container image reference
+type imageReference struct {
+	Name   string // Everything before the tag, registry included
+	Tag    string
+	Digest string
+}
+
+// parseImageReference splits 'registry/name:tag@digest' into its parts
+func parseImageReference(image string) imageReference {
+	var ref imageReference
+	ref.Name, ref.Digest, _ = strings.Cut(image, "@")
+	// A colon before the last slash is the port of the registry, not a tag
+	if i := strings.LastIndex(ref.Name, ":"); i > strings.LastIndex(ref.Name, "/") {
+		ref.Name, ref.Tag = ref.Name[:i], ref.Name[i+1:]
+	}
+	return ref
+}
+
+func (r imageReference) String() string {
+	image := r.Name
+	if r.Tag != "" {
+		image += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		image += "@" + r.Digest
+	}
+	return image
+}
+
+// parseImageFlag parses a --image value, 'name=newName:newTag', 'name=newName@digest',
+// 'name=:newTag' or 'name=@digest'
+func parseImageFlag(value string) (imageOverride, error) {
+	name, image, ok := strings.Cut(value, "=")
+	if !ok || name == "" || image == "" {
+		return imageOverride{}, fmt.Errorf("invalid --image '%s', expected name=image[:tag][@digest]", value)
+	}
+
+	ref := parseImageReference(image)
+	override := imageOverride{Name: name, NewName: ref.Name, NewTag: ref.Tag, Digest: ref.Digest}
+	if err := override.validate(); err != nil {
+		return imageOverride{}, fmt.Errorf("invalid --image '%s': %w", value, err)
+	}
+	return override, nil
+}
+
+func (o imageOverride) validate() error {
+	if o.Name == "" {
+		return fmt.Errorf("image name is required")
+	}
+	if strings.ContainsAny(o.Name, ":@") {
+		return fmt.Errorf("image name '%s' must not include a tag or digest", o.Name)
+	}
+	if o.Digest != "" && !strings.HasPrefix(o.Digest, "sha256:") {
+		return fmt.Errorf("digest '%s' of image '%s' must start with 'sha256:'", o.Digest, o.Name)
+	}
+	return nil
+}
+
+// rewrite returns the image a reference becomes with the override. A new tag
+// replaces the rendered digest, a digest replaces the tag.
+func (o imageOverride) rewrite(ref imageReference) imageReference {
+	if o.NewName != "" {
+		ref.Name = o.NewName
+	}
+	if o.NewTag != "" {
+		ref.Tag = o.NewTag
+		ref.Digest = ""
+	}
+	if o.Digest != "" {
+		ref.Tag = ""
+		ref.Digest = o.Digest
+	}
+	return ref
+}
+
+// mergeImageOverrides returns base with every override of the same name replaced by the later one
+func mergeImageOverrides(base []imageOverride, overrides ...[]imageOverride) []imageOverride {
+	merged := slices.Clone(base)
+	for _, list := range overrides {
+		for _, override := range list {
+			i := slices.IndexFunc(merged, func(other imageOverride) bool { return other.Name == override.Name })
+			if i < 0 {
+				merged = append(merged, override)
+				continue
+			}
+			merged[i] = override
+		}
+	}
+	return merged
+}
+
+// overrideImages rewrites the container and init container images of the
+// rendered workloads matching an override. With a resolver, every image of a
+// workload without a digest is pinned to the digest its tag points to.
+func overrideImages(ctx context.Context, manifests []renderedManifest, overrides []imageOverride, resolver *digestResolver) ([]renderedManifest, []imageResult, error) {
+	var results []imageResult
+	if len(overrides) == 0 && resolver == nil {
+		return manifests, results, nil
+	}
+
+	rewritten, err := rewriteObjects(manifests, func(manifest string, obj *unstructured.Unstructured) (bool, error) {
+		path, ok := lint.PodSpecPaths[obj.GetKind()]
+		if !ok {
+			return false, nil
+		}
+
+		changed := false
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, _, _ := unstructured.NestedFieldNoCopy(obj.Object, append(slices.Clone(path), field)...)
+			list, _ := containers.([]any)
+			for _, container := range list {
+				container, ok := container.(map[string]any)
+				if !ok {
+					continue
+				}
+				original, _ := container["image"].(string)
+				if original == "" {
+					continue
+				}
+
+				ref := parseImageReference(original)
+				if i := slices.IndexFunc(overrides, func(o imageOverride) bool { return o.Name == ref.Name }); i >= 0 {
+					ref = overrides[i].rewrite(ref)
+				}
+
+				resolved := ""
+				if resolver != nil && ref.Digest == "" {
+					digest, err := resolver.resolve(ctx, ref)
+					if err != nil {
+						return false, fmt.Errorf("could not resolve image '%s' of %s/%s in %s: %w", ref, obj.GetKind(), obj.GetName(), manifest, err)
+					}
+					ref.Digest = digest
+					resolved = digest
+				}
+
+				image := ref.String()
+				if image == original {
+					continue
+				}
+				container["image"] = image
+				changed = true
+
+				object := fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName())
+				i := slices.IndexFunc(results, func(r imageResult) bool { return r.Original == original && r.Image == image })
+				if i < 0 {
+					results = append(results, imageResult{Original: original, Image: image, Digest: resolved, Objects: []string{}})
+					i = len(results) - 1
+				}
+				if !slices.Contains(results[i].Objects, object) {
+					results[i].Objects = append(results[i].Objects, object)
+				}
+			}
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return rewritten, results, nil
+}
+
+// registryManifestTypes are the manifest media types a digest is resolved for,
+// multi-platform indexes first so the digest works on every node
+var registryManifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// digestResolver looks up the digest a tag points to with the registry HTTP
+// API, using anonymous pull tokens. Lookups are cached and safe for
+// concurrent use, since targets are generated in parallel.
+type digestResolver struct {
+	client *http.Client
+	mu     sync.Mutex
+	cache  map[string]string
+}
+
+func newDigestResolver(client *http.Client) *digestResolver {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &digestResolver{client: client, cache: make(map[string]string)}
+}
+
+// registryRepository returns the registry host and the repository path of an
+// image name, following the Docker Hub defaults for short names
+func registryRepository(name string) (string, string) {
+	host, repository, ok := strings.Cut(name, "/")
+	if !ok || !strings.ContainsAny(host, ".:") && host != "localhost" {
+		host, repository = "docker.io", name
+	}
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+		if !strings.Contains(repository, "/") {
+			repository = "library/" + repository
+		}
+	}
+	return host, repository
+}
+
+// resolve returns the digest of the manifest the tag of ref points to
+func (r *digestResolver) resolve(ctx context.Context, ref imageReference) (string, error) {
+	tag := ref.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	key := ref.Name + ":" + tag
+
+	r.mu.Lock()
+	digest, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok {
+		return digest, nil
+	}
+
+	host, repository := registryRepository(ref.Name)
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", host, repository, tag)
+
+	digest, err := r.fetchDigest(ctx, manifestURL)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	r.cache[key] = digest
+	r.mu.Unlock()
+	return digest, nil
+}
+
+// fetchDigest asks the registry for a manifest, authenticating once with an
+// anonymous token when the registry asks for one
+func (r *digestResolver) fetchDigest(ctx context.Context, manifestURL string) (string, error) {
+	token := ""
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, manifestURL, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Accept", strings.Join(registryManifestTypes, ", "))
+		req.Header.Set("User-Agent", "maniplacer/"+utils.Version)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		res, err := r.client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("registry request failed: %w", err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("could not read registry response: %w", err)
+		}
+
+		switch {
+		case res.StatusCode == http.StatusUnauthorized && token == "":
+			if token, err = r.fetchToken(ctx, res.Header.Get("WWW-Authenticate")); err != nil {
+				return "", err
+			}
+			continue
+		case res.StatusCode != http.StatusOK:
+			return "", fmt.Errorf("registry returned status %d", res.StatusCode)
+		}
+
+		if digest := res.Header.Get("Docker-Content-Digest"); digest != "" {
+			if !strings.HasPrefix(digest, "sha256:") {
+				return "", fmt.Errorf("registry returned unsupported digest '%s'", digest)
+			}
+			return digest, nil
+		}
+		// The digest of a manifest is the hash of its exact bytes
+		sum := sha256.Sum256(body)
+		return "sha256:" + hex.EncodeToString(sum[:]), nil
+	}
+
+	return "", fmt.Errorf("registry denied anonymous access")
+}
+
+// fetchToken gets an anonymous token from the realm of a 'Bearer' challenge
+func (r *digestResolver) fetchToken(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("registry requires '%s' authentication, only anonymous pulls are supported", scheme)
+	}
+
+	values := make(map[string]string)
+	for _, param := range strings.Split(params, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok {
+			values[key] = strings.Trim(value, `"`)
+		}
+	}
+	if values["realm"] == "" {
+		return "", fmt.Errorf("registry authentication challenge has no realm")
+	}
+
+	tokenURL, err := url.Parse(values["realm"])
+	if err != nil {
+		return "", fmt.Errorf("invalid registry token realm: %w", err)
+	}
+	query := tokenURL.Query()
+	for _, key := range []string{"service", "scope"} {
+		if values[key] != "" {
+			query.Set(key, values[key])
+		}
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("registry token request failed: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token endpoint returned status %d", res.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("could not decode registry token: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("registry token endpoint returned no token")
+	}
+	return token.Token, nil
+}
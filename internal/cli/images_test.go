@@ -0,0 +1,266 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		image string
+		want  imageReference
+	}{
+		{"nginx", imageReference{Name: "nginx"}},
+		{"nginx:1.27", imageReference{Name: "nginx", Tag: "1.27"}},
+		{"registry:5000/team/api", imageReference{Name: "registry:5000/team/api"}},
+		{"registry:5000/team/api:2.0", imageReference{Name: "registry:5000/team/api", Tag: "2.0"}},
+		{"ghcr.io/team/api:2.0@sha256:abc", imageReference{Name: "ghcr.io/team/api", Tag: "2.0", Digest: "sha256:abc"}},
+		{"ghcr.io/team/api@sha256:abc", imageReference{Name: "ghcr.io/team/api", Digest: "sha256:abc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got := parseImageReference(tt.image)
+			if got != tt.want {
+				t.Errorf("parseImageReference() = %+v, want %+v", got, tt.want)
+			}
+			if got.String() != tt.image {
+				t.Errorf("String() = %q, want %q", got.String(), tt.image)
+			}
+		})
+	}
+}
+
+func TestParseImageFlag(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    imageOverride
+		wantErr bool
+	}{
+		{value: "api=ghcr.io/team/api:2.0", want: imageOverride{Name: "api", NewName: "ghcr.io/team/api", NewTag: "2.0"}},
+		{value: "api=:2.0", want: imageOverride{Name: "api", NewTag: "2.0"}},
+		{value: "api=@sha256:abc", want: imageOverride{Name: "api", Digest: "sha256:abc"}},
+		{value: "api", wantErr: true},
+		{value: "api=", wantErr: true},
+		{value: "api:1.0=api:2.0", wantErr: true},
+		{value: "api=api@md5:abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseImageFlag(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImageFlag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseImageFlag() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+const imageTestManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: migrate
+          image: api:1.0
+      containers:
+        - name: api
+          image: api:1.0
+        - name: proxy
+          image: envoyproxy/envoy:v1.30
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: report
+              image: api:1.0@sha256:old
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: api
+data:
+  image: api:1.0
+`
+
+func TestOverrideImages(t *testing.T) {
+	// The flag replaces the settings override of the same name
+	overrides := mergeImageOverrides(
+		[]imageOverride{{Name: "api", NewName: "ghcr.io/team/api", NewTag: "1.1"}, {Name: "busybox", NewTag: "1.36"}},
+		[]imageOverride{{Name: "api", NewName: "ghcr.io/team/api", NewTag: "2.0"}},
+	)
+
+	manifests, results, err := overrideImages(context.Background(), []renderedManifest{{Name: "app.yaml", Content: []byte(imageTestManifests)}}, overrides, nil)
+	if err != nil {
+		t.Fatalf("overrideImages() error = %v", err)
+	}
+
+	docs, err := decodeDocuments(manifests[0].Content)
+	if err != nil {
+		t.Fatalf("decodeDocuments() error = %v", err)
+	}
+	deployment := docs[0]["spec"].(map[string]any)["template"].(map[string]any)["spec"].(map[string]any)
+	if image := deployment["initContainers"].([]any)[0].(map[string]any)["image"]; image != "ghcr.io/team/api:2.0" {
+		t.Errorf("init container image = %v", image)
+	}
+	if image := deployment["containers"].([]any)[1].(map[string]any)["image"]; image != "envoyproxy/envoy:v1.30" {
+		t.Errorf("unmatched image = %v, want it untouched", image)
+	}
+	if !strings.Contains(string(manifests[0].Content), "image: api:1.0\n") {
+		t.Errorf("ConfigMap data was rewritten:\n%s", manifests[0].Content)
+	}
+
+	want := []imageResult{
+		{Original: "api:1.0", Image: "ghcr.io/team/api:2.0", Objects: []string{"Deployment/api"}},
+		{Original: "api:1.0@sha256:old", Image: "ghcr.io/team/api:2.0", Objects: []string{"CronJob/report"}},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v, want %+v", results, want)
+	}
+	for i := range want {
+		if results[i].Original != want[i].Original || results[i].Image != want[i].Image || !slices.Equal(results[i].Objects, want[i].Objects) {
+			t.Errorf("results[%d] = %+v, want %+v", i, results[i], want[i])
+		}
+	}
+}
+
+// newTestRegistry serves the manifests of a registry requiring an anonymous
+// bearer token, counting the manifest requests
+func newTestRegistry(t *testing.T, digests map[string]string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") == "" {
+				http.Error(w, "missing scope", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token": "anonymous"}`)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer anonymous" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:team/api:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		requests.Add(1)
+		digest, ok := digests[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+		fmt.Fprint(w, `{}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestOverrideImagesResolvesDigests(t *testing.T) {
+	server, requests := newTestRegistry(t, map[string]string{
+		"/v2/team/api/manifests/2.0":    "sha256:1111",
+		"/v2/team/api/manifests/latest": "sha256:2222",
+	})
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	content := fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  template:
+    spec:
+      containers:
+        - name: api
+          image: api:1.0
+        - name: worker
+          image: %[1]s/team/api
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  template:
+    spec:
+      containers:
+        - name: db
+          image: %[1]s/team/db:16@sha256:pinned
+`, registry)
+
+	resolver := newDigestResolver(server.Client())
+	overrides := []imageOverride{{Name: "api", NewName: registry + "/team/api", NewTag: "2.0"}}
+	manifests, results, err := overrideImages(context.Background(), []renderedManifest{{Name: "app.yaml", Content: []byte(content)}}, overrides, resolver)
+	if err != nil {
+		t.Fatalf("overrideImages() error = %v", err)
+	}
+
+	for _, want := range []string{
+		registry + "/team/api:2.0@sha256:1111",
+		registry + "/team/api@sha256:2222",
+		registry + "/team/db:16@sha256:pinned",
+	} {
+		if !strings.Contains(string(manifests[0].Content), "image: "+want+"\n") {
+			t.Errorf("manifest is missing image %s:\n%s", want, manifests[0].Content)
+		}
+	}
+	if len(results) != 2 || results[0].Digest != "sha256:1111" || results[1].Digest != "sha256:2222" {
+		t.Errorf("results = %+v", results)
+	}
+
+	// Lookups are cached across manifests
+	if _, _, err := overrideImages(context.Background(), []renderedManifest{{Name: "app.yaml", Content: []byte(content)}}, overrides, resolver); err != nil {
+		t.Fatalf("overrideImages() error = %v", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("registry got %d manifest requests, want 2", got)
+	}
+
+	missing := fmt.Sprintf("kind: Pod\nmetadata:\n  name: debug\nspec:\n  containers:\n    - name: debug\n      image: %s/team/missing:1.0\n", registry)
+	if _, _, err := overrideImages(context.Background(), []renderedManifest{{Name: "pod.yaml", Content: []byte(missing)}}, nil, resolver); err == nil {
+		t.Error("overrideImages() expected an error for an unknown tag")
+	}
+}
+
+func TestRegistryRepository(t *testing.T) {
+	tests := []struct {
+		name, host, repository string
+	}{
+		{"nginx", "registry-1.docker.io", "library/nginx"},
+		{"bitnami/redis", "registry-1.docker.io", "bitnami/redis"},
+		{"docker.io/nginx", "registry-1.docker.io", "library/nginx"},
+		{"ghcr.io/team/api", "ghcr.io", "team/api"},
+		{"localhost/api", "localhost", "api"},
+		{"registry:5000/api", "registry:5000", "api"},
+	}
+	for _, tt := range tests {
+		host, repository := registryRepository(tt.name)
+		if host != tt.host || repository != tt.repository {
+			t.Errorf("registryRepository(%q) = %s, %s, want %s, %s", tt.name, host, repository, tt.host, tt.repository)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dantedelordran/maniplacer/internal/templates"
+	"github.com/dantedelordran/maniplacer/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// importExtensions are the file extensions read when importing a directory
+var importExtensions = []string{".yaml", ".yml", ".json"}
+
+var importCmd = &cobra.Command{
+	Use:   "import [file-or-dir]",
+	Short: "Imports existing Kubernetes manifests or live objects as templates of a repo",
+	Long: `The import command turns existing Kubernetes manifests into Maniplacer templates, so adopting Maniplacer for a running service does not mean rewriting its manifests by hand.
+
+It reads a YAML (or JSON) file, or every .yaml, .yml and .json file found under a directory (hidden files and directories are skipped), splits multi-document files and 'kind: List' documents into one template per object, and writes them to 'templates/<namespace>/' of the repo, named '<kind>-<name>.yaml'.
+
+With --extract, values that usually change between environments are lifted out of the manifests into the repo config, and replaced by the matching template expressions:
+  namespace   → metadata.namespace                     ('{{ .namespace }}')
+  image       → container images                       ('{{ .image }}', or per container like '{{ .workerImage }}')
+  replicas    → replicas of Deployments and StatefulSets ('{{ .replicas }}', or per object like '{{ .apiReplicas }}')
+  labels      → labels, selectors and pod template labels ('{{ index .labels "app.kubernetes.io/name" }}')
+A value shared by every imported object is stored under a single key, differing values get more specific keys and labels with differing values are left as they are.
+The values are seeded into the repo config (config.json is created when the repo has none), keys already present in the config are kept.
+
+With --from-cluster, the objects are read from the namespace given with --namespace (or -n) of the current
+kubeconfig cluster instead of files, optionally filtered with a label --selector (or -l). Fields set by the API server
+(status, managedFields, uid, resourceVersion, creationTimestamp, generation, allocated cluster IPs and node ports,
+the bound volume of claims, kubectl, rollout and volume binding annotations) are stripped. Headless Services keep
+'clusterIP: None'. Objects owned by another object, like the Jobs of a CronJob, are skipped, and so are the 'default'
+ServiceAccount and the 'kube-root-ca.crt' ConfigMap Kubernetes creates in every namespace.
+By default every supported resource type but secrets is read, use --resources to choose them:
+  serviceaccounts, configmaps, secrets, persistentvolumeclaims, roles, rolebindings, deployments, statefulsets,
+  daemonsets, jobs, cronjobs, services, ingresses, networkpolicies, horizontalpodautoscalers, poddisruptionbudgets
+
+To migrate a Helm chart instead, use 'maniplacer import helm <chart-dir>'.
+
+If a template already exists, you will be prompted to confirm before overwriting it.
+
+Example usage:
+  maniplacer import k8s/api.yaml -r myrepo -n production
+  maniplacer import k8s/ -r myrepo -n production --extract
+  maniplacer import --from-cluster --selector app=api -r myrepo -n production --extract
+  maniplacer import --from-cluster --resources deployments,services -r myrepo -n production
+
+Notes:
+  - Literal '{{' in the imported manifests is escaped, imported templates render back to the original objects
+  - Fields set by the API server (status, uid, resourceVersion...) are only stripped with --from-cluster,
+    files are imported as they are`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := utils.LoggerFromContext(cmd.Context())
+
+		if !utils.IsValidProject() {
+			return fmt.Errorf("current directory is not a valid Maniplacer project")
+		}
+
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			logger.Debug("could not get namespace flag, using default", "error", err)
+			namespace = utils.DefaultNamespace
+		}
+		if err := utils.ValidateNamespace(namespace); err != nil {
+			return fmt.Errorf("invalid namespace: %w", err)
+		}
+
+		repo, err := cmd.Flags().GetString("repo")
+		if err != nil {
+			return fmt.Errorf("could not get repo flag: %w", err)
+		}
+		if repo == "" {
+			return fmt.Errorf("repository name is required (use --repo flag)")
+		}
+		if err := utils.ValidateRepoName(repo); err != nil {
+			return fmt.Errorf("invalid repository name: %w", err)
+		}
+		if err := utils.ValidateSafePath(repo); err != nil {
+			return err
+		}
+
+		extract, err := cmd.Flags().GetBool("extract")
+		if err != nil {
+			logger.Debug("could not get extract flag, using false", "error", err)
+			extract = false
+		}
+
+		current, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("could not get current directory: %w", err)
+		}
+
+		repoPath := filepath.Join(current, repo)
+		if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+			return fmt.Errorf("repository '%s' does not exist", repo)
+		}
+
+		fromCluster, err := cmd.Flags().GetBool("from-cluster")
+		if err != nil {
+			logger.Debug("could not get from-cluster flag, using false", "error", err)
+			fromCluster = false
+		}
+
+		var sources []templates.ImportSource
+		var origin string
+		if fromCluster {
+			if len(args) > 0 {
+				return fmt.Errorf("a file or directory cannot be imported together with --from-cluster")
+			}
+
+			selector, err := cmd.Flags().GetString("selector")
+			if err != nil {
+				return fmt.Errorf("could not get selector flag: %w", err)
+			}
+
+			resourceNames, err := cmd.Flags().GetStringSlice("resources")
+			if err != nil || len(resourceNames) == 0 {
+				resourceNames = defaultClusterResources()
+			}
+			resources, err := selectClusterResources(resourceNames)
+			if err != nil {
+				return err
+			}
+
+			if err := initKubeClients(); err != nil {
+				return fmt.Errorf("could not initialize Kubernetes client: %w", err)
+			}
+
+			origin = fmt.Sprintf("namespace '%s' of the cluster", namespace)
+			if sources, err = fetchClusterObjects(cmd.Context(), dynamicClient, namespace, selector, resources); err != nil {
+				return err
+			}
+			logger.Info("importing cluster objects", "namespace", namespace, "selector", selector, "objects", len(sources), "extract", extract)
+		} else {
+			if len(args) == 0 {
+				return fmt.Errorf("a file or directory to import is required (or use --from-cluster)")
+			}
+
+			origin = fmt.Sprintf("'%s'", args[0])
+			if sources, err = readImportSources(args[0]); err != nil {
+				return err
+			}
+			logger.Info("importing manifests", "path", args[0], "files", len(sources), "extract", extract)
+		}
+
+		result, err := templates.ImportManifests(sources, extract)
+		if err != nil {
+			return fmt.Errorf("could not import manifests: %w", err)
+		}
+		if len(result.Templates) == 0 {
+			return fmt.Errorf("no Kubernetes objects found in %s", origin)
+		}
+
+		templateDir := filepath.Join(repoPath, "templates", namespace)
+		written, err := writeImportedTemplates(os.Stdout, templateDir, result.Templates)
+		if err != nil {
+			return err
+		}
+
+		if extract && len(result.Values) > 0 {
+			if err := seedRepoConfig(os.Stdout, current, repo, result.Values); err != nil {
+				return err
+			}
+		}
+
+		logger.Info("manifests imported", "objects", len(result.Templates), "written", written, "namespace", namespace)
+		fmt.Printf("Imported %d objects into %s namespace!\n", written, namespace)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringP("namespace", "n", utils.DefaultNamespace, "Namespace to import the templates into")
+	importCmd.Flags().StringP("repo", "r", "", "Repo name")
+	importCmd.Flags().Bool("extract", false, "Lift the namespace, images, replicas and labels into the repo config")
+	importCmd.Flags().Bool("from-cluster", false, "Import the live objects of the namespace instead of files")
+	importCmd.Flags().StringP("selector", "l", "", "Label selector filtering the objects imported with --from-cluster (e.g. app=api)")
+	importCmd.Flags().StringSlice("resources", nil, "Resource types imported with --from-cluster (default: every supported type but secrets)")
+}
+
+// readImportSources reads a manifest file, or every manifest file under a directory
+func readImportSources(path string) ([]templates.ImportSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read '%s': %w", path, err)
+	}
+
+	var paths []string
+	if info.IsDir() {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			hidden := p != path && strings.HasPrefix(d.Name(), ".")
+			if d.IsDir() {
+				if hidden {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !hidden && slices.Contains(importExtensions, strings.ToLower(filepath.Ext(p))) {
+				paths = append(paths, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not read directory '%s': %w", path, err)
+		}
+	} else {
+		paths = append(paths, path)
+	}
+
+	sources := make([]templates.ImportSource, 0, len(paths))
+	for _, p := range paths {
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("could not read '%s': %w", p, err)
+		}
+		sources = append(sources, templates.ImportSource{Path: p, Content: content})
+	}
+
+	return sources, nil
+}
+
+// writeImportedTemplates writes imported templates to templateDir, asking
+// before replacing existing ones, and returns how many were written
+func writeImportedTemplates(out io.Writer, templateDir string, imported []templates.ImportedTemplate) (int, error) {
+	if err := os.MkdirAll(templateDir, utils.DirPermission); err != nil {
+		return 0, fmt.Errorf("could not create templates namespace directory: %w", err)
+	}
+
+	written := 0
+	for _, tmpl := range imported {
+		outputPath := filepath.Join(templateDir, tmpl.FileName)
+
+		if _, err := os.Stat(outputPath); err == nil {
+			if !utils.ConfirmMessage(fmt.Sprintf("%s already exists, do you want to replace it?", tmpl.FileName)) {
+				fmt.Fprintf(out, "Skipping %s...\n", tmpl.FileName)
+				continue
+			}
+		} else if !os.IsNotExist(err) {
+			return written, fmt.Errorf("error checking file %s: %w", outputPath, err)
+		}
+
+		if err := os.WriteFile(outputPath, tmpl.Content, utils.FilePermission); err != nil {
+			return written, fmt.Errorf("failed to write file: %w", err)
+		}
+		if tmpl.Kind != "" {
+			fmt.Fprintf(out, "%s/%s → %s\n", tmpl.Kind, tmpl.Name, tmpl.FileName)
+		} else {
+			fmt.Fprintf(out, "%s → %s\n", tmpl.Source, tmpl.FileName)
+		}
+		written++
+	}
+
+	return written, nil
+}
@@ -0,0 +1,225 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/dantedelordran/maniplacer/internal/lint"
+	"github.com/dantedelordran/maniplacer/internal/templates"
+	"gopkg.in/yaml.v3"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// clusterResource is a resource type import --from-cluster can read
+type clusterResource struct {
+	GVR  schema.GroupVersionResource
+	Kind string
+}
+
+// clusterImportResources are the resource types read by import --from-cluster,
+// in the order their objects are imported
+var clusterImportResources = []clusterResource{
+	{schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}, "ServiceAccount"},
+	{schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "ConfigMap"},
+	{schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, "Secret"},
+	{schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}, "PersistentVolumeClaim"},
+	{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"}, "Role"},
+	{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}, "RoleBinding"},
+	{schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, "Deployment"},
+	{schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}, "StatefulSet"},
+	{schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}, "DaemonSet"},
+	{schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}, "Job"},
+	{schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"}, "CronJob"},
+	{schema.GroupVersionResource{Version: "v1", Resource: "services"}, "Service"},
+	{schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}, "Ingress"},
+	{schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}, "NetworkPolicy"},
+	{schema.GroupVersionResource{Group: "autoscaling", Version: "v2", Resource: "horizontalpodautoscalers"}, "HorizontalPodAutoscaler"},
+	{schema.GroupVersionResource{Group: "policy", Version: "v1", Resource: "poddisruptionbudgets"}, "PodDisruptionBudget"},
+}
+
+// defaultClusterResources are read when --resources is not given. Secrets are
+// left out so their values do not end up in plain text templates by accident.
+func defaultClusterResources() []string {
+	var names []string
+	for _, resource := range clusterImportResources {
+		if resource.GVR.Resource != "secrets" {
+			names = append(names, resource.GVR.Resource)
+		}
+	}
+	return names
+}
+
+// selectClusterResources resolves resource names, as given to --resources, to resource types
+func selectClusterResources(names []string) ([]clusterResource, error) {
+	var selected []clusterResource
+	for _, resource := range clusterImportResources {
+		if slices.Contains(names, resource.GVR.Resource) {
+			selected = append(selected, resource)
+		}
+	}
+
+	for _, name := range names {
+		if !slices.ContainsFunc(clusterImportResources, func(resource clusterResource) bool { return resource.GVR.Resource == name }) {
+			return nil, fmt.Errorf("unsupported resource '%s' (supported: %s)", name, strings.Join(clusterResourceNames(), ", "))
+		}
+	}
+
+	return selected, nil
+}
+
+func clusterResourceNames() []string {
+	names := make([]string, 0, len(clusterImportResources))
+	for _, resource := range clusterImportResources {
+		names = append(names, resource.GVR.Resource)
+	}
+	return names
+}
+
+// serverManagedAnnotations are set by the API server or kubectl and never belong in a template
+var serverManagedAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"deployment.kubernetes.io/revision",
+	"volume.beta.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/selected-node",
+}
+
+// serverManagedAnnotationPrefix marks the annotations the volume binder sets on claims
+const serverManagedAnnotationPrefix = "pv.kubernetes.io/"
+
+// restartedAtAnnotation is set on pod templates by 'kubectl rollout restart'
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// defaultClusterObjects are created in every namespace by Kubernetes itself,
+// by kind and name
+var defaultClusterObjects = map[string]string{
+	"ServiceAccount": "default",
+	"ConfigMap":      "kube-root-ca.crt",
+}
+
+// stripServerFields removes the fields the API server sets on live objects
+func stripServerFields(obj *unstructured.Unstructured) {
+	unstructured.RemoveNestedField(obj.Object, "status")
+	for _, field := range []string{"managedFields", "uid", "resourceVersion", "creationTimestamp", "generation", "selfLink"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+
+	annotations := obj.GetAnnotations()
+	for annotation := range annotations {
+		if slices.Contains(serverManagedAnnotations, annotation) || strings.HasPrefix(annotation, serverManagedAnnotationPrefix) {
+			delete(annotations, annotation)
+		}
+	}
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "metadata", "annotations")
+	} else {
+		obj.SetAnnotations(annotations)
+	}
+
+	// Templates carry a 'creationTimestamp: null' of their own
+	for _, path := range lint.PodTemplatePaths(obj.GetKind()) {
+		removeAnnotation(obj.Object, restartedAtAnnotation, path...)
+		unstructured.RemoveNestedField(obj.Object, append(slices.Clone(path), "creationTimestamp")...)
+		if metadata, found, _ := unstructured.NestedMap(obj.Object, path...); found && len(metadata) == 0 {
+			unstructured.RemoveNestedField(obj.Object, path...)
+		}
+	}
+
+	switch obj.GetKind() {
+	case "Service":
+		stripServiceAllocations(obj.Object)
+	case "PersistentVolumeClaim":
+		// The volume is picked by the binder, or provisioned for the claim
+		unstructured.RemoveNestedField(obj.Object, "spec", "volumeName")
+	}
+}
+
+// stripServiceAllocations removes the cluster IPs and node ports the API
+// server allocated. Headless Services keep 'clusterIP: None'.
+func stripServiceAllocations(object map[string]any) {
+	if clusterIP, _, _ := unstructured.NestedString(object, "spec", "clusterIP"); clusterIP != "None" {
+		unstructured.RemoveNestedField(object, "spec", "clusterIP")
+	}
+	unstructured.RemoveNestedField(object, "spec", "clusterIPs")
+
+	unstructured.RemoveNestedField(object, "spec", "healthCheckNodePort")
+	ports, _, _ := unstructured.NestedSlice(object, "spec", "ports")
+	for _, port := range ports {
+		if port, ok := port.(map[string]any); ok {
+			delete(port, "nodePort")
+		}
+	}
+	if ports != nil {
+		_ = unstructured.SetNestedSlice(object, ports, "spec", "ports")
+	}
+}
+
+// removeAnnotation deletes an annotation of the metadata at path, and the
+// annotations map when it ends up empty
+func removeAnnotation(object map[string]any, annotation string, path ...string) {
+	annotationsPath := append(slices.Clone(path), "annotations")
+	annotations, found, _ := unstructured.NestedMap(object, annotationsPath...)
+	if !found {
+		return
+	}
+	if _, ok := annotations[annotation]; !ok {
+		return
+	}
+
+	delete(annotations, annotation)
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(object, annotationsPath...)
+		return
+	}
+	_ = unstructured.SetNestedMap(object, annotations, annotationsPath...)
+}
+
+// fetchClusterObjects reads the objects of a namespace matching selector and
+// returns them, stripped of server-managed fields, as import sources. Objects
+// owned by another object, like the Jobs of a CronJob, are skipped since
+// their owner creates them, and so are the objects Kubernetes creates in
+// every namespace.
+func fetchClusterObjects(ctx context.Context, client dynamic.Interface, namespace, selector string, resources []clusterResource) ([]templates.ImportSource, error) {
+	var sources []templates.ImportSource
+
+	for _, resource := range resources {
+		list, err := client.Resource(resource.GVR).Namespace(namespace).List(ctx, v1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("could not list %s: %w", resource.GVR.Resource, err)
+		}
+
+		items := list.Items
+		slices.SortFunc(items, func(a, b unstructured.Unstructured) int {
+			return strings.Compare(a.GetName(), b.GetName())
+		})
+
+		for _, item := range items {
+			if len(item.GetOwnerReferences()) > 0 || defaultClusterObjects[resource.Kind] == item.GetName() {
+				continue
+			}
+
+			obj := item.DeepCopy()
+			if obj.GetKind() == "" {
+				obj.SetGroupVersionKind(resource.GVR.GroupVersion().WithKind(resource.Kind))
+			}
+			stripServerFields(obj)
+
+			content, err := yaml.Marshal(obj.Object)
+			if err != nil {
+				return nil, fmt.Errorf("could not encode %s/%s: %w", resource.Kind, obj.GetName(), err)
+			}
+
+			sources = append(sources, templates.ImportSource{
+				Path:    fmt.Sprintf("%s/%s", resource.GVR.Resource, obj.GetName()),
+				Content: content,
+			})
+		}
+	}
+
+	return sources, nil
+}
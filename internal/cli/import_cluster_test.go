@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dantedelordran/maniplacer/internal/templates"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func newClusterObject(apiVersion, kind, namespace, name string, labels map[string]any, extra map[string]any) *unstructured.Unstructured {
+	metadata := map[string]any{
+		"name":              name,
+		"namespace":         namespace,
+		"uid":               "8b6f1c1e-0000-0000-0000-000000000000",
+		"resourceVersion":   "12345",
+		"creationTimestamp": "2024-01-01T00:00:00Z",
+		"generation":        int64(4),
+		"managedFields":     []any{map[string]any{"manager": "kubectl"}},
+		"annotations": map[string]any{
+			"kubectl.kubernetes.io/last-applied-configuration": "{}",
+		},
+	}
+	if labels != nil {
+		metadata["labels"] = labels
+	}
+
+	obj := map[string]any{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   metadata,
+		"status":     map[string]any{"observedGeneration": int64(4)},
+	}
+	for key, value := range extra {
+		obj[key] = value
+	}
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func newFakeClusterClient(objects ...runtime.Object) *fake.FakeDynamicClient {
+	listKinds := make(map[schema.GroupVersionResource]string)
+	for _, resource := range clusterImportResources {
+		listKinds[resource.GVR] = resource.Kind + "List"
+	}
+	return fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+}
+
+func TestFetchClusterObjects(t *testing.T) {
+	deployment := newClusterObject("apps/v1", "Deployment", "shop", "api", map[string]any{"app": "api"}, map[string]any{
+		"spec": map[string]any{
+			"replicas": int64(2),
+			"template": map[string]any{
+				"spec": map[string]any{
+					"containers": []any{map[string]any{"name": "api", "image": "repo/api:1.0"}},
+				},
+			},
+		},
+	})
+	service := newClusterObject("v1", "Service", "shop", "api", map[string]any{"app": "api"}, map[string]any{
+		"spec": map[string]any{
+			"clusterIP":  "10.0.0.1",
+			"clusterIPs": []any{"10.0.0.1"},
+			"selector":   map[string]any{"app": "api"},
+		},
+	})
+	secret := newClusterObject("v1", "Secret", "shop", "api", map[string]any{"app": "api"}, nil)
+	other := newClusterObject("v1", "ConfigMap", "shop", "web", map[string]any{"app": "web"}, nil)
+	otherNamespace := newClusterObject("v1", "ConfigMap", "staging", "api", map[string]any{"app": "api"}, nil)
+	owned := newClusterObject("batch/v1", "Job", "shop", "api-28000000", map[string]any{"app": "api"}, nil)
+	owned.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "CronJob", Name: "api", UID: "1"}})
+
+	client := newFakeClusterClient(deployment, service, secret, other, otherNamespace, owned)
+
+	resources, err := selectClusterResources(defaultClusterResources())
+	if err != nil {
+		t.Fatalf("selectClusterResources() error = %v", err)
+	}
+
+	sources, err := fetchClusterObjects(context.Background(), client, "shop", "app=api", resources)
+	if err != nil {
+		t.Fatalf("fetchClusterObjects() error = %v", err)
+	}
+
+	var paths []string
+	for _, source := range sources {
+		paths = append(paths, source.Path)
+	}
+	if strings.Join(paths, ",") != "deployments/api,services/api" {
+		t.Fatalf("imported %v, want the api deployment and service only", paths)
+	}
+
+	for _, source := range sources {
+		content := string(source.Content)
+		for _, field := range []string{"status:", "managedFields", "uid:", "resourceVersion", "creationTimestamp", "generation", "last-applied-configuration", "clusterIP"} {
+			if strings.Contains(content, field) {
+				t.Errorf("%s still contains %s:\n%s", source.Path, field, content)
+			}
+		}
+	}
+
+	result, err := templates.ImportManifests(sources, true)
+	if err != nil {
+		t.Fatalf("ImportManifests() error = %v", err)
+	}
+	if len(result.Templates) != 2 || result.Values["image"] != "repo/api:1.0" || result.Values["namespace"] != "shop" {
+		t.Errorf("imported %d templates with values %v", len(result.Templates), result.Values)
+	}
+}
+
+func TestSelectClusterResources(t *testing.T) {
+	resources, err := selectClusterResources([]string{"services", "deployments"})
+	if err != nil {
+		t.Fatalf("selectClusterResources() error = %v", err)
+	}
+	// Resources keep the import order, deployments before services
+	if len(resources) != 2 || resources[0].Kind != "Deployment" || resources[1].Kind != "Service" {
+		t.Errorf("selectClusterResources() = %v", resources)
+	}
+
+	if _, err := selectClusterResources([]string{"pods"}); err == nil {
+		t.Error("selectClusterResources() expected error for an unsupported resource")
+	}
+
+	if defaults := defaultClusterResources(); strings.Contains(strings.Join(defaults, ","), "secrets") {
+		t.Errorf("default resources %v include secrets", defaults)
+	}
+}
+
+func TestFetchClusterObjects_SkipsDefaultObjects(t *testing.T) {
+	client := newFakeClusterClient(
+		newClusterObject("v1", "ServiceAccount", "shop", "default", nil, nil),
+		newClusterObject("v1", "ServiceAccount", "shop", "api", nil, nil),
+		newClusterObject("v1", "ConfigMap", "shop", "kube-root-ca.crt", nil, map[string]any{"data": map[string]any{"ca.crt": "cert"}}),
+		newClusterObject("v1", "ConfigMap", "shop", "default", nil, nil),
+	)
+
+	resources, err := selectClusterResources(defaultClusterResources())
+	if err != nil {
+		t.Fatalf("selectClusterResources() error = %v", err)
+	}
+
+	// Without a selector every object of the namespace is read
+	sources, err := fetchClusterObjects(context.Background(), client, "shop", "", resources)
+	if err != nil {
+		t.Fatalf("fetchClusterObjects() error = %v", err)
+	}
+
+	var paths []string
+	for _, source := range sources {
+		paths = append(paths, source.Path)
+	}
+	if strings.Join(paths, ",") != "serviceaccounts/api,configmaps/default" {
+		t.Errorf("imported %v, want the objects Kubernetes creates skipped", paths)
+	}
+}
+
+func TestStripServerFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		obj     *unstructured.Unstructured
+		removed [][]string
+		kept    map[string][]string
+	}{
+		{
+			name: "allocated service",
+			obj: newClusterObject("v1", "Service", "shop", "api", nil, map[string]any{"spec": map[string]any{
+				"type":                "LoadBalancer",
+				"clusterIP":           "10.0.0.1",
+				"clusterIPs":          []any{"10.0.0.1"},
+				"healthCheckNodePort": int64(32000),
+				"ports":               []any{map[string]any{"port": int64(80), "nodePort": int64(31000)}},
+			}}),
+			removed: [][]string{{"spec", "clusterIP"}, {"spec", "clusterIPs"}, {"spec", "healthCheckNodePort"}},
+		},
+		{
+			name: "headless service",
+			obj: newClusterObject("v1", "Service", "shop", "db", nil, map[string]any{"spec": map[string]any{
+				"clusterIP":  "None",
+				"clusterIPs": []any{"None"},
+			}}),
+			removed: [][]string{{"spec", "clusterIPs"}},
+			kept:    map[string][]string{"None": {"spec", "clusterIP"}},
+		},
+		{
+			name: "bound claim",
+			obj: func() *unstructured.Unstructured {
+				claim := newClusterObject("v1", "PersistentVolumeClaim", "shop", "data", nil, map[string]any{"spec": map[string]any{
+					"volumeName":       "pvc-1234",
+					"storageClassName": "standard",
+				}})
+				claim.SetAnnotations(map[string]string{
+					"pv.kubernetes.io/bind-completed":                  "yes",
+					"pv.kubernetes.io/bound-by-controller":             "yes",
+					"volume.kubernetes.io/storage-provisioner":         "pd.csi.storage.gke.io",
+					"backup.example.com/schedule":                      "daily",
+					"kubectl.kubernetes.io/last-applied-configuration": "{}",
+				})
+				return claim
+			}(),
+			removed: [][]string{{"spec", "volumeName"}},
+			kept:    map[string][]string{"standard": {"spec", "storageClassName"}, "daily": {"metadata", "annotations", "backup.example.com/schedule"}},
+		},
+		{
+			name: "restarted deployment",
+			obj: newClusterObject("apps/v1", "Deployment", "shop", "api", nil, map[string]any{"spec": map[string]any{
+				"template": map[string]any{
+					"metadata": map[string]any{
+						"creationTimestamp": nil,
+						"annotations":       map[string]any{"kubectl.kubernetes.io/restartedAt": "2024-01-01T00:00:00Z"},
+						"labels":            map[string]any{"app": "api"},
+					},
+				},
+			}}),
+			removed: [][]string{{"spec", "template", "metadata", "annotations"}, {"spec", "template", "metadata", "creationTimestamp"}},
+		},
+		{
+			name: "cronjob templates",
+			obj: newClusterObject("batch/v1", "CronJob", "shop", "report", nil, map[string]any{"spec": map[string]any{
+				"jobTemplate": map[string]any{
+					"metadata": map[string]any{"creationTimestamp": nil},
+					"spec": map[string]any{"template": map[string]any{
+						"metadata": map[string]any{"creationTimestamp": nil, "labels": map[string]any{"app": "report"}},
+					}},
+				},
+			}}),
+			removed: [][]string{{"spec", "jobTemplate", "metadata"}, {"spec", "jobTemplate", "spec", "template", "metadata", "creationTimestamp"}},
+			kept:    map[string][]string{"report": {"spec", "jobTemplate", "spec", "template", "metadata", "labels", "app"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stripServerFields(tt.obj)
+
+			for _, path := range tt.removed {
+				if _, found, _ := unstructured.NestedFieldNoCopy(tt.obj.Object, path...); found {
+					t.Errorf("%s was not stripped", strings.Join(path, "."))
+				}
+			}
+			for want, path := range tt.kept {
+				if got, _, _ := unstructured.NestedString(tt.obj.Object, path...); got != want {
+					t.Errorf("%s = %q, want %q", strings.Join(path, "."), got, want)
+				}
+			}
+
+			ports, _, _ := unstructured.NestedSlice(tt.obj.Object, "spec", "ports")
+			for _, port := range ports {
+				if _, ok := port.(map[string]any)["nodePort"]; ok {
+					t.Errorf("nodePort was not stripped from %v", port)
+				}
+			}
+			if annotations := tt.obj.GetAnnotations(); len(annotations) > 1 {
+				t.Errorf("server-managed annotations left: %v", annotations)
+			}
+		})
+	}
+}
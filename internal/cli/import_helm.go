@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dantedelordran/maniplacer/internal/templates"
+	"github.com/dantedelordran/maniplacer/internal/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// helmHookAnnotation marks the templates Helm runs as hooks instead of installing them with the release
+const helmHookAnnotation = "helm.sh/hook"
+
+var importHelmCmd = &cobra.Command{
+	Use:   "helm <chart-dir>",
+	Short: "Imports a Helm chart as templates and config of a repo",
+	Long: `The helm command migrates a Helm chart directory into a repo: its templates are translated and copied to 'templates/<namespace>/' and its values.yaml becomes the repo config.
+
+Templates are translated without touching anything outside template actions, the reverse of 'export helm':
+  - '.Values' references point at the config ('{{ .Values.image }}' becomes '{{ .image }}', '$.Values.x' becomes '$.x')
+  - Sprig functions with a Maniplacer equivalent are renamed: b64enc → Base64, upper → ToUpper, lower → ToLower, quote → Quote
+  - '{{ include "name" . }}' actions become '{{ template "name" . }}'
+  - '_helpers.tpl' and any other '_' prefixed file is kept as a partial: its 'define' blocks are available to every
+    template of the namespace and it is not rendered itself
+
+The config is written as 'config.<format>' (json unless --format is given). Existing config files of the repo are replaced
+after confirmation when they hold any value.
+
+Helm features Maniplacer cannot render are listed once the chart is imported:
+  - built-in objects such as .Release, .Chart, .Capabilities and .Files, and Sprig functions without a Maniplacer equivalent
+  - hooks ('helm.sh/hook' annotations), imported as regular manifests
+  - subcharts (Chart.yaml dependencies, charts/), CRDs (crds/) and template subdirectories such as templates/tests/, not imported
+  - templates that do not parse and NOTES.txt, not imported
+
+If a template already exists, you will be prompted to confirm before overwriting it.
+
+Example usage:
+  maniplacer import helm ./charts/api -r myrepo -n production
+  maniplacer import helm ./charts/api -r myrepo -n production --format yaml
+
+Notes:
+  - Maniplacer functions only take strings, '{{ .port | Quote }}' fails for a number where Sprig's quote did not
+  - A chart directory named 'helm' has to be given as './helm'`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := utils.LoggerFromContext(cmd.Context())
+
+		if !utils.IsValidProject() {
+			return fmt.Errorf("current directory is not a valid Maniplacer project")
+		}
+
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			logger.Debug("could not get namespace flag, using default", "error", err)
+			namespace = utils.DefaultNamespace
+		}
+		if err := utils.ValidateNamespace(namespace); err != nil {
+			return fmt.Errorf("invalid namespace: %w", err)
+		}
+
+		repo, err := cmd.Flags().GetString("repo")
+		if err != nil {
+			return fmt.Errorf("could not get repo flag: %w", err)
+		}
+		if repo == "" {
+			return fmt.Errorf("repository name is required (use --repo flag)")
+		}
+		if err := utils.ValidateRepoName(repo); err != nil {
+			return fmt.Errorf("invalid repository name: %w", err)
+		}
+		if err := utils.ValidateSafePath(repo); err != nil {
+			return err
+		}
+
+		formatFlag, err := cmd.Flags().GetString("format")
+		if err != nil {
+			logger.Debug("could not get format flag, using json", "error", err)
+			formatFlag = string(FormatJSON)
+		}
+		format := ConfigFormat(strings.ToLower(formatFlag))
+		if !slices.Contains([]ConfigFormat{FormatJSON, FormatYAML, FormatYML}, format) {
+			return fmt.Errorf("unsupported config format '%s' (use json, yaml or yml)", formatFlag)
+		}
+
+		current, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("could not get current directory: %w", err)
+		}
+
+		repoPath := filepath.Join(current, repo)
+		if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+			return fmt.Errorf("repository '%s' does not exist", repo)
+		}
+
+		chart, err := readHelmChart(args[0])
+		if err != nil {
+			return err
+		}
+		logger.Info("importing helm chart", "chart", chart.Meta.Name, "version", chart.Meta.Version, "templates", len(chart.Templates))
+		fmt.Printf("Importing chart %s %s\n", chart.Meta.Name, chart.Meta.Version)
+
+		templateDir := filepath.Join(repoPath, "templates", namespace)
+		written, err := writeImportedTemplates(os.Stdout, templateDir, chart.Templates)
+		if err != nil {
+			return err
+		}
+
+		if err := writeChartValues(os.Stdout, repoPath, format, chart.Values); err != nil {
+			return err
+		}
+
+		logger.Info("helm chart imported", "templates", len(chart.Templates), "written", written, "namespace", namespace, "issues", len(chart.Issues))
+		fmt.Printf("Imported %d templates into %s namespace!\n", written, namespace)
+		printHelmIssues(os.Stdout, chart.Issues)
+		return nil
+	},
+}
+
+func init() {
+	importCmd.AddCommand(importHelmCmd)
+	importHelmCmd.Flags().StringP("namespace", "n", utils.DefaultNamespace, "Namespace to import the templates into")
+	importHelmCmd.Flags().StringP("repo", "r", "", "Repo name")
+	importHelmCmd.Flags().StringP("format", "f", string(FormatJSON), "Format of the config written from values.yaml (json, yaml, yml)")
+}
+
+// helmChartImport is a chart read by import helm
+type helmChartImport struct {
+	Meta      helmChartMeta
+	Values    map[string]any
+	Templates []templates.ImportedTemplate
+	Issues    []string
+}
+
+// readHelmChart reads a chart directory and translates its templates,
+// collecting the Helm features that are not imported or cannot be rendered
+func readHelmChart(dir string) (*helmChartImport, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a Helm chart: %w", dir, err)
+	}
+
+	chart := &helmChartImport{Values: make(map[string]any)}
+	if err := yaml.Unmarshal(content, &chart.Meta); err != nil {
+		return nil, fmt.Errorf("could not parse Chart.yaml: %w", err)
+	}
+
+	values, err := os.ReadFile(filepath.Join(dir, "values.yaml"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read values.yaml: %w", err)
+	}
+	if err := yaml.Unmarshal(values, &chart.Values); err != nil {
+		return nil, fmt.Errorf("could not parse values.yaml: %w", err)
+	}
+	if chart.Values == nil {
+		chart.Values = make(map[string]any)
+	}
+
+	if len(chart.Meta.Dependencies) > 0 {
+		var names []string
+		for _, dependency := range chart.Meta.Dependencies {
+			names = append(names, dependency.Name)
+		}
+		chart.Issues = append(chart.Issues, fmt.Sprintf("Chart.yaml: subcharts %s are not imported", strings.Join(names, ", ")))
+	}
+	for _, notImported := range []struct{ path, issue string }{
+		{"requirements.yaml", "subcharts are not imported"},
+		{"charts", "subcharts are not imported"},
+		{"crds", "CRDs are not imported"},
+	} {
+		if _, err := os.Stat(filepath.Join(dir, notImported.path)); err == nil {
+			chart.Issues = append(chart.Issues, fmt.Sprintf("%s: %s", notImported.path, notImported.issue))
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "templates"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read chart templates: %w", err)
+	}
+
+	for _, entry := range entries {
+		path := "templates/" + entry.Name()
+		switch {
+		case strings.HasPrefix(entry.Name(), "."):
+			continue
+		case entry.IsDir():
+			chart.Issues = append(chart.Issues, fmt.Sprintf("%s/: template subdirectories are not imported", path))
+			continue
+		case entry.Name() == "NOTES.txt":
+			chart.Issues = append(chart.Issues, fmt.Sprintf("%s: not imported, Maniplacer has no install notes", path))
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, "templates", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not read template '%s': %w", path, err)
+		}
+
+		translated, err := templates.FromHelmTemplate(entry.Name(), content)
+		if err != nil {
+			chart.Issues = append(chart.Issues, fmt.Sprintf("%s: not imported, %s", path, err))
+			continue
+		}
+
+		if len(translated.Unsupported) > 0 {
+			chart.Issues = append(chart.Issues, fmt.Sprintf("%s: uses %s", path, strings.Join(translated.Unsupported, ", ")))
+		}
+		if bytes.Contains(content, []byte(helmHookAnnotation)) {
+			chart.Issues = append(chart.Issues, fmt.Sprintf("%s: Helm hook, imported as a regular manifest", path))
+		}
+
+		chart.Templates = append(chart.Templates, templates.ImportedTemplate{
+			FileName: entry.Name(),
+			Source:   path,
+			Content:  translated.Content,
+		})
+	}
+
+	return chart, nil
+}
+
+// writeChartValues writes the values of a chart as the repo config. Existing
+// config files are replaced after confirmation when they hold any value.
+func writeChartValues(out io.Writer, repoPath string, format ConfigFormat, values map[string]any) error {
+	var existing []string
+	holdsValues := false
+	for _, candidate := range []ConfigFormat{FormatJSON, FormatYAML, FormatYML} {
+		path := filepath.Join(repoPath, fmt.Sprintf("%s.%s", utils.ConfigFileName, candidate))
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		existing = append(existing, path)
+
+		config, err := (&ConfigLoader{FilePath: path, Format: candidate}).LoadConfig()
+		if err != nil || len(config) > 0 {
+			holdsValues = true
+		}
+	}
+
+	if holdsValues && !utils.ConfirmMessage("The repo already has a config, do you want to replace it with the chart values?") {
+		fmt.Fprintf(out, "Skipping config, the chart values were not imported...\n")
+		return nil
+	}
+
+	for _, path := range existing {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("could not replace config file: %w", err)
+		}
+	}
+
+	configPath := filepath.Join(repoPath, fmt.Sprintf("%s.%s", utils.ConfigFileName, format))
+	loader := &ConfigLoader{FilePath: configPath, Format: format}
+	if err := loader.SaveConfig(values); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "values.yaml → %s (%d keys)\n", filepath.Base(configPath), len(values))
+	return nil
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadHelmChart(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"Chart.yaml":                   "apiVersion: v2\nname: api\nversion: 1.0.0\ndependencies:\n  - name: redis\n",
+		"values.yaml":                  "image: nginx\nservice:\n  port: 80\n",
+		"templates/_helpers.tpl":       `{{ define "api.name" }}{{ .Values.image }}{{ end }}`,
+		"templates/deployment.yaml":    "name: {{ include \"api.name\" . }}\nrelease: {{ .Release.Name }}\n",
+		"templates/job.yaml":           "metadata:\n  annotations:\n    helm.sh/hook: pre-install\n",
+		"templates/broken.yaml":        "{{ .Values.image \n",
+		"templates/NOTES.txt":          "Thanks\n",
+		"templates/tests/test-pod.yml": "kind: Pod\n",
+		"crds/crd.yaml":                "kind: CustomResourceDefinition\n",
+	})
+
+	chart, err := readHelmChart(dir)
+	if err != nil {
+		t.Fatalf("readHelmChart() error = %v", err)
+	}
+
+	if chart.Meta.Name != "api" || chart.Values["image"] != "nginx" {
+		t.Errorf("chart = %+v, want api with values from values.yaml", chart)
+	}
+
+	got := make(map[string]string)
+	for _, tmpl := range chart.Templates {
+		got[tmpl.FileName] = string(tmpl.Content)
+	}
+	want := map[string]string{
+		"_helpers.tpl":    `{{ define "api.name" }}{{ .image }}{{ end }}`,
+		"deployment.yaml": "name: {{ template \"api.name\" . }}\nrelease: {{ .Release.Name }}\n",
+		"job.yaml":        "metadata:\n  annotations:\n    helm.sh/hook: pre-install\n",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("templates = %v, want %v", got, want)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("%s = %q, want %q", name, got[name], content)
+		}
+	}
+
+	wantIssues := []string{
+		"Chart.yaml: subcharts redis",
+		"crds: CRDs",
+		"templates/NOTES.txt: not imported",
+		"templates/broken.yaml: not imported",
+		"templates/deployment.yaml: uses .Release",
+		"templates/job.yaml: Helm hook",
+		"templates/tests/: template subdirectories",
+	}
+	if len(chart.Issues) != len(wantIssues) {
+		t.Fatalf("Issues = %v, want %d", chart.Issues, len(wantIssues))
+	}
+	for _, want := range wantIssues {
+		found := false
+		for _, issue := range chart.Issues {
+			found = found || strings.HasPrefix(issue, want)
+		}
+		if !found {
+			t.Errorf("Issues = %v, missing %q", chart.Issues, want)
+		}
+	}
+}
+
+func TestReadHelmChartRequiresChartYAML(t *testing.T) {
+	if _, err := readHelmChart(t.TempDir()); err == nil {
+		t.Error("readHelmChart() expected an error for a directory without Chart.yaml")
+	}
+}
+
+func TestWriteChartValuesReplacesEmptyConfig(t *testing.T) {
+	repoPath := t.TempDir()
+	writeTestFiles(t, repoPath, map[string]string{"config.json": ""})
+
+	if err := writeChartValues(io.Discard, repoPath, FormatYAML, map[string]any{"image": "nginx"}); err != nil {
+		t.Fatalf("writeChartValues() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(repoPath, "config.json")); !os.IsNotExist(err) {
+		t.Error("empty config.json was kept next to the new config")
+	}
+	content, err := os.ReadFile(filepath.Join(repoPath, "config.yaml"))
+	if err != nil {
+		t.Fatalf("could not read config.yaml: %v", err)
+	}
+	if string(content) != "image: nginx\n" {
+		t.Errorf("config.yaml = %q", content)
+	}
+}
+
+func TestRenderTemplatesWithPartials(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"_helpers.tpl":    `{{ define "labels" }}app: {{ .name }}{{ end }}`,
+		"deployment.yaml": `labels: { {{- template "labels" . -}} }`,
+	})
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifests, errorCount := renderTemplates(context.Background(), io.Discard, dir, files, map[string]any{"name": "api"})
+	if errorCount != 0 {
+		t.Fatalf("renderTemplates() errors = %d", errorCount)
+	}
+	if len(manifests) != 1 || manifests[0].Name != "deployment.yaml" {
+		t.Fatalf("manifests = %v, want only deployment.yaml", manifests)
+	}
+	if string(manifests[0].Content) != "labels: {app: api}" {
+		t.Errorf("deployment.yaml = %q", manifests[0].Content)
+	}
+}
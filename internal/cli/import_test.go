@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadImportSources(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"app.yaml":            "kind: Deployment\n",
+		"nested/service.yml":  "kind: Service\n",
+		"nested/list.json":    `{"kind": "List", "items": []}`,
+		"README.md":           "not a manifest",
+		".git/config.yaml":    "kind: Secret\n",
+		"nested/.hidden.yaml": "kind: ConfigMap\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sources, err := readImportSources(dir)
+	if err != nil {
+		t.Fatalf("readImportSources() error = %v", err)
+	}
+
+	var got []string
+	for _, source := range sources {
+		rel, _ := filepath.Rel(dir, source.Path)
+		got = append(got, rel)
+	}
+	want := []string{"app.yaml", "nested/list.json", "nested/service.yml"}
+	if len(got) != len(want) {
+		t.Fatalf("sources = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("sources[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	single, err := readImportSources(filepath.Join(dir, "app.yaml"))
+	if err != nil || len(single) != 1 {
+		t.Errorf("readImportSources(file) = %v, %v, want a single source", single, err)
+	}
+
+	if _, err := readImportSources(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("readImportSources() expected error for a missing path")
+	}
+}
@@ -0,0 +1,266 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kustomizationFileName is the file Kustomize reads in every kustomization directory
+const kustomizationFileName = "kustomization.yaml"
+
+// kustomizeLayoutDir is the directory, at the root of a repo, holding the
+// base and overlays written by --kustomize-overlays
+const kustomizeLayoutDir = "kustomize"
+
+// kustomization is the content of a kustomization.yaml
+type kustomization struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Namespace  string            `yaml:"namespace,omitempty"`
+	Labels     []kustomizeLabels `yaml:"labels,omitempty"`
+	Resources  []string          `yaml:"resources"`
+}
+
+// kustomizeLabels are labels Kustomize adds to every resource. Selectors are
+// left alone, since changing them on a live Deployment is rejected.
+type kustomizeLabels struct {
+	Pairs            map[string]string `yaml:"pairs"`
+	IncludeSelectors bool              `yaml:"includeSelectors"`
+}
+
+func newKustomization(namespace, repo string, resources []string) kustomization {
+	k := kustomization{
+		APIVersion: "kustomize.config.k8s.io/v1beta1",
+		Kind:       "Kustomization",
+		Namespace:  namespace,
+		Resources:  resources,
+	}
+	if repo != "" {
+		k.Labels = []kustomizeLabels{{Pairs: map[string]string{
+			"app.kubernetes.io/managed-by": "maniplacer",
+			"app.kubernetes.io/part-of":    repo,
+		}}}
+	}
+	return k
+}
+
+func (k kustomization) manifest(name string) (renderedManifest, error) {
+	content, err := yaml.Marshal(k)
+	if err != nil {
+		return renderedManifest{}, fmt.Errorf("could not encode %s: %w", name, err)
+	}
+	return renderedManifest{Name: name, Content: content}, nil
+}
+
+// kustomizeResources lists the manifests holding at least one object, in order
+func kustomizeResources(manifests []renderedManifest) ([]string, error) {
+	var resources []string
+	for _, manifest := range manifests {
+		if manifest.Name == kustomizationFileName {
+			return nil, fmt.Errorf("template '%s' collides with the generated kustomization, rename it", manifest.Name)
+		}
+		docs, err := decodeDocuments(manifest.Content)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", manifest.Name, err)
+		}
+		if len(docs) > 0 {
+			resources = append(resources, manifest.Name)
+		}
+	}
+	return resources, nil
+}
+
+// withKustomization returns manifests plus a kustomization.yaml listing them,
+// setting the namespace and the labels shared by everything in the repo
+func withKustomization(manifests []renderedManifest, repo, namespace string) ([]renderedManifest, error) {
+	resources, err := kustomizeResources(manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := newKustomization(namespace, repo, resources).manifest(kustomizationFileName)
+	if err != nil {
+		return nil, err
+	}
+	return append(slices.Clone(manifests), k), nil
+}
+
+// buildKustomizeLayout splits the manifests rendered for several namespaces of
+// a repo into a base, holding the manifests rendered identically for every
+// namespace, and one overlay per namespace with the rest. File names are
+// relative to the layout directory.
+func buildKustomizeLayout(repo string, namespaces map[string][]renderedManifest) ([]renderedManifest, error) {
+	names := make([]string, 0, len(namespaces))
+	for namespace := range namespaces {
+		names = append(names, namespace)
+	}
+	slices.Sort(names)
+
+	// A manifest is shared when every namespace rendered the same content under the same name
+	shared := make(map[string]bool)
+	for _, manifest := range namespaces[names[0]] {
+		shared[manifest.Name] = true
+		for _, namespace := range names[1:] {
+			i := slices.IndexFunc(namespaces[namespace], func(other renderedManifest) bool { return other.Name == manifest.Name })
+			if i < 0 || string(namespaces[namespace][i].Content) != string(manifest.Content) {
+				shared[manifest.Name] = false
+				break
+			}
+		}
+	}
+
+	var layout []renderedManifest
+	var base []renderedManifest
+	for _, manifest := range namespaces[names[0]] {
+		if shared[manifest.Name] {
+			base = append(base, manifest)
+		}
+	}
+	baseFiles, err := layoutDirectory("base", base, newKustomization("", "", nil))
+	if err != nil {
+		return nil, err
+	}
+	layout = append(layout, baseFiles...)
+
+	for _, namespace := range names {
+		var own []renderedManifest
+		for _, manifest := range namespaces[namespace] {
+			if !shared[manifest.Name] {
+				own = append(own, manifest)
+			}
+		}
+		overlayFiles, err := layoutDirectory(filepath.Join("overlays", namespace), own, newKustomization(namespace, repo, []string{"../../base"}))
+		if err != nil {
+			return nil, err
+		}
+		layout = append(layout, overlayFiles...)
+	}
+
+	return layout, nil
+}
+
+// layoutDirectory returns the files of one kustomization directory: its
+// manifests and a kustomization.yaml appending them to k resources
+func layoutDirectory(dir string, manifests []renderedManifest, k kustomization) ([]renderedManifest, error) {
+	resources, err := kustomizeResources(manifests)
+	if err != nil {
+		return nil, err
+	}
+	k.Resources = append(k.Resources, resources...)
+	if k.Resources == nil {
+		k.Resources = []string{}
+	}
+
+	kustomizationFile, err := k.manifest(filepath.Join(dir, kustomizationFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	files := []renderedManifest{kustomizationFile}
+	for _, manifest := range manifests {
+		files = append(files, renderedManifest{Name: filepath.Join(dir, manifest.Name), Content: manifest.Content})
+	}
+	return files, nil
+}
+
+// kustomizeOverlayGroups groups the manifests of successful results by repo,
+// leaving out the kustomization of each run
+func kustomizeOverlayGroups(results []generateResult) map[string]map[string][]renderedManifest {
+	groups := make(map[string]map[string][]renderedManifest)
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		var manifests []renderedManifest
+		for _, manifest := range result.Manifests {
+			if manifest.Name != kustomizationFileName {
+				manifests = append(manifests, manifest)
+			}
+		}
+		if groups[result.Target.Repo] == nil {
+			groups[result.Target.Repo] = make(map[string][]renderedManifest)
+		}
+		groups[result.Target.Repo][result.Target.Namespace] = manifests
+	}
+	return groups
+}
+
+// writeKustomizeOverlays writes the base and overlays of every repo that had
+// several namespaces generated to '<repo>/kustomize/'. The layout replaces
+// the previous one as a whole, so a repo keeps its previous layout when a
+// namespace failed or was not selected, since the new one would lose that
+// namespace's overlay and compute the base from fewer namespaces. It returns
+// the joined errors of the repos whose layout was not written.
+func writeKustomizeOverlays(out io.Writer, baseDir string, results []generateResult, dryRun bool) error {
+	groups := kustomizeOverlayGroups(results)
+
+	failedNamespaces := make(map[string][]string)
+	for _, result := range results {
+		if result.Err != nil {
+			failedNamespaces[result.Target.Repo] = append(failedNamespaces[result.Target.Repo], result.Target.Namespace)
+		}
+	}
+
+	repos := make([]string, 0, len(groups))
+	for repo := range groups {
+		repos = append(repos, repo)
+	}
+	slices.Sort(repos)
+
+	var errs []error
+	for _, repo := range repos {
+		namespaces := groups[repo]
+		if failed := failedNamespaces[repo]; len(failed) > 0 {
+			fmt.Fprintf(out, "\nSkipping kustomize overlays for %s: %s failed, the previous layout is kept\n", repo, strings.Join(failed, ", "))
+			errs = append(errs, fmt.Errorf("kustomize overlays for %s not written: %s failed", repo, strings.Join(failed, ", ")))
+			continue
+		}
+		if len(namespaces) < 2 {
+			fmt.Fprintf(out, "\nSkipping kustomize overlays for %s: only one namespace was generated\n", repo)
+			continue
+		}
+
+		all, err := templateNamespaces(baseDir, repo)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not list namespaces of %s: %w", repo, err))
+			continue
+		}
+		var missing []string
+		for _, namespace := range all {
+			if _, ok := namespaces[namespace]; !ok {
+				missing = append(missing, namespace)
+			}
+		}
+		if len(missing) > 0 {
+			fmt.Fprintf(out, "\nSkipping kustomize overlays for %s: %s not selected, the previous layout is kept\n", repo, strings.Join(missing, ", "))
+			errs = append(errs, fmt.Errorf("kustomize overlays for %s not written: every namespace must be generated, %s not selected", repo, strings.Join(missing, ", ")))
+			continue
+		}
+
+		layout, err := buildKustomizeLayout(repo, namespaces)
+		if err != nil {
+			fmt.Fprintf(out, "\nError: could not build kustomize overlays for %s: %s\n", repo, err)
+			errs = append(errs, fmt.Errorf("could not build kustomize overlays for %s: %w", repo, err))
+			continue
+		}
+
+		dir := filepath.Join(baseDir, repo, kustomizeLayoutDir)
+		if dryRun {
+			fmt.Fprintf(out, "\nWould write kustomize base and %d overlays to %s\n", len(namespaces), dir)
+			continue
+		}
+		if err := replaceDirAtomically(dir, layout); err != nil {
+			fmt.Fprintf(out, "\nError: %s\n", err)
+			errs = append(errs, fmt.Errorf("could not write kustomize overlays for %s: %w", repo, err))
+			continue
+		}
+		fmt.Fprintf(out, "\nKustomize base and %d overlays written to %s\n", len(namespaces), dir)
+	}
+	return errors.Join(errs...)
+}
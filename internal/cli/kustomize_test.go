@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestWithKustomization(t *testing.T) {
+	manifests := []renderedManifest{
+		{Name: "deployment.yaml", Content: []byte("kind: Deployment\nmetadata:\n  name: api\n")},
+		{Name: "empty.yaml", Content: []byte("# nothing rendered\n")},
+		{Name: "service.yaml", Content: []byte("kind: Service\nmetadata:\n  name: api\n")},
+	}
+
+	got, err := withKustomization(manifests, "myrepo", "staging")
+	if err != nil {
+		t.Fatalf("withKustomization() error = %v", err)
+	}
+	if len(got) != 4 || got[3].Name != kustomizationFileName {
+		t.Fatalf("manifests = %v, want the input plus %s", got, kustomizationFileName)
+	}
+
+	var k kustomization
+	if err := yaml.Unmarshal(got[3].Content, &k); err != nil {
+		t.Fatalf("could not parse kustomization: %v", err)
+	}
+	if k.Kind != "Kustomization" || k.Namespace != "staging" {
+		t.Errorf("kustomization = %+v, want a Kustomization for staging", k)
+	}
+	if !slices.Equal(k.Resources, []string{"deployment.yaml", "service.yaml"}) {
+		t.Errorf("resources = %v, want the manifests holding objects", k.Resources)
+	}
+	if len(k.Labels) != 1 || k.Labels[0].Pairs["app.kubernetes.io/part-of"] != "myrepo" || k.Labels[0].IncludeSelectors {
+		t.Errorf("labels = %+v, want part-of myrepo without selectors", k.Labels)
+	}
+
+	if _, err := withKustomization([]renderedManifest{{Name: kustomizationFileName}}, "myrepo", "staging"); err == nil {
+		t.Error("withKustomization() expected an error for a template named kustomization.yaml")
+	}
+}
+
+func TestBuildKustomizeLayout(t *testing.T) {
+	shared := renderedManifest{Name: "service.yaml", Content: []byte("kind: Service\n")}
+	layout, err := buildKustomizeLayout("myrepo", map[string][]renderedManifest{
+		"staging": {shared, {Name: "deployment.yaml", Content: []byte("kind: Deployment\nreplicas: 1\n")}},
+		"prod":    {shared, {Name: "deployment.yaml", Content: []byte("kind: Deployment\nreplicas: 3\n")}, {Name: "pdb.yaml", Content: []byte("kind: PodDisruptionBudget\n")}},
+	})
+	if err != nil {
+		t.Fatalf("buildKustomizeLayout() error = %v", err)
+	}
+
+	files := make(map[string][]byte)
+	for _, file := range layout {
+		files[file.Name] = file.Content
+	}
+
+	wantFiles := []string{
+		"base/kustomization.yaml", "base/service.yaml",
+		"overlays/prod/kustomization.yaml", "overlays/prod/deployment.yaml", "overlays/prod/pdb.yaml",
+		"overlays/staging/kustomization.yaml", "overlays/staging/deployment.yaml",
+	}
+	if len(files) != len(wantFiles) {
+		t.Errorf("layout = %d files, want %d", len(files), len(wantFiles))
+	}
+	for _, name := range wantFiles {
+		if _, ok := files[name]; !ok {
+			t.Errorf("layout is missing %s", name)
+		}
+	}
+
+	var prod kustomization
+	if err := yaml.Unmarshal(files["overlays/prod/kustomization.yaml"], &prod); err != nil {
+		t.Fatalf("could not parse overlay: %v", err)
+	}
+	if prod.Namespace != "prod" || !slices.Equal(prod.Resources, []string{"../../base", "deployment.yaml", "pdb.yaml"}) {
+		t.Errorf("prod overlay = %+v", prod)
+	}
+
+	dir := filepath.Join(t.TempDir(), kustomizeLayoutDir)
+	if err := replaceDirAtomically(dir, layout); err != nil {
+		t.Fatalf("replaceDirAtomically() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "overlays", "staging", "deployment.yaml")); err != nil {
+		t.Errorf("overlay manifest not written: %v", err)
+	}
+}
+
+func TestWriteKustomizeOverlays_FailedNamespace(t *testing.T) {
+	baseDir := t.TempDir()
+	previous := filepath.Join(baseDir, "myrepo", kustomizeLayoutDir, "overlays", "prod", "kustomization.yaml")
+	if err := os.MkdirAll(filepath.Dir(previous), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(previous, []byte("namespace: prod\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"myrepo/templates/dev", "myrepo/templates/staging", "myrepo/templates/prod", "other/templates/dev", "other/templates/prod"} {
+		if err := os.MkdirAll(filepath.Join(baseDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifests := []renderedManifest{{Name: "service.yaml", Content: []byte("kind: Service\n")}}
+	results := []generateResult{
+		{Target: generateTarget{Repo: "myrepo", Namespace: "dev"}, Manifests: manifests},
+		{Target: generateTarget{Repo: "myrepo", Namespace: "staging"}, Manifests: manifests},
+		{Target: generateTarget{Repo: "myrepo", Namespace: "prod"}, Err: errors.New("template failed")},
+		{Target: generateTarget{Repo: "other", Namespace: "dev"}, Manifests: manifests},
+		{Target: generateTarget{Repo: "other", Namespace: "prod"}, Manifests: manifests},
+	}
+
+	var out bytes.Buffer
+	err := writeKustomizeOverlays(&out, baseDir, results, false)
+	if err == nil || !strings.Contains(err.Error(), "myrepo") || strings.Contains(err.Error(), "other") {
+		t.Errorf("writeKustomizeOverlays() error = %v, want the failed repo only", err)
+	}
+
+	// The overlay of the failed namespace survives, the other repo is written
+	if _, err := os.Stat(previous); err != nil {
+		t.Errorf("previous overlay of the failed namespace was removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(baseDir, "other", kustomizeLayoutDir, "base", kustomizationFileName)); err != nil {
+		t.Errorf("layout of the successful repo not written: %v\n%s", err, out.String())
+	}
+}
+
+func TestWriteKustomizeOverlays_PartialSelection(t *testing.T) {
+	baseDir := t.TempDir()
+	previous := filepath.Join(baseDir, "myrepo", kustomizeLayoutDir, "overlays", "staging", "kustomization.yaml")
+	if err := os.MkdirAll(filepath.Dir(previous), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(previous, []byte("namespace: staging\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, namespace := range []string{"prod-eu", "prod-us", "staging"} {
+		if err := os.MkdirAll(filepath.Join(baseDir, "myrepo", "templates", namespace), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// --namespaces 'prod*' leaves staging out
+	manifests := []renderedManifest{{Name: "service.yaml", Content: []byte("kind: Service\n")}}
+	results := []generateResult{
+		{Target: generateTarget{Repo: "myrepo", Namespace: "prod-eu"}, Manifests: manifests},
+		{Target: generateTarget{Repo: "myrepo", Namespace: "prod-us"}, Manifests: manifests},
+	}
+
+	var out bytes.Buffer
+	err := writeKustomizeOverlays(&out, baseDir, results, false)
+	if err == nil || !strings.Contains(err.Error(), "staging not selected") {
+		t.Errorf("writeKustomizeOverlays() error = %v, want the unselected namespace", err)
+	}
+	if _, err := os.Stat(previous); err != nil {
+		t.Errorf("overlay of the unselected namespace was removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(baseDir, "myrepo", kustomizeLayoutDir, "overlays", "prod-eu")); !os.IsNotExist(err) {
+		t.Errorf("layout built from a subset of the namespaces was written: %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dantedelordran/maniplacer/internal/lint"
+	"github.com/dantedelordran/maniplacer/internal/policy"
+	"github.com/dantedelordran/maniplacer/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [path...]",
+	Short: "Checks rendered manifests against built-in and project policies",
+	Long: `The lint command checks rendered objects against built-in rules and the project policies and reports every violation.
+
+By default the latest run of a repo namespace is linted, use --run to pick another one. Files and directories given
+as arguments are linted instead (directories are walked for .yaml, .yml and .json files).
+
+Rules:
+  no-latest-tag    (error)   container images are pinned to a tag other than latest, or to a digest
+  resources        (warning) containers set resource requests and limits
+  probes           (warning) containers of Deployments, StatefulSets and DaemonSets have readiness and liveness probes
+  run-as-non-root  (error)   containers set securityContext.runAsNonRoot, directly or through the pod
+  hpa-min-max      (error)   HorizontalPodAutoscalers have minReplicas <= maxReplicas
+  pdb-present      (warning) Deployments and StatefulSets with more than one replica are covered by a PodDisruptionBudget
+  dangling-ref     (error)   HPA scaleTargetRefs, HTTPRoute parentRefs and backendRefs (and their ports), Ingress backends and
+                             HealthCheckPolicy targetRefs name objects of the run
+  service-selector (warning) Service selectors match the pod template of a workload of the run
+  service-ports    (warning) Service targetPorts are exposed by the selected containers (numbers only when they declare ports)
+  config-refs      (warning) ConfigMaps and Secrets used by pod volumes, env and envFrom exist in the run, with the keys read
+
+The last four rules check the objects linted together against each other, references naming another namespace and
+optional ConfigMap or Secret references are not checked.
+
+Severities are changed per rule in the 'lint' section of the repo settings.yaml, per namespace if needed:
+
+  lint:
+    probes: info
+    pdb-present: off
+
+CEL policies of the project 'policies' directory are checked along the built-in rules, see 'maniplacer generate --help'.
+
+An object is exempt from rules listed, comma separated, in its 'maniplacer.io/lint-ignore' annotation.
+
+Example usage:
+  maniplacer lint -r myrepo -n production
+  maniplacer lint -r myrepo -n production --run 2024-01-15_14-30-45-0001
+  maniplacer lint -r myrepo -n production --format sarif > lint.sarif
+  maniplacer lint ./rendered --fail-on warning
+
+Notes:
+  - The command exits with code 1 when a finding is at least as serious as --fail-on (error by default, off never fails)
+  - --format json and sarif write nothing but the report to stdout, for CI`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := utils.LoggerFromContext(cmd.Context())
+
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			logger.Debug("could not get namespace flag, using default", "error", err)
+			namespace = utils.DefaultNamespace
+		}
+
+		repo, err := cmd.Flags().GetString("repo")
+		if err != nil {
+			return fmt.Errorf("could not get repo flag: %w", err)
+		}
+
+		run, err := cmd.Flags().GetString("run")
+		if err != nil {
+			logger.Debug("could not get run flag, using latest", "error", err)
+			run = ""
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			logger.Debug("could not get format flag, using text", "error", err)
+			format = lint.FormatText
+		}
+		if !slices.Contains([]string{lint.FormatText, lint.FormatJSON, lint.FormatSARIF}, format) {
+			return fmt.Errorf("unsupported lint format '%s'. Supported formats: text, json, sarif", format)
+		}
+
+		failOnFlag, err := cmd.Flags().GetString("fail-on")
+		if err != nil {
+			logger.Debug("could not get fail-on flag, using error", "error", err)
+			failOnFlag = string(lint.SeverityError)
+		}
+		failOn, err := lint.ParseSeverity(failOnFlag)
+		if err != nil {
+			return fmt.Errorf("invalid --fail-on: %w", err)
+		}
+
+		if repo != "" {
+			if err := utils.ValidateRepoName(repo); err != nil {
+				return fmt.Errorf("invalid repository name: %w", err)
+			}
+			if err := utils.ValidateSafePath(repo); err != nil {
+				return err
+			}
+			if err := utils.ValidateNamespace(namespace); err != nil {
+				return fmt.Errorf("invalid namespace: %w", err)
+			}
+		}
+
+		paths := args
+		if len(paths) == 0 {
+			if !utils.IsValidProject() {
+				return fmt.Errorf("current directory is not a valid Maniplacer project")
+			}
+			if repo == "" {
+				return fmt.Errorf("repository name is required (use --repo flag), or give the files to lint")
+			}
+
+			runDir, err := lintRunDir(filepath.Join(repo, "manifests", namespace), run)
+			if err != nil {
+				return err
+			}
+			logger.Info("linting run", "run", runDir)
+			paths = []string{runDir}
+		} else if run != "" {
+			return fmt.Errorf("--run cannot be combined with paths to lint")
+		}
+
+		rules, err := policy.Load(policy.DirName)
+		if err != nil {
+			return err
+		}
+		config := lint.Config{Rules: rules}
+		if repo != "" {
+			settings, err := loadRepoSettings(filepath.Join(repo, repoSettingsFileName))
+			if err != nil {
+				return err
+			}
+			config.Severities = settings.forNamespace(namespace).Lint
+		}
+
+		objects, err := readLintObjects(paths)
+		if err != nil {
+			return err
+		}
+
+		report, err := lint.Run(objects, config)
+		if err != nil {
+			return err
+		}
+		logger.Info("lint complete", "objects", len(objects), "policies", len(rules), "findings", len(report.Findings), "waived", report.Waived)
+
+		if err := lint.Write(cmd.OutOrStdout(), report, format); err != nil {
+			return fmt.Errorf("could not write lint report: %w", err)
+		}
+
+		if report.Fails(failOn) {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+			return &ExitError{Code: 1}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+	lintCmd.Flags().StringP("namespace", "n", utils.DefaultNamespace, "Namespace of the run to lint")
+	lintCmd.Flags().StringP("repo", "r", "", "Repo name")
+	lintCmd.Flags().String("run", "", "Run to lint (default: the latest run)")
+	lintCmd.Flags().String("format", lint.FormatText, "Report format (text, json, sarif)")
+	lintCmd.Flags().String("fail-on", string(lint.SeverityError), "Exit with code 1 when a finding is at least this serious (error, warning, info, off)")
+}
+
+// lintRunDir returns the directory of the named run, or of the latest run
+func lintRunDir(manifestsDir, run string) (string, error) {
+	if run == "" {
+		latest, err := LatestRun(manifestsDir)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(manifestsDir, latest.Name), nil
+	}
+
+	if filepath.Base(run) != run || utils.ValidateSafePath(run) != nil {
+		return "", fmt.Errorf("invalid run name '%s'", run)
+	}
+	runDir := filepath.Join(manifestsDir, run)
+	if _, err := os.Stat(runDir); err != nil {
+		return "", fmt.Errorf("run '%s' not found in %s", run, manifestsDir)
+	}
+	return runDir, nil
+}
+
+// readLintObjects reads the objects of the given files and directories.
+// Directories are walked for manifests, skipping hidden files and the
+// kustomization of kustomize runs.
+func readLintObjects(paths []string) ([]lint.Object, error) {
+	var objects []lint.Object
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			isRoot := path == root
+			if !isRoot && strings.HasPrefix(entry.Name(), ".") {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			if !isRoot && (entry.Name() == kustomizationFileName || !slices.Contains(importExtensions, strings.ToLower(filepath.Ext(entry.Name())))) {
+				return nil
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			parsed, err := lint.ParseObjects(filepath.ToSlash(path), content)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, parsed...)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not read manifests to lint: %w", err)
+		}
+	}
+	return objects, nil
+}
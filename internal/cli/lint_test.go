@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadLintObjects(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"deployment.yaml":        "kind: Deployment\nmetadata:\n  name: api\n",
+		"nested/service.yml":     "kind: Service\nmetadata:\n  name: api\n",
+		kustomizationFileName:    "kind: Kustomization\n",
+		runMetadataFileName:      `{"kind": "Hidden"}`,
+		".hidden/configmap.yaml": "kind: ConfigMap\nmetadata:\n  name: api\n",
+		"README.md":              "kind: Markdown\n",
+	})
+	single := filepath.Join(t.TempDir(), "pod.txt")
+	writeTestFiles(t, filepath.Dir(single), map[string]string{"pod.txt": "kind: Pod\nmetadata:\n  name: debug\n"})
+
+	objects, err := readLintObjects([]string{dir, single})
+	if err != nil {
+		t.Fatalf("readLintObjects() error = %v", err)
+	}
+
+	var got []string
+	for _, obj := range objects {
+		got = append(got, obj.ID())
+	}
+	want := []string{"Deployment/api", "Service/api", "Pod/debug"}
+	if len(got) != len(want) {
+		t.Fatalf("objects = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("objects[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+	if objects[1].Source != filepath.ToSlash(filepath.Join(dir, "nested", "service.yml")) {
+		t.Errorf("Source = %s", objects[1].Source)
+	}
+}
+
+func TestLintRunDir(t *testing.T) {
+	manifestsDir := filepath.Join(t.TempDir(), "manifests", "default")
+	manifests := []renderedManifest{{Name: "app.yaml", Content: []byte("kind: ConfigMap")}}
+	first, _, err := WriteRun(manifestsDir, manifests, time.Date(2024, 1, 15, 14, 30, 45, 0, time.Local))
+	if err != nil {
+		t.Fatalf("WriteRun() error = %v", err)
+	}
+	latest, _, err := WriteRun(manifestsDir, manifests, time.Date(2024, 1, 16, 9, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatalf("WriteRun() error = %v", err)
+	}
+
+	if dir, err := lintRunDir(manifestsDir, ""); err != nil || dir != latest {
+		t.Errorf("lintRunDir() = %s, %v, want %s", dir, err, latest)
+	}
+	if dir, err := lintRunDir(manifestsDir, filepath.Base(first)); err != nil || dir != first {
+		t.Errorf("lintRunDir(first) = %s, %v, want %s", dir, err, first)
+	}
+	for _, run := range []string{"missing", "../default", "a/b"} {
+		if _, err := lintRunDir(manifestsDir, run); err == nil {
+			t.Errorf("lintRunDir(%q) expected an error", run)
+		}
+	}
+}
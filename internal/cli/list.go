@@ -14,7 +14,7 @@ var listCmd = &cobra.Command{
 	Short: "Lists every manifest from a given namespace",
 	Long: `The list command displays all generated manifests stored under a specific namespace in your Maniplacer project.
 
-It scans the 'manifests/<namespace>/' directory of the selected repository and prints out the manifest files available. By default, it looks in the 'default' namespace, but you can override this with the --namespace (or -n) flag. You must also specify the target repository with the --repo (or -r) flag.
+It scans the 'manifests/<namespace>/' directory of the selected repository and prints out the generated runs available, oldest first. By default, it looks in the 'default' namespace, but you can override this with the --namespace (or -n) flag. You must also specify the target repository with the --repo (or -r) flag.
 
 This is useful for quickly checking which manifests are currently available for a given environment or namespace without manually browsing directories.
 
@@ -74,15 +74,15 @@ Notes:
 			return fmt.Errorf("manifest directory does not exist: %w", err)
 		}
 
-		files, err := os.ReadDir(manifestsDir)
+		runs, err := ListRuns(manifestsDir)
 		if err != nil {
 			return fmt.Errorf("could not read manifests directory: %w", err)
 		}
 
-		logger.Info("listing manifests", "namespace", namespace, "count", len(files))
+		logger.Info("listing manifests", "namespace", namespace, "count", len(runs))
 		fmt.Printf("Manifests in %s namespace:\n", namespace)
-		for _, file := range files {
-			fmt.Printf("- %s\n", file.Name())
+		for _, run := range runs {
+			fmt.Printf("- %s\n", run)
 		}
 
 		return nil
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// stdoutOutput is the --output value that streams manifests instead of writing a run
+const stdoutOutput = "-"
+
+// Supported formats for streamed manifests, and for runs with kustomize
+const (
+	outputFormatYAML      = "yaml"
+	outputFormatJSON      = "json"
+	outputFormatKustomize = "kustomize"
+)
+
+func validateOutputFormat(format string, toStdout bool) error {
+	switch format {
+	case outputFormatYAML:
+		return nil
+	case outputFormatJSON:
+		if !toStdout {
+			return fmt.Errorf("--format-out %s is only supported together with --output %s", format, stdoutOutput)
+		}
+		return nil
+	case outputFormatKustomize:
+		if toStdout {
+			return fmt.Errorf("--format-out %s writes runs and cannot be combined with --output %s", format, stdoutOutput)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format '%s'. Supported formats: yaml, json, kustomize", format)
+	}
+}
+
+// writeManifestStream writes every rendered manifest to w, either as a single
+// '---' separated YAML stream or as a JSON List object
+func writeManifestStream(w io.Writer, manifests []renderedManifest, format string) error {
+	if format == outputFormatJSON {
+		return writeJSONList(w, manifests)
+	}
+
+	first := true
+	for _, manifest := range manifests {
+		content := strings.TrimSpace(string(manifest.Content))
+		content = strings.TrimPrefix(content, "---")
+		content = strings.TrimSpace(content)
+		if content == "" {
+			continue
+		}
+
+		if !first {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		if _, err := fmt.Fprintf(w, "# Source: %s\n%s\n", manifest.Name, content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeJSONList(w io.Writer, manifests []renderedManifest) error {
+	items := []any{}
+	for _, manifest := range manifests {
+		docs, err := decodeDocuments(manifest.Content)
+		if err != nil {
+			return fmt.Errorf("could not parse %s: %w", manifest.Name, err)
+		}
+		for _, doc := range docs {
+			items = append(items, doc)
+		}
+	}
+
+	list := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// decodeDocuments parses every non-empty YAML document in content
+func decodeDocuments(content []byte) ([]map[string]any, error) {
+	var docs []map[string]any
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc map[string]any
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc) == 0 {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+// rewriteObjects calls rewrite on every object of the manifests, in order.
+// Manifests where rewrite changed an object are re-encoded, the others are
+// returned untouched so comments and formatting survive.
+func rewriteObjects(manifests []renderedManifest, rewrite func(manifest string, obj *unstructured.Unstructured) (bool, error)) ([]renderedManifest, error) {
+	rewritten := make([]renderedManifest, 0, len(manifests))
+	for _, manifest := range manifests {
+		docs, err := decodeDocuments(manifest.Content)
+		if err != nil {
+			// Not YAML, so there is no object to rewrite
+			rewritten = append(rewritten, manifest)
+			continue
+		}
+
+		changed := false
+		for d, doc := range docs {
+			obj := &unstructured.Unstructured{Object: doc}
+			if obj.GetKind() == "" {
+				continue
+			}
+
+			objChanged, err := rewrite(manifest.Name, obj)
+			if err != nil {
+				return nil, err
+			}
+			if objChanged {
+				docs[d] = obj.Object
+				changed = true
+			}
+		}
+
+		if !changed {
+			rewritten = append(rewritten, manifest)
+			continue
+		}
+
+		content, err := encodeDocuments(docs)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode rewritten %s: %w", manifest.Name, err)
+		}
+		rewritten = append(rewritten, renderedManifest{Name: manifest.Name, Content: content})
+	}
+
+	return rewritten, nil
+}
+
+// encodeDocuments writes objects as a '---' separated YAML stream
+func encodeDocuments(docs []map[string]any) ([]byte, error) {
+	var out bytes.Buffer
+	for i, doc := range docs {
+		content, err := sigsyaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			out.WriteString("---\n")
+		}
+		out.Write(content)
+	}
+	return out.Bytes(), nil
+}
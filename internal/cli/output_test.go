@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteManifestStreamYAML(t *testing.T) {
+	manifests := []renderedManifest{
+		{Name: "deployment.yaml", Content: []byte("kind: Deployment\n")},
+		{Name: "empty.yaml", Content: []byte("\n\n")},
+		{Name: "multi.yaml", Content: []byte("---\nkind: Service\n---\nkind: ConfigMap\n")},
+	}
+
+	var buf strings.Builder
+	if err := writeManifestStream(&buf, manifests, outputFormatYAML); err != nil {
+		t.Fatalf("writeManifestStream() error = %v", err)
+	}
+
+	expected := "# Source: deployment.yaml\nkind: Deployment\n---\n# Source: multi.yaml\nkind: Service\n---\nkind: ConfigMap\n"
+	if buf.String() != expected {
+		t.Errorf("writeManifestStream() = %q, want %q", buf.String(), expected)
+	}
+
+	docs, err := decodeDocuments([]byte(buf.String()))
+	if err != nil {
+		t.Fatalf("decodeDocuments() error = %v", err)
+	}
+	if len(docs) != 3 {
+		t.Errorf("stream contains %d documents, want 3", len(docs))
+	}
+}
+
+func TestWriteManifestStreamJSON(t *testing.T) {
+	manifests := []renderedManifest{
+		{Name: "deployment.yaml", Content: []byte("kind: Deployment\nmetadata:\n  name: api\n")},
+		{Name: "multi.yaml", Content: []byte("kind: Service\n---\nkind: ConfigMap\n")},
+	}
+
+	var buf strings.Builder
+	if err := writeManifestStream(&buf, manifests, outputFormatJSON); err != nil {
+		t.Fatalf("writeManifestStream() error = %v", err)
+	}
+
+	var list struct {
+		Kind  string           `json:"kind"`
+		Items []map[string]any `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(buf.String()), &list); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if list.Kind != "List" {
+		t.Errorf("kind = %q, want List", list.Kind)
+	}
+	if len(list.Items) != 3 {
+		t.Fatalf("got %d items, want 3", len(list.Items))
+	}
+	if list.Items[0]["kind"] != "Deployment" || list.Items[2]["kind"] != "ConfigMap" {
+		t.Errorf("unexpected items order: %v", list.Items)
+	}
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		toStdout bool
+		wantErr  bool
+	}{
+		{"yaml to run", outputFormatYAML, false, false},
+		{"yaml to stdout", outputFormatYAML, true, false},
+		{"json to stdout", outputFormatJSON, true, false},
+		{"json to run", outputFormatJSON, false, true},
+		{"kustomize to run", outputFormatKustomize, false, false},
+		{"kustomize to stdout", outputFormatKustomize, true, true},
+		{"unknown", "toml", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOutputFormat(tt.format, tt.toStdout)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateOutputFormat(%q, %v) error = %v, wantErr %v", tt.format, tt.toStdout, err, tt.wantErr)
+			}
+		})
+	}
+}
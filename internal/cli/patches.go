@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// patchesDirName is the directory of a repo holding the patches of each namespace
+const patchesDirName = "patches"
+
+// Patch types, as recorded in the run metadata
+const (
+	patchTypeStrategicMerge = "strategic-merge"
+	patchTypeJSON6902       = "json6902"
+)
+
+// patchTarget selects the objects a JSON 6902 patch applies to. Empty fields match anything.
+type patchTarget struct {
+	Group         string `json:"group,omitempty"`
+	Version       string `json:"version,omitempty"`
+	Kind          string `json:"kind,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Namespace     string `json:"namespace,omitempty"`
+	LabelSelector string `json:"labelSelector,omitempty"`
+}
+
+// renderPatch is a single patch document of a patch file
+type renderPatch struct {
+	File     string
+	Document int
+	Type     string
+	Target   patchTarget
+	selector labels.Selector
+	content  []byte // The strategic merge patch, or the JSON 6902 operations, as JSON
+}
+
+// patchResult records which objects a patch changed
+type patchResult struct {
+	File     string   `json:"file"`
+	Document int      `json:"document"`
+	Type     string   `json:"type"`
+	Objects  []string `json:"objects"`
+}
+
+func (p renderPatch) String() string {
+	return fmt.Sprintf("%s (document %d)", p.File, p.Document)
+}
+
+// loadPatches reads the patch files of dir, in file name order. A document
+// with 'target' and 'patch' fields is a JSON 6902 patch, any other document is
+// a strategic merge patch matched by apiVersion, kind, name and namespace.
+// A missing directory means no patches.
+func loadPatches(dir string) ([]renderPatch, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read patches directory: %w", err)
+	}
+
+	var patches []renderPatch
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !slices.Contains(importExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not read patch '%s': %w", entry.Name(), err)
+		}
+
+		docs, err := decodeDocuments(content)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse patch '%s': %w", entry.Name(), err)
+		}
+
+		for i, doc := range docs {
+			patch, err := newRenderPatch(entry.Name(), i+1, doc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid patch '%s' (document %d): %w", entry.Name(), i+1, err)
+			}
+			patches = append(patches, patch)
+		}
+	}
+
+	return patches, nil
+}
+
+func newRenderPatch(file string, document int, doc map[string]any) (renderPatch, error) {
+	patch := renderPatch{File: file, Document: document, selector: labels.Everything()}
+
+	_, hasTarget := doc["target"]
+	operations, hasOperations := doc["patch"]
+	if !hasTarget && !hasOperations {
+		obj := unstructured.Unstructured{Object: doc}
+		if obj.GetKind() == "" || obj.GetName() == "" {
+			return patch, fmt.Errorf("a strategic merge patch needs kind and metadata.name, a JSON 6902 patch needs target and patch")
+		}
+
+		gvk := obj.GroupVersionKind()
+		patch.Type = patchTypeStrategicMerge
+		patch.Target = patchTarget{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind, Name: obj.GetName(), Namespace: obj.GetNamespace()}
+
+		content, err := json.Marshal(doc)
+		if err != nil {
+			return patch, err
+		}
+		patch.content = content
+		return patch, nil
+	}
+
+	if !hasTarget || !hasOperations {
+		return patch, fmt.Errorf("a JSON 6902 patch needs both target and patch")
+	}
+
+	patch.Type = patchTypeJSON6902
+	target, err := json.Marshal(doc["target"])
+	if err != nil {
+		return patch, err
+	}
+	if err := json.Unmarshal(target, &patch.Target); err != nil {
+		return patch, fmt.Errorf("invalid target: %w", err)
+	}
+	if patch.Target.LabelSelector != "" {
+		if patch.selector, err = labels.Parse(patch.Target.LabelSelector); err != nil {
+			return patch, fmt.Errorf("invalid target labelSelector: %w", err)
+		}
+	}
+
+	content, err := json.Marshal(operations)
+	if err != nil {
+		return patch, err
+	}
+	decoded, err := jsonpatch.DecodePatch(content)
+	if err != nil {
+		return patch, fmt.Errorf("invalid patch operations: %w", err)
+	}
+	for i, operation := range decoded {
+		if !slices.Contains([]string{"add", "remove", "replace", "move", "copy", "test"}, operation.Kind()) {
+			return patch, fmt.Errorf("invalid patch operation %d: unsupported op '%s'", i+1, operation.Kind())
+		}
+	}
+	patch.content = content
+	return patch, nil
+}
+
+// matches reports whether the patch applies to obj
+func (p renderPatch) matches(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	// Strategic merge patches always name their group, "" being the core group
+	groupMatches := p.Target.Group == gvk.Group || p.Type == patchTypeJSON6902 && p.Target.Group == ""
+	return groupMatches &&
+		(p.Target.Version == "" || p.Target.Version == gvk.Version) &&
+		(p.Target.Kind == "" || p.Target.Kind == gvk.Kind) &&
+		(p.Target.Name == "" || p.Target.Name == obj.GetName()) &&
+		(p.Target.Namespace == "" || p.Target.Namespace == obj.GetNamespace()) &&
+		p.selector.Matches(labels.Set(obj.GetLabels()))
+}
+
+// apply returns the patched JSON of an object
+func (p renderPatch) apply(original []byte, gvk schema.GroupVersionKind) ([]byte, error) {
+	if p.Type == patchTypeJSON6902 {
+		operations, err := jsonpatch.DecodePatch(p.content)
+		if err != nil {
+			return nil, err
+		}
+		return operations.Apply(original)
+	}
+
+	// Strategic merge needs the Go type of the object to know how lists are
+	// merged, objects of unknown kinds get a JSON merge patch like kubectl does
+	typed, err := scheme.Scheme.New(gvk)
+	if err != nil {
+		return jsonpatch.MergePatch(original, p.content)
+	}
+	return strategicpatch.StrategicMergePatch(original, p.content, typed)
+}
+
+// applyPatches applies every patch, in order, to the objects of the rendered
+// manifests. Manifests with a patched object are re-encoded, the others are
+// returned untouched. The result lists the objects each patch changed.
+func applyPatches(manifests []renderedManifest, patches []renderPatch) ([]renderedManifest, []patchResult, error) {
+	results := make([]patchResult, len(patches))
+	for i, patch := range patches {
+		results[i] = patchResult{File: patch.File, Document: patch.Document, Type: patch.Type, Objects: []string{}}
+	}
+	if len(patches) == 0 {
+		return manifests, results, nil
+	}
+
+	patched, err := rewriteObjects(manifests, func(manifest string, obj *unstructured.Unstructured) (bool, error) {
+		changed := false
+		for i, patch := range patches {
+			if !patch.matches(obj) {
+				continue
+			}
+
+			original, err := json.Marshal(obj.Object)
+			if err != nil {
+				return false, fmt.Errorf("could not encode %s/%s of %s: %w", obj.GetKind(), obj.GetName(), manifest, err)
+			}
+			out, err := patch.apply(original, obj.GroupVersionKind())
+			if err != nil {
+				return false, fmt.Errorf("could not apply patch %s to %s/%s of %s: %w", patch, obj.GetKind(), obj.GetName(), manifest, err)
+			}
+
+			var object map[string]any
+			if err := json.Unmarshal(out, &object); err != nil {
+				return false, fmt.Errorf("patch %s produced an invalid object: %w", patch, err)
+			}
+			obj.Object = object
+			changed = true
+			results[i].Objects = append(results[i].Objects, fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName()))
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return patched, results, nil
+}
@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const patchTestDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  labels:
+    app: api
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: api
+          image: api:1.0
+        - name: sidecar
+          image: proxy:1.0
+`
+
+func TestApplyPatches(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"10-replicas.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: api
+          image: api:2.0
+`,
+		"20-json.yaml": `target:
+  kind: Deployment
+  labelSelector: app=api
+patch:
+  - op: add
+    path: /metadata/annotations
+    value:
+      team: payments
+---
+target:
+  kind: Service
+patch:
+  - op: remove
+    path: /spec/clusterIP
+`,
+		"README.md": "not a patch",
+	})
+
+	patches, err := loadPatches(dir)
+	if err != nil {
+		t.Fatalf("loadPatches() error = %v", err)
+	}
+	if len(patches) != 3 {
+		t.Fatalf("patches = %d, want 3", len(patches))
+	}
+
+	untouched := renderedManifest{Name: "configmap.yaml", Content: []byte("# keep me\nkind: ConfigMap\nmetadata:\n  name: api\n")}
+	manifests, results, err := applyPatches([]renderedManifest{{Name: "deployment.yaml", Content: []byte(patchTestDeployment)}, untouched}, patches)
+	if err != nil {
+		t.Fatalf("applyPatches() error = %v", err)
+	}
+
+	patched := string(manifests[0].Content)
+	for _, want := range []string{"replicas: 3", "image: api:2.0", "image: proxy:1.0", "team: payments"} {
+		if !strings.Contains(patched, want) {
+			t.Errorf("patched deployment is missing %q:\n%s", want, patched)
+		}
+	}
+	if string(manifests[1].Content) != string(untouched.Content) {
+		t.Errorf("manifest without a matching object was re-encoded:\n%s", manifests[1].Content)
+	}
+
+	wantResults := []patchResult{
+		{File: "10-replicas.yaml", Document: 1, Type: patchTypeStrategicMerge, Objects: []string{"Deployment/api"}},
+		{File: "20-json.yaml", Document: 1, Type: patchTypeJSON6902, Objects: []string{"Deployment/api"}},
+		{File: "20-json.yaml", Document: 2, Type: patchTypeJSON6902, Objects: []string{}},
+	}
+	for i, want := range wantResults {
+		got := results[i]
+		if got.File != want.File || got.Document != want.Document || got.Type != want.Type || !slices.Equal(got.Objects, want.Objects) {
+			t.Errorf("results[%d] = %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestApplyPatchesUnknownKindUsesMergePatch(t *testing.T) {
+	patch, err := newRenderPatch("route.yaml", 1, map[string]any{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata":   map[string]any{"name": "api"},
+		"spec":       map[string]any{"hostnames": []any{"prod.example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("newRenderPatch() error = %v", err)
+	}
+
+	route := "apiVersion: gateway.networking.k8s.io/v1\nkind: HTTPRoute\nmetadata:\n  name: api\nspec:\n  hostnames:\n    - app.example.com\n"
+	manifests, _, err := applyPatches([]renderedManifest{{Name: "httproute.yaml", Content: []byte(route)}}, []renderPatch{patch})
+	if err != nil {
+		t.Fatalf("applyPatches() error = %v", err)
+	}
+	if content := string(manifests[0].Content); !strings.Contains(content, "prod.example.com") || strings.Contains(content, "app.example.com") {
+		t.Errorf("patched route =\n%s", content)
+	}
+}
+
+func TestLoadPatchesErrors(t *testing.T) {
+	if patches, err := loadPatches(filepath.Join(t.TempDir(), "missing")); err != nil || patches != nil {
+		t.Errorf("loadPatches() on a missing directory = %v, %v, want no patches", patches, err)
+	}
+
+	tests := map[string]string{
+		"no name":        "kind: Deployment\nspec: {}\n",
+		"target only":    "target:\n  kind: Deployment\n",
+		"bad operations": "target:\n  kind: Deployment\npatch:\n  - op: explode\n",
+		"bad selector":   "target:\n  labelSelector: 'app in (api'\npatch: []\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "patch.yaml"), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadPatches(dir); err == nil {
+				t.Error("loadPatches() expected an error")
+			}
+		})
+	}
+}
+
+func TestGenerateRecordsPatchesInRunMetadata(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestRepo(t, tmpDir, "api", `{"name": "api"}`, "prod")
+	writeTestFiles(t, filepath.Join(tmpDir, "api", "templates", "prod"), map[string]string{
+		"app.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .name }}\ndata:\n  level: info\n",
+	})
+	writeTestFiles(t, filepath.Join(tmpDir, "api", patchesDirName, "prod"), map[string]string{
+		"level.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: api\ndata:\n  level: debug\n",
+	})
+
+	targets, err := discoverTargets(tmpDir, targetSelector{Repo: "api", Namespace: "prod"})
+	if err != nil {
+		t.Fatalf("discoverTargets() error = %v", err)
+	}
+	resolveTargetConfigs(tmpDir, targets, "", "")
+
+	result := runGenerateTargets(context.Background(), generateOptions{}, targets, 1)[0]
+	if result.Err != nil {
+		t.Fatalf("generate error = %v", result.Err)
+	}
+
+	runDir := filepath.Join(result.Target.ManifestsDir, result.Run.Name)
+	content, err := os.ReadFile(filepath.Join(runDir, "app.yaml"))
+	if err != nil {
+		t.Fatalf("could not read generated manifest: %v", err)
+	}
+	if !strings.Contains(string(content), "level: debug") {
+		t.Errorf("generated manifest was not patched:\n%s", content)
+	}
+
+	metadata, err := readRunMetadata(runDir)
+	if err != nil {
+		t.Fatalf("readRunMetadata() error = %v", err)
+	}
+	if metadata.Repo != "api" || metadata.Namespace != "prod" || len(metadata.Patches) != 1 || !slices.Equal(metadata.Patches[0].Objects, []string{"ConfigMap/api"}) {
+		t.Errorf("run metadata = %+v", metadata)
+	}
+
+	manifests, err := readRunManifests(runDir)
+	if err != nil {
+		t.Fatalf("readRunManifests() error = %v", err)
+	}
+	if len(manifests) != 1 {
+		t.Errorf("readRunManifests() = %d manifests, want only app.yaml", len(manifests))
+	}
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"github.com/dantedelordran/maniplacer/internal/lint"
+	"github.com/dantedelordran/maniplacer/internal/policy"
+)
+
+// checkPolicies runs the project policies of policiesDir against the rendered
+// manifests. Built-in lint rules are left to the lint command, severities
+// still follow the 'lint' section of the repo settings.
+func checkPolicies(policiesDir string, manifests []renderedManifest, severities map[string]lint.Severity) ([]lint.Finding, error) {
+	rules, err := policy.Load(policiesDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	var objects []lint.Object
+	for _, manifest := range manifests {
+		parsed, err := lint.ParseObjects(manifest.Name, manifest.Content)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, parsed...)
+	}
+
+	report, err := lint.Run(objects, lint.Config{Severities: severities, Rules: rules, SkipBuiltins: true})
+	if err != nil {
+		return nil, err
+	}
+	return report.Findings, nil
+}
+
+// blockingPolicyFindings evaluates the project policies against the manifests
+// of a run and returns the error findings, which keep it from being applied.
+// The findings generate recorded in the run are not trusted: policies may have
+// changed since, and the run may have been edited.
+func blockingPolicyFindings(baseDir, repo, namespace, runDir string) ([]lint.Finding, error) {
+	manifests, err := readRunManifests(runDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read run: %w", err)
+	}
+	manifests = slices.DeleteFunc(manifests, func(manifest renderedManifest) bool {
+		return manifest.Name == kustomizationFileName
+	})
+
+	settings, err := loadRepoSettings(filepath.Join(baseDir, repo, repoSettingsFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	findings, err := checkPolicies(filepath.Join(baseDir, policy.DirName), manifests, settings.forNamespace(namespace).Lint)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocking []lint.Finding
+	for _, finding := range findings {
+		if finding.Severity.AtLeast(lint.SeverityError) {
+			blocking = append(blocking, finding)
+		}
+	}
+	return blocking, nil
+}
+
+// enforcePolicies refuses a run failing the project policies, unless ignore is set
+func enforcePolicies(out io.Writer, baseDir, repo, namespace, runDir string, ignore bool) error {
+	blocking, err := blockingPolicyFindings(baseDir, repo, namespace, runDir)
+	if err != nil {
+		return fmt.Errorf("could not check policies: %w", err)
+	}
+	if len(blocking) == 0 {
+		return nil
+	}
+
+	for _, finding := range blocking {
+		fmt.Fprintf(out, "Policy: %s\n", formatFinding(finding))
+	}
+	if !ignore {
+		return fmt.Errorf("the run fails %d policy checks, fix them and generate again or use --ignore-policies", len(blocking))
+	}
+	fmt.Fprintf(out, "Applying despite %d policy errors (--ignore-policies)\n", len(blocking))
+	return nil
+}
+
+// formatFinding describes a policy finding on a single line
+func formatFinding(finding lint.Finding) string {
+	return fmt.Sprintf("%s %s %s (%s:%d): %s", finding.Severity, finding.Rule, finding.Object, finding.Source, finding.Line, finding.Message)
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dantedelordran/maniplacer/internal/lint"
+	"github.com/dantedelordran/maniplacer/internal/policy"
+)
+
+func TestGenerateRecordsPolicyFindings(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestRepo(t, tmpDir, "api", `{"name": "api"}`, "prod")
+	writeTestFiles(t, filepath.Join(tmpDir, "api", "templates", "prod"), map[string]string{
+		"app.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .name }}\ndata:\n  level: debug\n",
+	})
+	writeTestFiles(t, filepath.Join(tmpDir, "api"), map[string]string{
+		repoSettingsFileName: "lint:\n  no-debug: warning\n",
+	})
+	writeTestFiles(t, filepath.Join(tmpDir, policy.DirName), map[string]string{
+		"org.yaml": "name: no-debug\nkinds: [ConfigMap]\nexpression: \"object.data.level != 'debug'\"\nmessage: debug logging\n" +
+			"---\nname: named\nexpression: \"object.metadata.name.startsWith('team-')\"\n",
+	})
+
+	targets, err := discoverTargets(tmpDir, targetSelector{Repo: "api", Namespace: "prod"})
+	if err != nil {
+		t.Fatalf("discoverTargets() error = %v", err)
+	}
+	resolveTargetConfigs(tmpDir, targets, "", "")
+
+	result := runGenerateTargets(context.Background(), generateOptions{}, targets, 1)[0]
+	if result.Err != nil {
+		t.Fatalf("generate error = %v", result.Err)
+	}
+
+	runDir := filepath.Join(result.Target.ManifestsDir, result.Run.Name)
+	metadata, err := readRunMetadata(runDir)
+	if err != nil {
+		t.Fatalf("readRunMetadata() error = %v", err)
+	}
+	if len(metadata.PolicyFindings) != 2 {
+		t.Fatalf("policy findings = %+v, want 2", metadata.PolicyFindings)
+	}
+	if finding := metadata.PolicyFindings[1]; finding.Rule != "no-debug" || finding.Severity != lint.SeverityWarning || finding.Source != "app.yaml" {
+		t.Errorf("no-debug finding = %+v, want a warning from the repo settings", finding)
+	}
+
+	blocking, err := blockingPolicyFindings(tmpDir, "api", "prod", runDir)
+	if err != nil {
+		t.Fatalf("blockingPolicyFindings() error = %v", err)
+	}
+	if len(blocking) != 1 || blocking[0].Rule != "named" {
+		t.Errorf("blockingPolicyFindings() = %+v, want the named error only", blocking)
+	}
+}
+
+func TestEnforcePoliciesAddedAfterGenerate(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestRepo(t, tmpDir, "api", `{"name": "api"}`, "prod")
+	writeTestFiles(t, filepath.Join(tmpDir, "api", "templates", "prod"), map[string]string{
+		"app.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .name }}\n",
+	})
+
+	targets, err := discoverTargets(tmpDir, targetSelector{Repo: "api", Namespace: "prod"})
+	if err != nil {
+		t.Fatalf("discoverTargets() error = %v", err)
+	}
+	resolveTargetConfigs(tmpDir, targets, "", "")
+
+	result := runGenerateTargets(context.Background(), generateOptions{}, targets, 1)[0]
+	if result.Err != nil {
+		t.Fatalf("generate error = %v", result.Err)
+	}
+	runDir := filepath.Join(result.Target.ManifestsDir, result.Run.Name)
+
+	var out bytes.Buffer
+	if err := enforcePolicies(&out, tmpDir, "api", "prod", runDir, false); err != nil {
+		t.Fatalf("enforcePolicies() without policies error = %v", err)
+	}
+
+	// The run recorded no findings, the policy added since still blocks it,
+	// with or without the run metadata
+	writeTestFiles(t, filepath.Join(tmpDir, policy.DirName), map[string]string{
+		"org.yaml": "name: named\nexpression: \"object.metadata.name.startsWith('team-')\"\n",
+	})
+	for _, removeMetadata := range []bool{false, true} {
+		if removeMetadata {
+			if err := os.Remove(filepath.Join(runDir, runMetadataFileName)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := enforcePolicies(&out, tmpDir, "api", "prod", runDir, false); err == nil || !strings.Contains(err.Error(), "1 policy checks") {
+			t.Errorf("enforcePolicies() error = %v, want the run refused", err)
+		}
+	}
+	if !strings.Contains(out.String(), "named ConfigMap/api") {
+		t.Errorf("enforcePolicies() output = %q, want the finding", out.String())
+	}
+
+	if err := enforcePolicies(&out, tmpDir, "api", "prod", runDir, true); err != nil {
+		t.Errorf("enforcePolicies() with ignore error = %v", err)
+	}
+
+	// Severities of the repo settings apply
+	writeTestFiles(t, filepath.Join(tmpDir, "api"), map[string]string{
+		repoSettingsFileName: "lint:\n  named: warning\n",
+	})
+	if err := enforcePolicies(&out, tmpDir, "api", "prod", runDir, false); err != nil {
+		t.Errorf("enforcePolicies() with a warning error = %v", err)
+	}
+}
@@ -81,12 +81,12 @@ If confirmed, this will remove all manifests inside the 'staging' namespace of t
 			return fmt.Errorf("manifest directory does not exist: %w", err)
 		}
 
-		files, err := os.ReadDir(currentDir)
+		runs, err := ListRuns(currentDir)
 		if err != nil {
 			return fmt.Errorf("could not read manifests directory: %w", err)
 		}
 
-		if len(files) == 0 {
+		if len(runs) == 0 {
 			fmt.Printf("No manifests in %s namespace\n", namespace)
 			return nil
 		}
@@ -96,18 +96,18 @@ If confirmed, this will remove all manifests inside the 'staging' namespace of t
 			return nil
 		}
 
-		logger.Info("deleting manifests", "namespace", namespace, "count", len(files))
+		logger.Info("deleting manifests", "namespace", namespace, "count", len(runs))
 		fmt.Printf("Deleting manifests in %s namespace...\n", namespace)
 
-		for _, file := range files {
-			filePath := filepath.Join(currentDir, file.Name())
-			if err = os.RemoveAll(filePath); err != nil {
-				logger.Warn("could not delete file, skipping", "file", file.Name(), "error", err)
-				fmt.Printf("Could not delete %s due to %s, skipping...\n", file.Name(), err)
+		for _, run := range runs {
+			runPath := filepath.Join(currentDir, run.Name)
+			if err = os.RemoveAll(runPath); err != nil {
+				logger.Warn("could not delete run, skipping", "run", run, "error", err)
+				fmt.Printf("Could not delete %s due to %s, skipping...\n", run, err)
 				continue
 			}
-			logger.Info("file deleted", "file", file.Name())
-			fmt.Printf("Successfully deleted %s\n", file.Name())
+			logger.Info("run deleted", "run", run)
+			fmt.Printf("Successfully deleted %s\n", run)
 		}
 
 		logger.Info("prune complete", "namespace", namespace)
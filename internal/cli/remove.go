@@ -26,6 +26,18 @@ Supported components include:
 - ConfigMap
 - HPA
 - HCPolicy
+- StatefulSet
+- DaemonSet
+- Job
+- CronJob
+- Ingress
+- NetworkPolicy
+- PDB
+- Gateway
+- ServiceAccount
+- Role
+- ClusterRole
+- PVC
 
 Examples:
   maniplacer remove service -r myrepo
@@ -2,6 +2,8 @@ package cli
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/dantedelordran/maniplacer/internal/utils"
@@ -24,8 +26,37 @@ It generates the manifest in your local project in order for you to apply or sto
 
 type loggerKey struct{}
 
+// ExitCodeNoChanges is the exit code used when generate finds nothing new to write
+const ExitCodeNoChanges = 3
+
+// ExitError makes Execute terminate with a specific exit code. Err is logged
+// as a failure when set, a nil Err means the command already reported why it
+// stopped.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit code %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
 func Execute() {
 	if err := rootCmd.ExecuteContext(context.Background()); err != nil {
+		var exitErr *ExitError
+		if errors.As(err, &exitErr) {
+			if exitErr.Err != nil {
+				utils.Logger().Error("command execution failed", "error", exitErr.Err)
+			}
+			os.Exit(exitErr.Code)
+		}
 		utils.Logger().Error("command execution failed", "error", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,307 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dantedelordran/maniplacer/internal/lint"
+	"github.com/dantedelordran/maniplacer/internal/utils"
+)
+
+// runTimeLayout is the timestamp layout shared by legacy and current run folder names
+const runTimeLayout = "2006-01-02_15-04-05"
+
+// maxRunSequence bounds how many runs can be created within the same second
+const maxRunSequence = 9999
+
+// runIDRegex matches both legacy run folders (2006-01-02_15-04-05) and
+// sequenced run folders (2006-01-02_15-04-05-0001)
+var runIDRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2})(?:-(\d{4}))?$`)
+
+// RunID identifies a single generate run inside manifests/<namespace>/
+type RunID struct {
+	Name   string
+	Time   time.Time
+	Seq    int
+	Legacy bool
+}
+
+// String returns the folder name of the run
+func (r RunID) String() string {
+	return r.Name
+}
+
+// NewRunID builds the run identifier for a timestamp and sequence number
+func NewRunID(t time.Time, seq int) RunID {
+	stamp := t.Format(runTimeLayout)
+	parsed, _ := time.ParseInLocation(runTimeLayout, stamp, t.Location())
+	return RunID{
+		Name: fmt.Sprintf("%s-%04d", stamp, seq),
+		Time: parsed,
+		Seq:  seq,
+	}
+}
+
+// ParseRunID parses a run folder name, reporting false for anything that is not a run
+func ParseRunID(name string) (RunID, bool) {
+	match := runIDRegex.FindStringSubmatch(name)
+	if match == nil {
+		return RunID{}, false
+	}
+
+	t, err := time.ParseInLocation(runTimeLayout, match[1], time.Local)
+	if err != nil {
+		return RunID{}, false
+	}
+
+	if match[2] == "" {
+		return RunID{Name: name, Time: t, Legacy: true}, true
+	}
+
+	seq, err := strconv.Atoi(match[2])
+	if err != nil {
+		return RunID{}, false
+	}
+
+	return RunID{Name: name, Time: t, Seq: seq}, true
+}
+
+// compareRunIDs orders runs chronologically, legacy runs first within the same second
+func compareRunIDs(a, b RunID) int {
+	if c := a.Time.Compare(b.Time); c != 0 {
+		return c
+	}
+	if a.Legacy != b.Legacy {
+		if a.Legacy {
+			return -1
+		}
+		return 1
+	}
+	return a.Seq - b.Seq
+}
+
+// ListRuns returns every run folder inside dir sorted from oldest to newest,
+// ignoring entries that are not runs
+func ListRuns(dir string) ([]RunID, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []RunID
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if run, ok := ParseRunID(entry.Name()); ok {
+			runs = append(runs, run)
+		}
+	}
+
+	slices.SortFunc(runs, compareRunIDs)
+	return runs, nil
+}
+
+// LatestRun returns the newest run inside dir
+func LatestRun(dir string) (RunID, error) {
+	runs, err := ListRuns(dir)
+	if err != nil {
+		return RunID{}, err
+	}
+	if len(runs) == 0 {
+		return RunID{}, fmt.Errorf("no manifest runs found in %s", dir)
+	}
+	return runs[len(runs)-1], nil
+}
+
+// stagingPrefix marks run folders that are still being written
+const stagingPrefix = ".staging-"
+
+// WriteRun writes manifests into a hidden staging folder inside parent and only
+// then renames it into a new run folder, so a run is either complete or absent.
+// Concurrent callers within the same second get increasing sequence numbers
+// instead of sharing a folder.
+func WriteRun(parent string, manifests []renderedManifest, now time.Time) (string, RunID, error) {
+	if err := os.MkdirAll(parent, utils.DirPermission); err != nil {
+		return "", RunID{}, fmt.Errorf("could not create directory '%s': %w", parent, err)
+	}
+
+	stagingDir, err := os.MkdirTemp(parent, stagingPrefix)
+	if err != nil {
+		return "", RunID{}, fmt.Errorf("could not create staging directory: %w", err)
+	}
+	// Once the rename succeeds the staging path no longer exists and this is a no-op
+	defer os.RemoveAll(stagingDir)
+
+	if err := os.Chmod(stagingDir, utils.DirPermission); err != nil {
+		return "", RunID{}, fmt.Errorf("could not set staging directory permissions: %w", err)
+	}
+
+	for _, manifest := range manifests {
+		if err := writeManifest(stagingDir, manifest); err != nil {
+			return "", RunID{}, fmt.Errorf("could not stage manifest '%s': %w", manifest.Name, err)
+		}
+	}
+
+	for seq := 1; seq <= maxRunSequence; seq++ {
+		run := NewRunID(now, seq)
+		path := filepath.Join(parent, run.Name)
+
+		// Renaming onto an empty directory succeeds on some platforms, so
+		// never target a name that is already taken
+		if _, err := os.Lstat(path); err == nil {
+			continue
+		}
+
+		err := os.Rename(stagingDir, path)
+		if err == nil {
+			return path, run, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", RunID{}, fmt.Errorf("could not create run directory '%s': %w", path, err)
+		}
+	}
+
+	return "", RunID{}, fmt.Errorf("too many runs created at %s in %s", now.Format(runTimeLayout), parent)
+}
+
+// replaceDirAtomically writes files, named by their path relative to dir,
+// into a hidden staging folder next to dir and only then swaps it in place of
+// dir, so dir holds either its previous content or the complete new one
+func replaceDirAtomically(dir string, files []renderedManifest) error {
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, utils.DirPermission); err != nil {
+		return fmt.Errorf("could not create directory '%s': %w", parent, err)
+	}
+
+	stagingDir, err := os.MkdirTemp(parent, stagingPrefix)
+	if err != nil {
+		return fmt.Errorf("could not create staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	if err := os.Chmod(stagingDir, utils.DirPermission); err != nil {
+		return fmt.Errorf("could not set staging directory permissions: %w", err)
+	}
+
+	for _, file := range files {
+		fileDir := filepath.Join(stagingDir, filepath.Dir(file.Name))
+		if err := os.MkdirAll(fileDir, utils.DirPermission); err != nil {
+			return fmt.Errorf("could not create directory '%s': %w", filepath.Dir(file.Name), err)
+		}
+		if err := writeManifest(fileDir, renderedManifest{Name: filepath.Base(file.Name), Content: file.Content}); err != nil {
+			return fmt.Errorf("could not stage '%s': %w", file.Name, err)
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("could not replace '%s': %w", dir, err)
+	}
+	if err := os.Rename(stagingDir, dir); err != nil {
+		return fmt.Errorf("could not write '%s': %w", dir, err)
+	}
+	return nil
+}
+
+// runMetadataFileName is the hidden file of a run recording how it was generated
+const runMetadataFileName = ".maniplacer-run.json"
+
+// runMetadata describes how a run was generated
+type runMetadata struct {
+	Repo      string        `json:"repo"`
+	Namespace string        `json:"namespace"`
+	Patches   []patchResult `json:"patches,omitempty"`
+	Images    []imageResult `json:"images,omitempty"`
+	// Findings of the project policies, errors keep the run from being applied
+	PolicyFindings []lint.Finding `json:"policyFindings,omitempty"`
+}
+
+// manifest returns the metadata as the hidden file written along the run manifests
+func (m runMetadata) manifest() (renderedManifest, error) {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return renderedManifest{}, fmt.Errorf("could not encode run metadata: %w", err)
+	}
+	return renderedManifest{Name: runMetadataFileName, Content: append(content, '\n')}, nil
+}
+
+// readRunMetadata reads the metadata of a run
+func readRunMetadata(runDir string) (*runMetadata, error) {
+	content, err := os.ReadFile(filepath.Join(runDir, runMetadataFileName))
+	if err != nil {
+		return nil, fmt.Errorf("could not read run metadata: %w", err)
+	}
+
+	var metadata runMetadata
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return nil, fmt.Errorf("could not parse run metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// hashManifests returns a content hash of a set of rendered manifests that
+// does not depend on the order they were rendered in
+func hashManifests(manifests []renderedManifest) string {
+	sorted := slices.Clone(manifests)
+	slices.SortFunc(sorted, func(a, b renderedManifest) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	h := sha256.New()
+	for _, manifest := range sorted {
+		h.Write([]byte(manifest.Name))
+		h.Write([]byte{0})
+		h.Write(manifest.Content)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readRunManifests loads every manifest file stored in a run folder. Hidden
+// files are bookkeeping, not manifests, and are skipped.
+func readRunManifests(runDir string) ([]renderedManifest, error) {
+	entries, err := os.ReadDir(runDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []renderedManifest
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(runDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, renderedManifest{Name: entry.Name(), Content: content})
+	}
+	return manifests, nil
+}
+
+// latestRunMatches reports whether the newest run in manifestsDir holds
+// exactly the given manifests
+func latestRunMatches(manifestsDir string, manifests []renderedManifest) (RunID, bool) {
+	latest, err := LatestRun(manifestsDir)
+	if err != nil {
+		return RunID{}, false
+	}
+
+	existing, err := readRunManifests(filepath.Join(manifestsDir, latest.Name))
+	if err != nil {
+		return RunID{}, false
+	}
+
+	return latest, hashManifests(existing) == hashManifests(manifests)
+}
@@ -0,0 +1,229 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRunID(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantOK     bool
+		wantLegacy bool
+		wantSeq    int
+	}{
+		{"legacy", "2024-01-15_14-30-45", true, true, 0},
+		{"sequenced", "2024-01-15_14-30-45-0001", true, false, 1},
+		{"high sequence", "2024-01-15_14-30-45-0042", true, false, 42},
+		{"hidden dir", ".staging-123", false, false, 0},
+		{"random name", "backup", false, false, 0},
+		{"short sequence", "2024-01-15_14-30-45-1", false, false, 0},
+		{"invalid date", "2024-13-45_14-30-45", false, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run, ok := ParseRunID(tt.input)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseRunID(%q) ok = %v, want %v", tt.input, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if run.Legacy != tt.wantLegacy {
+				t.Errorf("ParseRunID(%q) legacy = %v, want %v", tt.input, run.Legacy, tt.wantLegacy)
+			}
+			if run.Seq != tt.wantSeq {
+				t.Errorf("ParseRunID(%q) seq = %d, want %d", tt.input, run.Seq, tt.wantSeq)
+			}
+			if run.String() != tt.input {
+				t.Errorf("ParseRunID(%q) name = %q", tt.input, run.String())
+			}
+		})
+	}
+}
+
+func TestListRunsOrdersLegacyAndSequencedRuns(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	names := []string{
+		"2024-01-15_14-30-46-0002",
+		"2024-01-15_14-30-45",
+		"2024-01-15_14-30-46-0010",
+		"2024-01-15_14-30-46",
+		"2024-01-15_14-30-46-0001",
+		"not-a-run",
+	}
+	for _, name := range names {
+		if err := os.Mkdir(filepath.Join(tmpDir, name), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "2024-01-15_14-30-47"), []byte("file"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	runs, err := ListRuns(tmpDir)
+	if err != nil {
+		t.Fatalf("ListRuns() error = %v", err)
+	}
+
+	expected := []string{
+		"2024-01-15_14-30-45",
+		"2024-01-15_14-30-46",
+		"2024-01-15_14-30-46-0001",
+		"2024-01-15_14-30-46-0002",
+		"2024-01-15_14-30-46-0010",
+	}
+	if len(runs) != len(expected) {
+		t.Fatalf("ListRuns() returned %d runs, want %d: %v", len(runs), len(expected), runs)
+	}
+	for i, name := range expected {
+		if runs[i].Name != name {
+			t.Errorf("runs[%d] = %q, want %q", i, runs[i].Name, name)
+		}
+	}
+
+	latest, err := LatestRun(tmpDir)
+	if err != nil {
+		t.Fatalf("LatestRun() error = %v", err)
+	}
+	if latest.Name != "2024-01-15_14-30-46-0010" {
+		t.Errorf("LatestRun() = %q, want %q", latest.Name, "2024-01-15_14-30-46-0010")
+	}
+}
+
+func TestLatestRunEmpty(t *testing.T) {
+	if _, err := LatestRun(t.TempDir()); err == nil {
+		t.Error("Expected error for directory without runs, got nil")
+	}
+}
+
+func TestWriteRunIsUniqueWithinSameSecond(t *testing.T) {
+	tmpDir := t.TempDir()
+	parent := filepath.Join(tmpDir, "manifests", "default")
+	now := time.Date(2024, 1, 15, 14, 30, 45, 0, time.Local)
+	manifests := []renderedManifest{{Name: "deployment.yaml", Content: []byte("kind: Deployment")}}
+
+	const workers = 16
+	var wg sync.WaitGroup
+	paths := make([]string, workers)
+	errs := make([]error, workers)
+
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			paths[i], _, errs[i] = WriteRun(parent, manifests, now)
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i := range workers {
+		if errs[i] != nil {
+			t.Fatalf("WriteRun() error = %v", errs[i])
+		}
+		if seen[paths[i]] {
+			t.Errorf("WriteRun() returned duplicate path %s", paths[i])
+		}
+		seen[paths[i]] = true
+
+		if _, err := os.Stat(filepath.Join(paths[i], "deployment.yaml")); err != nil {
+			t.Errorf("WriteRun() run %s is missing its manifest: %v", paths[i], err)
+		}
+	}
+
+	runs, err := ListRuns(parent)
+	if err != nil {
+		t.Fatalf("ListRuns() error = %v", err)
+	}
+	if len(runs) != workers {
+		t.Errorf("ListRuns() returned %d runs, want %d", len(runs), workers)
+	}
+	if runs[0].Name != "2024-01-15_14-30-45-0001" {
+		t.Errorf("first run = %q, want %q", runs[0].Name, "2024-01-15_14-30-45-0001")
+	}
+
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != workers {
+		t.Errorf("found %d entries in %s, staging folders were left behind", len(entries), parent)
+	}
+}
+
+func TestWriteRunLeavesNothingOnFailure(t *testing.T) {
+	parent := filepath.Join(t.TempDir(), "manifests", "default")
+	manifests := []renderedManifest{
+		{Name: "deployment.yaml", Content: []byte("kind: Deployment")},
+		{Name: "missing/service.yaml", Content: []byte("kind: Service")},
+	}
+
+	if _, _, err := WriteRun(parent, manifests, time.Now()); err == nil {
+		t.Fatal("Expected error writing into a missing subdirectory, got nil")
+	}
+
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("WriteRun() left %d entries behind after failing", len(entries))
+	}
+}
+
+func TestHashManifestsIgnoresOrder(t *testing.T) {
+	a := []renderedManifest{
+		{Name: "deployment.yaml", Content: []byte("kind: Deployment")},
+		{Name: "service.yaml", Content: []byte("kind: Service")},
+	}
+	b := []renderedManifest{a[1], a[0]}
+
+	if hashManifests(a) != hashManifests(b) {
+		t.Error("hashManifests() differs for the same manifests in a different order")
+	}
+
+	c := []renderedManifest{a[0], {Name: "service.yaml", Content: []byte("kind: Service\n")}}
+	if hashManifests(a) == hashManifests(c) {
+		t.Error("hashManifests() is equal for different content")
+	}
+}
+
+func TestLatestRunMatches(t *testing.T) {
+	tmpDir := t.TempDir()
+	manifests := []renderedManifest{
+		{Name: "deployment.yaml", Content: []byte("kind: Deployment")},
+	}
+
+	if _, unchanged := latestRunMatches(tmpDir, manifests); unchanged {
+		t.Error("latestRunMatches() reported unchanged without any run")
+	}
+
+	runDir, run, err := WriteRun(tmpDir, manifests, time.Now())
+	if err != nil {
+		t.Fatalf("WriteRun() error = %v", err)
+	}
+	// Hidden bookkeeping files are not part of the run content
+	if err := os.WriteFile(filepath.Join(runDir, ".notes"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	latest, unchanged := latestRunMatches(tmpDir, manifests)
+	if !unchanged {
+		t.Error("latestRunMatches() reported changes for identical output")
+	}
+	if latest.Name != run.Name {
+		t.Errorf("latestRunMatches() run = %v, want %v", latest, run)
+	}
+
+	changed := []renderedManifest{{Name: "deployment.yaml", Content: []byte("kind: Deployment\nspec: {}")}}
+	if _, unchanged := latestRunMatches(tmpDir, changed); unchanged {
+		t.Error("latestRunMatches() reported unchanged for different output")
+	}
+}
@@ -0,0 +1,331 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dantedelordran/maniplacer/internal/secrets"
+	"github.com/dantedelordran/maniplacer/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Encrypts, decrypts and edits SOPS encrypted config files",
+	Long: `The secrets commands manage config files encrypted in the SOPS format with age keys, so secret values can be
+committed to git. Maniplacer decrypts encrypted config files in memory whenever it loads them (generate, watch, add,
+...), nothing is written in plaintext and no external service or binary is needed. 'maniplacer export helm' refuses
+encrypted configs unless --plaintext-values is given, since Helm reads values.yaml in plaintext.
+
+Every value is encrypted with AES-256-GCM under a data key, itself encrypted to each age recipient. Keys stay readable,
+as do values under keys ending in '_unencrypted'. Files stay compatible with the sops tool.
+
+Keys:
+  - age identities are read from SOPS_AGE_KEY, the file named by SOPS_AGE_KEY_FILE, or '<user config dir>/sops/age/keys.txt'
+    (~/.config/sops/age/keys.txt on Linux), the same places sops reads them from
+  - new files are encrypted to the --age recipients, else to the 'age' recipients of the first '.sops.yaml' creation rule
+    whose path_regex matches the file, else to the public keys of the local identities
+
+Available commands:
+  encrypt   → encrypts a plaintext config file
+  decrypt   → prints the plaintext of an encrypted file
+  edit      → opens the plaintext of an encrypted file in $EDITOR and encrypts it again
+
+Example usage:
+  maniplacer secrets encrypt -i myrepo/config.yaml
+  maniplacer secrets edit myrepo/config.yaml
+  maniplacer secrets decrypt myrepo/config.yaml`,
+}
+
+var secretsEncryptCmd = &cobra.Command{
+	Use:   "encrypt [file]",
+	Short: "Encrypts a config file",
+	Long: `The encrypt command encrypts every value of a JSON or YAML file and prints the result, or replaces the file with --in-place.
+
+Example usage:
+  maniplacer secrets encrypt -i myrepo/config.yaml
+  maniplacer secrets encrypt -i myrepo/config.json --age age1...,age1...
+  maniplacer secrets encrypt myrepo/config.yaml > myrepo/config.enc.yaml
+
+Notes:
+  - The format is picked from the file extension (.json, .yaml or .yml)
+  - Comments are not encrypted`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := utils.LoggerFromContext(cmd.Context())
+		path := args[0]
+
+		inPlace, err := cmd.Flags().GetBool("in-place")
+		if err != nil {
+			logger.Debug("could not get in-place flag, printing the result", "error", err)
+			inPlace = false
+		}
+
+		ageFlag, err := cmd.Flags().GetStringSlice("age")
+		if err != nil {
+			logger.Debug("could not get age flag, using the default recipients", "error", err)
+			ageFlag = nil
+		}
+
+		encrypted, err := encryptSecretsFile(path, ageFlag)
+		if err != nil {
+			return err
+		}
+		return writeSecretsResult(cmd, path, encrypted, inPlace)
+	},
+}
+
+var secretsDecryptCmd = &cobra.Command{
+	Use:   "decrypt [file]",
+	Short: "Decrypts a config file",
+	Long: `The decrypt command prints the plaintext of an encrypted file, or replaces the file with it with --in-place.
+
+Example usage:
+  maniplacer secrets decrypt myrepo/config.yaml
+  maniplacer secrets decrypt -i myrepo/config.yaml
+
+Notes:
+  - Decrypting in place leaves the secrets in plaintext on disk, prefer 'maniplacer secrets edit' to change values`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := utils.LoggerFromContext(cmd.Context())
+		path := args[0]
+
+		inPlace, err := cmd.Flags().GetBool("in-place")
+		if err != nil {
+			logger.Debug("could not get in-place flag, printing the result", "error", err)
+			inPlace = false
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read '%s': %w", path, err)
+		}
+		if !secrets.IsEncrypted(content) {
+			return fmt.Errorf("'%s' is not encrypted", path)
+		}
+		plaintext, _, err := decryptSecrets(path, content)
+		if err != nil {
+			return err
+		}
+		return writeSecretsResult(cmd, path, plaintext, inPlace)
+	},
+}
+
+var secretsEditCmd = &cobra.Command{
+	Use:   "edit [file]",
+	Short: "Edits an encrypted config file",
+	Long: `The edit command decrypts a file into a private temporary file, opens it in $VISUAL or $EDITOR (vi by default)
+and encrypts the result again with the same data key and recipients. A missing file is created.
+
+Example usage:
+  maniplacer secrets edit myrepo/config.yaml
+  EDITOR="code --wait" maniplacer secrets edit myrepo/config.json
+
+Notes:
+  - The temporary file is removed once the editor exits
+  - When the edited file does not parse you are asked to edit it again, declining discards the changes`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := utils.LoggerFromContext(cmd.Context())
+		path := args[0]
+
+		ageFlag, err := cmd.Flags().GetStringSlice("age")
+		if err != nil {
+			logger.Debug("could not get age flag, using the default recipients", "error", err)
+			ageFlag = nil
+		}
+
+		changed, err := editSecretsFile(path, ageFlag, runEditor, func(err error) bool {
+			return utils.ConfirmMessage(fmt.Sprintf("The edited file is invalid: %s\nEdit it again?", err))
+		})
+		if err != nil {
+			return err
+		}
+		if !changed {
+			fmt.Fprintf(cmd.OutOrStdout(), "No changes, %s left untouched\n", path)
+			return nil
+		}
+		logger.Info("secrets file encrypted", "path", path)
+		fmt.Fprintf(cmd.OutOrStdout(), "Encrypted %s\n", path)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsEncryptCmd, secretsDecryptCmd, secretsEditCmd)
+
+	secretsEncryptCmd.Flags().BoolP("in-place", "i", false, "Replace the file instead of printing the result")
+	secretsEncryptCmd.Flags().StringSlice("age", nil, "age recipients to encrypt to, comma separated (default: .sops.yaml or the local key)")
+	secretsDecryptCmd.Flags().BoolP("in-place", "i", false, "Replace the file instead of printing the result")
+	secretsEditCmd.Flags().StringSlice("age", nil, "age recipients of a new file, comma separated (default: .sops.yaml or the local key)")
+}
+
+// secretsRecipients returns the recipients a new file is encrypted to: the
+// given ones, else those of .sops.yaml, else the public keys of the local identities
+func secretsRecipients(path string, recipients []string) ([]string, error) {
+	if len(recipients) > 0 {
+		return recipients, nil
+	}
+
+	recipients, err := secrets.RecipientsFor(path)
+	if err != nil || len(recipients) > 0 {
+		return recipients, err
+	}
+
+	identities, err := secrets.LoadIdentities()
+	if err != nil {
+		return nil, fmt.Errorf("no age recipients given with --age or in %s, and %w", secrets.ConfigFileName, err)
+	}
+	if recipients = secrets.IdentityRecipients(identities); len(recipients) == 0 {
+		return nil, fmt.Errorf("no age recipients given with --age or in %s, and the local key has no X25519 identity", secrets.ConfigFileName)
+	}
+	return recipients, nil
+}
+
+// decryptSecrets decrypts the content of an encrypted file with the local identities
+func decryptSecrets(path string, content []byte) ([]byte, *secrets.Key, error) {
+	identities, err := secrets.LoadIdentities()
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, key, err := secrets.Decrypt(content, DetectConfigFormat(path).secretsFormat(), identities)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not decrypt '%s': %w", path, err)
+	}
+	return plaintext, key, nil
+}
+
+// encryptSecretsFile returns the encryption of a plaintext file
+func encryptSecretsFile(path string, recipients []string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read '%s': %w", path, err)
+	}
+	if secrets.IsEncrypted(content) {
+		return nil, fmt.Errorf("'%s' is already encrypted", path)
+	}
+
+	if recipients, err = secretsRecipients(path, recipients); err != nil {
+		return nil, err
+	}
+	key, err := secrets.NewKey(recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := key.Encrypt(content, DetectConfigFormat(path).secretsFormat())
+	if err != nil {
+		return nil, fmt.Errorf("could not encrypt '%s': %w", path, err)
+	}
+	return encrypted, nil
+}
+
+// editSecretsFile lets edit change the plaintext of an encrypted file, or of a
+// new one, and encrypts the result. invalid is asked whether to edit again
+// when the result does not parse. It reports whether the file changed.
+func editSecretsFile(path string, recipients []string, edit func(path string) error, invalid func(err error) bool) (bool, error) {
+	var plaintext []byte
+	var key *secrets.Key
+	mode := fs.FileMode(utils.FilePermission)
+
+	content, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		if recipients, err = secretsRecipients(path, recipients); err != nil {
+			return false, err
+		}
+		if key, err = secrets.NewKey(recipients); err != nil {
+			return false, err
+		}
+	case err != nil:
+		return false, fmt.Errorf("could not read '%s': %w", path, err)
+	case !secrets.IsEncrypted(content):
+		return false, fmt.Errorf("'%s' is not encrypted, encrypt it first with 'maniplacer secrets encrypt -i %s'", path, path)
+	default:
+		if plaintext, key, err = decryptSecrets(path, content); err != nil {
+			return false, err
+		}
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+
+	// The plaintext only lives in a directory nobody else can read
+	dir, err := os.MkdirTemp("", "maniplacer-secrets-")
+	if err != nil {
+		return false, fmt.Errorf("could not create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmpPath := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(tmpPath, plaintext, 0600); err != nil {
+		return false, fmt.Errorf("could not write temporary file: %w", err)
+	}
+
+	for {
+		if err := edit(tmpPath); err != nil {
+			return false, fmt.Errorf("editor failed: %w", err)
+		}
+		edited, err := os.ReadFile(tmpPath)
+		if err != nil {
+			return false, fmt.Errorf("could not read edited file: %w", err)
+		}
+		if bytes.Equal(edited, plaintext) {
+			return false, nil
+		}
+
+		encrypted, err := key.Encrypt(edited, DetectConfigFormat(path).secretsFormat())
+		if err != nil {
+			if invalid(err) {
+				continue
+			}
+			return false, fmt.Errorf("changes to '%s' discarded: %w", path, err)
+		}
+		if err := os.WriteFile(path, encrypted, mode); err != nil {
+			return false, fmt.Errorf("could not write '%s': %w", path, err)
+		}
+		return true, nil
+	}
+}
+
+// runEditor opens a file in the editor of the user and waits for it to exit
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if strings.TrimSpace(editor) == "" {
+		editor = "vi"
+	}
+
+	fields := strings.Fields(editor)
+	command := exec.Command(fields[0], append(fields[1:], path)...)
+	command.Stdin, command.Stdout, command.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return command.Run()
+}
+
+// writeSecretsResult prints the result of encrypt or decrypt, or replaces
+// the file with it keeping its permissions
+func writeSecretsResult(cmd *cobra.Command, path string, content []byte, inPlace bool) error {
+	if !inPlace {
+		_, err := cmd.OutOrStdout().Write(content)
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("could not write '%s': %w", path, err)
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Wrote %s\n", path)
+	return nil
+}
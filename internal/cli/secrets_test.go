@@ -0,0 +1,349 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/dantedelordran/maniplacer/internal/secrets"
+)
+
+// setupSecretsKey makes a fresh age identity the local key
+func setupSecretsKey(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(secrets.KeyEnv, identity.String())
+	return identity
+}
+
+func TestConfigLoader_Encrypted(t *testing.T) {
+	setupSecretsKey(t)
+
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+	}{
+		{"yaml file", "config.yaml", "name: api\ndatabase:\n  password: s3cr3t\n"},
+		{"json file", "config.json", "{\n  \"name\": \"api\",\n  \"database\": {\n    \"password\": \"s3cr3t\"\n  }\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), tt.filename)
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			encrypted, err := encryptSecretsFile(configPath, nil)
+			if err != nil {
+				t.Fatalf("encryptSecretsFile() error = %v", err)
+			}
+			if err := os.WriteFile(configPath, encrypted, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			loader := &ConfigLoader{FilePath: configPath, Format: DetectConfigFormat(configPath)}
+			config, err := loader.LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if config["database"].(map[string]any)["password"] != "s3cr3t" {
+				t.Errorf("LoadConfig() = %v, want the decrypted values", config)
+			}
+
+			config["name"] = "web"
+			if err := loader.SaveConfig(config); err != nil {
+				t.Fatalf("SaveConfig() error = %v", err)
+			}
+			saved, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !secrets.IsEncrypted(saved) || strings.Contains(string(saved), "s3cr3t") {
+				t.Errorf("SaveConfig() wrote the plaintext:\n%s", saved)
+			}
+
+			reloaded, err := (&ConfigLoader{FilePath: configPath, Format: loader.Format}).LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() after save error = %v", err)
+			}
+			if reloaded["name"] != "web" {
+				t.Errorf("reloaded name = %v, want web", reloaded["name"])
+			}
+		})
+	}
+}
+
+func TestConfigLoader_EncryptedErrors(t *testing.T) {
+	setupSecretsKey(t)
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("token: abc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryptSecretsFile(configPath, nil)
+	if err != nil {
+		t.Fatalf("encryptSecretsFile() error = %v", err)
+	}
+	if err := os.WriteFile(configPath, encrypted, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saving without loading would overwrite the encrypted file with plaintext
+	loader := &ConfigLoader{FilePath: configPath, Format: FormatYAML}
+	if err := loader.SaveConfig(map[string]any{"token": "def"}); err == nil {
+		t.Error("SaveConfig() over an encrypted file that was not loaded expected an error")
+	}
+
+	setupSecretsKey(t)
+	if _, err := loader.LoadConfig(); err == nil || !strings.Contains(err.Error(), "failed to decrypt") {
+		t.Errorf("LoadConfig() with another key error = %v, want a decryption error", err)
+	}
+}
+
+func TestEncryptSecretsFile_Recipients(t *testing.T) {
+	identity := setupSecretsKey(t)
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	rules := "creation_rules:\n  - path_regex: prod/\n    age: " + other.Recipient().String() + "\n"
+	if err := os.WriteFile(filepath.Join(dir, secrets.ConfigFileName), []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		recipients []string
+		want       string
+	}{
+		{"flag", "dev/config.yaml", []string{other.Recipient().String()}, other.Recipient().String()},
+		{"sops config", "prod/config.yaml", nil, other.Recipient().String()},
+		{"local key", "dev/config.yaml", nil, identity.Recipient().String()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.path)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("token: abc\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			encrypted, err := encryptSecretsFile(path, tt.recipients)
+			if err != nil {
+				t.Fatalf("encryptSecretsFile() error = %v", err)
+			}
+			if !strings.Contains(string(encrypted), "recipient: "+tt.want) {
+				t.Errorf("encrypted file is not encrypted to %s:\n%s", tt.want, encrypted)
+			}
+
+			if err := os.WriteFile(path, encrypted, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := encryptSecretsFile(path, tt.recipients); err == nil {
+				t.Error("encryptSecretsFile() of an encrypted file expected an error")
+			}
+		})
+	}
+}
+
+func TestEditSecretsFile(t *testing.T) {
+	setupSecretsKey(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	write := func(content string) func(string) error {
+		return func(tmpPath string) error {
+			if filepath.Dir(tmpPath) == dir {
+				return errors.New("plaintext written next to the encrypted file")
+			}
+			return os.WriteFile(tmpPath, []byte(content), 0600)
+		}
+	}
+	neverAgain := func(error) bool { return false }
+
+	// A missing file is created encrypted
+	changed, err := editSecretsFile(path, nil, write("token: abc\n"), neverAgain)
+	if err != nil || !changed {
+		t.Fatalf("editSecretsFile() new file = %v, %v", changed, err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !secrets.IsEncrypted(content) {
+		t.Fatalf("created file is not encrypted:\n%s", content)
+	}
+
+	// Unchanged content leaves the file alone
+	var seen string
+	unchanged := func(tmpPath string) error {
+		b, err := os.ReadFile(tmpPath)
+		seen = string(b)
+		return err
+	}
+	if changed, err := editSecretsFile(path, nil, unchanged, neverAgain); err != nil || changed {
+		t.Errorf("editSecretsFile() without changes = %v, %v", changed, err)
+	}
+	if seen != "token: abc\n" {
+		t.Errorf("editor got %q, want the plaintext", seen)
+	}
+
+	// An invalid edit is offered again, then fixed
+	attempts := 0
+	edit := func(tmpPath string) error {
+		attempts++
+		if attempts == 1 {
+			return write("token: [abc\n")(tmpPath)
+		}
+		return write("token: def\n")(tmpPath)
+	}
+	if changed, err := editSecretsFile(path, nil, edit, func(error) bool { return true }); err != nil || !changed {
+		t.Fatalf("editSecretsFile() retry = %v, %v", changed, err)
+	}
+	if attempts != 2 {
+		t.Errorf("editor ran %d times, want 2", attempts)
+	}
+
+	config, err := (&ConfigLoader{FilePath: path, Format: FormatYAML}).LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config["token"] != "def" {
+		t.Errorf("token = %v, want def", config["token"])
+	}
+
+	// Declining to edit again discards the changes
+	before, _ := os.ReadFile(path)
+	if _, err := editSecretsFile(path, nil, write("token: [\n"), neverAgain); err == nil {
+		t.Error("editSecretsFile() with an invalid edit expected an error")
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Error("discarded edit changed the file")
+	}
+
+	// Plaintext files must be encrypted first
+	plainPath := filepath.Join(dir, "plain.yaml")
+	if err := os.WriteFile(plainPath, []byte("token: abc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := editSecretsFile(plainPath, nil, write("token: def\n"), neverAgain); err == nil || !strings.Contains(err.Error(), "secrets encrypt") {
+		t.Errorf("editSecretsFile() of a plaintext file error = %v, want a hint to encrypt it", err)
+	}
+}
+
+func TestSeedRepoConfig_Encrypted(t *testing.T) {
+	setupSecretsKey(t)
+
+	tests := []struct {
+		filename string
+		content  string
+	}{
+		{"config.yaml", "name: web\n# Database credentials\ndatabase:\n  password: s3cr3t\n"},
+		{"config.json", "{\n  \"name\": \"web\",\n  \"database\": {\n    \"password\": \"s3cr3t\"\n  }\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			baseDir := t.TempDir()
+			configPath := filepath.Join(baseDir, "repo", tt.filename)
+			if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			encrypted, err := encryptSecretsFile(configPath, nil)
+			if err != nil {
+				t.Fatalf("encryptSecretsFile() error = %v", err)
+			}
+			if err := os.WriteFile(configPath, encrypted, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			values := map[string]any{"name": "api", "image": "repo/api:1.0", "port": 8080}
+			if err := seedRepoConfig(io.Discard, baseDir, "repo", values); err != nil {
+				t.Fatalf("seedRepoConfig() error = %v", err)
+			}
+			seeded, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(seeded), "repo/api:1.0") {
+				t.Errorf("seeded value written in plaintext:\n%s", seeded)
+			}
+
+			// Only the MAC and timestamp of the existing lines change
+			kept := strings.Split(string(seeded), "\n")
+			for _, line := range strings.Split(string(encrypted), "\n") {
+				if strings.Contains(line, "mac") || strings.Contains(line, "lastmodified") {
+					continue
+				}
+				if !slices.Contains(kept, line) {
+					t.Errorf("line %q of the encrypted file was rewritten:\n%s", line, seeded)
+				}
+			}
+
+			config, err := (&ConfigLoader{FilePath: configPath, Format: DetectConfigFormat(configPath)}).LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if config["name"] != "web" || config["image"] != "repo/api:1.0" || fmt.Sprint(config["port"]) != "8080" {
+				t.Errorf("seeded config = %v", config)
+			}
+		})
+	}
+}
+
+func TestLoadChartValues_Encrypted(t *testing.T) {
+	setupSecretsKey(t)
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte("password: s3cr3t\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryptSecretsFile(configPath, nil)
+	if err != nil {
+		t.Fatalf("encryptSecretsFile() error = %v", err)
+	}
+	if err := os.WriteFile(configPath, encrypted, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := &ConfigLoader{FilePath: configPath, Format: FormatYAML}
+	if config, err := loadChartValues(loader, false); err == nil || config != nil {
+		t.Fatalf("loadChartValues() of an encrypted config = %v, %v, want an error", config, err)
+	}
+
+	// Only an explicit opt-in writes the decrypted values to the chart
+	config, err := loadChartValues(loader, true)
+	if err != nil {
+		t.Fatalf("loadChartValues() with plaintext error = %v", err)
+	}
+	chartDir := filepath.Join(dir, "charts", "app")
+	chart := &helmChart{Meta: helmChartMeta{APIVersion: "v2", Name: "app", Type: "application", Version: "0.1.0"}, Values: config}
+	if err := chart.write(chartDir); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	values, err := os.ReadFile(filepath.Join(chartDir, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(values), "s3cr3t") {
+		t.Errorf("values.yaml = %s, want the decrypted values", values)
+	}
+}
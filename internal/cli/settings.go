@@ -0,0 +1,270 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/dantedelordran/maniplacer/internal/lint"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// repoSettingsFileName is the optional file of a repo holding the settings
+// generate applies to every rendered object
+const repoSettingsFileName = "settings.yaml"
+
+// namespaceSettings are the settings applied to the objects rendered for one namespace
+type namespaceSettings struct {
+	CommonLabels      map[string]string        `yaml:"commonLabels,omitempty"`
+	CommonAnnotations map[string]string        `yaml:"commonAnnotations,omitempty"`
+	IncludeSelectors  *bool                    `yaml:"includeSelectors,omitempty"` // Also add the common labels to selectors
+	Namespace         string                   `yaml:"namespace,omitempty"`        // Forced metadata.namespace of objects declaring one
+	Images            []imageOverride          `yaml:"images,omitempty"`
+	Lint              map[string]lint.Severity `yaml:"lint,omitempty"` // Severity of lint rules, by rule ID
+}
+
+// repoSettings is the content of a repo settings file: defaults for every
+// namespace, and per-namespace overrides
+type repoSettings struct {
+	namespaceSettings `yaml:",inline"`
+	Namespaces        map[string]namespaceSettings `yaml:"namespaces,omitempty"`
+}
+
+// loadRepoSettings reads a repo settings file. A missing file means no settings.
+func loadRepoSettings(path string) (repoSettings, error) {
+	var settings repoSettings
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, fmt.Errorf("could not read settings: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&settings); err != nil && !errors.Is(err, io.EOF) {
+		return settings, fmt.Errorf("could not parse settings: %w", err)
+	}
+
+	if err := settings.validate(); err != nil {
+		return settings, fmt.Errorf("invalid settings: %w", err)
+	}
+	return settings, nil
+}
+
+// forNamespace merges the overrides of a namespace over the repo defaults.
+// Labels, annotations and lint severities are merged key by key and images by name, the other
+// settings replace the defaults.
+func (s repoSettings) forNamespace(namespace string) namespaceSettings {
+	merged := namespaceSettings{
+		CommonLabels:      maps.Clone(s.CommonLabels),
+		CommonAnnotations: maps.Clone(s.CommonAnnotations),
+		IncludeSelectors:  s.IncludeSelectors,
+		Namespace:         s.Namespace,
+		Images:            slices.Clone(s.Images),
+		Lint:              maps.Clone(s.Lint),
+	}
+
+	override, ok := s.Namespaces[namespace]
+	if !ok {
+		return merged
+	}
+	if len(override.CommonLabels) > 0 && merged.CommonLabels == nil {
+		merged.CommonLabels = make(map[string]string)
+	}
+	maps.Copy(merged.CommonLabels, override.CommonLabels)
+	if len(override.CommonAnnotations) > 0 && merged.CommonAnnotations == nil {
+		merged.CommonAnnotations = make(map[string]string)
+	}
+	maps.Copy(merged.CommonAnnotations, override.CommonAnnotations)
+	if override.IncludeSelectors != nil {
+		merged.IncludeSelectors = override.IncludeSelectors
+	}
+	if override.Namespace != "" {
+		merged.Namespace = override.Namespace
+	}
+	merged.Images = mergeImageOverrides(merged.Images, override.Images)
+	if len(override.Lint) > 0 && merged.Lint == nil {
+		merged.Lint = make(map[string]lint.Severity)
+	}
+	maps.Copy(merged.Lint, override.Lint)
+	return merged
+}
+
+func (s repoSettings) validate() error {
+	if err := s.namespaceSettings.validate(); err != nil {
+		return err
+	}
+
+	names := slices.Sorted(maps.Keys(s.Namespaces))
+	for _, name := range names {
+		if err := s.Namespaces[name].validate(); err != nil {
+			return fmt.Errorf("namespaces.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s namespaceSettings) validate() error {
+	for _, key := range slices.Sorted(maps.Keys(s.CommonLabels)) {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("commonLabels: invalid key '%s': %s", key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(s.CommonLabels[key]); len(errs) > 0 {
+			return fmt.Errorf("commonLabels: invalid value of '%s': %s", key, strings.Join(errs, ", "))
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(s.CommonAnnotations)) {
+		if errs := validation.IsQualifiedName(strings.ToLower(key)); len(errs) > 0 {
+			return fmt.Errorf("commonAnnotations: invalid key '%s': %s", key, strings.Join(errs, ", "))
+		}
+	}
+	for i, image := range s.Images {
+		if err := image.validate(); err != nil {
+			return fmt.Errorf("images[%d]: %w", i, err)
+		}
+	}
+	// Rule IDs are checked when linting, project policies are not known here
+	for _, id := range slices.Sorted(maps.Keys(s.Lint)) {
+		if _, err := lint.ParseSeverity(string(s.Lint[id])); err != nil {
+			return fmt.Errorf("lint: rule '%s': %w", id, err)
+		}
+	}
+	if s.Namespace != "" {
+		if errs := validation.IsDNS1123Label(s.Namespace); len(errs) > 0 {
+			return fmt.Errorf("namespace: invalid name '%s': %s", s.Namespace, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// selectorPaths are the label selectors of each kind that get the common
+// labels when includeSelectors is set. Job selectors are generated by the API
+// server and left alone.
+var selectorPaths = map[string][]string{
+	"DaemonSet":             {"spec", "selector", "matchLabels"},
+	"Deployment":            {"spec", "selector", "matchLabels"},
+	"PodDisruptionBudget":   {"spec", "selector", "matchLabels"},
+	"ReplicaSet":            {"spec", "selector", "matchLabels"},
+	"ReplicationController": {"spec", "selector"},
+	"Service":               {"spec", "selector"},
+	"StatefulSet":           {"spec", "selector", "matchLabels"},
+}
+
+// isEmpty reports whether injectSettings leaves rendered objects untouched
+func (s namespaceSettings) isEmpty() bool {
+	return len(s.CommonLabels) == 0 && len(s.CommonAnnotations) == 0 && s.Namespace == ""
+}
+
+// injectSettings adds the common labels and annotations of the settings to
+// every rendered object and its pod template, and forces the namespace of
+// objects declaring one. Values from the settings win over the templates.
+func injectSettings(manifests []renderedManifest, settings namespaceSettings) ([]renderedManifest, error) {
+	if settings.isEmpty() {
+		return manifests, nil
+	}
+	return rewriteObjects(manifests, func(_ string, obj *unstructured.Unstructured) (bool, error) {
+		return settings.inject(obj.Object, obj.GetKind()), nil
+	})
+}
+
+// inject applies the settings to one object, reporting whether it changed
+func (s namespaceSettings) inject(object map[string]any, kind string) bool {
+	changed := mergeStringMap(object, s.CommonLabels, "metadata", "labels")
+	changed = mergeStringMap(object, s.CommonAnnotations, "metadata", "annotations") || changed
+
+	for _, path := range lint.PodTemplatePaths(kind) {
+		if _, found, _ := unstructured.NestedFieldNoCopy(object, path[:len(path)-1]...); !found {
+			continue
+		}
+		changed = mergeStringMap(object, s.CommonLabels, append(slices.Clone(path), "labels")...) || changed
+		changed = mergeStringMap(object, s.CommonAnnotations, append(slices.Clone(path), "annotations")...) || changed
+	}
+
+	if path, ok := selectorPaths[kind]; ok && s.IncludeSelectors != nil && *s.IncludeSelectors {
+		// A Service without a selector is deliberately selectorless, keep it that way
+		if _, found, _ := unstructured.NestedFieldNoCopy(object, path...); found || kind != "Service" {
+			changed = mergeStringMap(object, s.CommonLabels, path...) || changed
+		}
+	}
+
+	if s.Namespace == "" {
+		return changed
+	}
+
+	// ServiceAccounts bound without a namespace live in the forced one
+	if kind == "RoleBinding" || kind == "ClusterRoleBinding" {
+		subjects, _ := object["subjects"].([]any)
+		for _, subject := range subjects {
+			subject, ok := subject.(map[string]any)
+			if !ok || subject["kind"] != "ServiceAccount" {
+				continue
+			}
+			if namespace, _ := subject["namespace"].(string); namespace == "" {
+				subject["namespace"] = s.Namespace
+				changed = true
+			}
+		}
+	}
+
+	// Only objects declaring a namespace, even an empty one, get the forced
+	// one: cluster-scoped objects declare none, and telling them apart by kind
+	// would need the API server for custom resources
+	if namespace, found, _ := unstructured.NestedString(object, "metadata", "namespace"); found && namespace != s.Namespace {
+		setNestedField(object, s.Namespace, "metadata", "namespace")
+		changed = true
+	}
+
+	return changed
+}
+
+// mergeStringMap sets every value in the map at fields of object, creating it
+// when missing, and reports whether anything changed
+func mergeStringMap(object map[string]any, values map[string]string, fields ...string) bool {
+	if len(values) == 0 {
+		return false
+	}
+
+	current, _, _ := unstructured.NestedFieldNoCopy(object, fields...)
+	merged, ok := current.(map[string]any)
+	if !ok {
+		merged = make(map[string]any)
+	}
+
+	changed := !ok
+	for key, value := range values {
+		if merged[key] != value {
+			merged[key] = value
+			changed = true
+		}
+	}
+	if changed {
+		setNestedField(object, merged, fields...)
+	}
+	return changed
+}
+
+// setNestedField sets the value at fields of object, creating the parent maps
+// as needed. Unlike unstructured.SetNestedField it does not deep copy value,
+// which would panic on the int values YAML decoding produces.
+func setNestedField(object map[string]any, value any, fields ...string) {
+	m := object
+	for _, field := range fields[:len(fields)-1] {
+		next, ok := m[field].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			m[field] = next
+		}
+		m = next
+	}
+	m[fields[len(fields)-1]] = value
+}
@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadRepoSettings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, repoSettingsFileName)
+	writeTestFiles(t, dir, map[string]string{repoSettingsFileName: `commonLabels:
+  team: payments
+  tier: backend
+commonAnnotations:
+  owner: payments@example.com
+namespace: payments
+images:
+  - name: api
+    newName: ghcr.io/team/api
+    newTag: "1.0"
+  - name: proxy
+    newTag: v1.30
+namespaces:
+  production:
+    images:
+      - name: api
+        digest: sha256:abc
+    commonLabels:
+      tier: critical
+    includeSelectors: true
+    namespace: payments-prod
+`})
+
+	settings, err := loadRepoSettings(path)
+	if err != nil {
+		t.Fatalf("loadRepoSettings() error = %v", err)
+	}
+
+	dev := settings.forNamespace("dev")
+	if dev.Namespace != "payments" || dev.CommonLabels["tier"] != "backend" || dev.IncludeSelectors != nil {
+		t.Errorf("forNamespace(dev) = %+v", dev)
+	}
+
+	prod := settings.forNamespace("production")
+	if prod.Namespace != "payments-prod" || prod.CommonLabels["tier"] != "critical" || prod.CommonLabels["team"] != "payments" ||
+		prod.CommonAnnotations["owner"] != "payments@example.com" || prod.IncludeSelectors == nil || !*prod.IncludeSelectors {
+		t.Errorf("forNamespace(production) = %+v", prod)
+	}
+	wantImages := []imageOverride{{Name: "api", Digest: "sha256:abc"}, {Name: "proxy", NewTag: "v1.30"}}
+	if !slices.Equal(prod.Images, wantImages) {
+		t.Errorf("forNamespace(production).Images = %+v, want %+v", prod.Images, wantImages)
+	}
+	if settings.CommonLabels["tier"] != "backend" || settings.Images[0].NewTag != "1.0" {
+		t.Error("forNamespace() changed the repo defaults")
+	}
+
+	if settings, err := loadRepoSettings(filepath.Join(dir, "missing.yaml")); err != nil || !settings.forNamespace("dev").isEmpty() {
+		t.Errorf("loadRepoSettings() on a missing file = %+v, %v, want no settings", settings, err)
+	}
+}
+
+func TestLoadRepoSettingsErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":       "commonLabel:\n  team: payments\n",
+		"invalid label key":   "commonLabels:\n  'team name': payments\n",
+		"invalid label value": "commonLabels:\n  team: 'payments team'\n",
+		"invalid namespace":   "namespaces:\n  dev:\n    namespace: Payments_Dev\n",
+		"unknown lint level":  "lint:\n  probes: fatal\n",
+		"tagged image name":   "images:\n  - name: api:1.0\n    newTag: '2.0'\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), repoSettingsFileName)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadRepoSettings(path); err == nil {
+				t.Error("loadRepoSettings() expected an error")
+			}
+		})
+	}
+}
+
+func TestInjectSettings(t *testing.T) {
+	includeSelectors := true
+	settings := namespaceSettings{
+		CommonLabels:      map[string]string{"team": "payments"},
+		CommonAnnotations: map[string]string{"owner": "payments@example.com"},
+		IncludeSelectors:  &includeSelectors,
+		Namespace:         "payments",
+	}
+
+	manifests := []renderedManifest{
+		{Name: "deployment.yaml", Content: []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: ""
+  labels:
+    app: api
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: api
+  template:
+    metadata:
+      labels:
+        app: api
+    spec:
+      containers:
+        - name: api
+          image: api:1.0
+`)},
+		{Name: "service.yaml", Content: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: external\n  namespace: other\nspec:\n  type: ExternalName\n  externalName: example.com\n")},
+		{Name: "clusterrole.yaml", Content: []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: api
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: api
+subjects:
+  - kind: ServiceAccount
+    name: api
+  - kind: Group
+    name: admins
+`)},
+		{Name: "cronjob.yaml", Content: []byte(`apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  schedule: "0 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: cleanup
+              image: cleanup:1.0
+`)},
+		{Name: "flowschema.yaml", Content: []byte("apiVersion: flowcontrol.apiserver.k8s.io/v1\nkind: FlowSchema\nmetadata:\n  name: api\nspec:\n  matchingPrecedence: 1000\n")},
+	}
+
+	injected, err := injectSettings(manifests, settings)
+	if err != nil {
+		t.Fatalf("injectSettings() error = %v", err)
+	}
+
+	tests := []struct {
+		manifest int
+		path     []string
+		want     any
+	}{
+		{0, []string{"metadata", "namespace"}, "payments"},
+		{0, []string{"metadata", "labels", "team"}, "payments"},
+		{0, []string{"metadata", "labels", "app"}, "api"},
+		{0, []string{"metadata", "annotations", "owner"}, "payments@example.com"},
+		{0, []string{"spec", "selector", "matchLabels", "team"}, "payments"},
+		{0, []string{"spec", "template", "metadata", "labels", "team"}, "payments"},
+		{0, []string{"spec", "template", "metadata", "annotations", "owner"}, "payments@example.com"},
+		{0, []string{"spec", "replicas"}, 2},
+		{1, []string{"metadata", "namespace"}, "payments"},
+		{1, []string{"spec", "selector"}, nil},
+		{2, []string{"metadata", "namespace"}, nil},
+		{3, []string{"spec", "jobTemplate", "metadata", "labels", "team"}, "payments"},
+		{3, []string{"spec", "jobTemplate", "spec", "template", "metadata", "labels", "team"}, "payments"},
+		{3, []string{"metadata", "namespace"}, nil},
+		{4, []string{"metadata", "namespace"}, nil},
+		{4, []string{"metadata", "labels", "team"}, "payments"},
+	}
+	for _, tt := range tests {
+		t.Run(injected[tt.manifest].Name+"/"+strings.Join(tt.path, "."), func(t *testing.T) {
+			docs, err := decodeDocuments(injected[tt.manifest].Content)
+			if err != nil {
+				t.Fatalf("decodeDocuments() error = %v", err)
+			}
+			var got any = docs[0]
+			for _, field := range tt.path {
+				m, _ := got.(map[string]any)
+				got = m[field]
+			}
+			if got != tt.want {
+				t.Errorf("%s = %v, want %v", strings.Join(tt.path, "."), got, tt.want)
+			}
+		})
+	}
+
+	docs, err := decodeDocuments(injected[2].Content)
+	if err != nil {
+		t.Fatalf("decodeDocuments() error = %v", err)
+	}
+	subjects := docs[0]["subjects"].([]any)
+	if namespace := subjects[0].(map[string]any)["namespace"]; namespace != "payments" {
+		t.Errorf("ServiceAccount subject namespace = %v, want payments", namespace)
+	}
+	if namespace, ok := subjects[1].(map[string]any)["namespace"]; ok {
+		t.Errorf("Group subject namespace = %v, want none", namespace)
+	}
+}
+
+func TestInjectSettingsLeavesManifestsWithoutSettings(t *testing.T) {
+	manifests := []renderedManifest{{Name: "app.yaml", Content: []byte("# comment\nkind: ConfigMap\nmetadata:\n  name: app\n")}}
+
+	injected, err := injectSettings(manifests, namespaceSettings{})
+	if err != nil {
+		t.Fatalf("injectSettings() error = %v", err)
+	}
+	if string(injected[0].Content) != string(manifests[0].Content) {
+		t.Errorf("injectSettings() rewrote %q", injected[0].Content)
+	}
+
+	// Objects that already carry the settings are not re-encoded
+	injected, err = injectSettings(manifests, namespaceSettings{Namespace: "app"})
+	if err != nil {
+		t.Fatalf("injectSettings() error = %v", err)
+	}
+	again, err := injectSettings(injected, namespaceSettings{Namespace: "app"})
+	if err != nil {
+		t.Fatalf("injectSettings() error = %v", err)
+	}
+	if &again[0].Content[0] != &injected[0].Content[0] {
+		t.Errorf("injectSettings() re-encoded a manifest it did not change")
+	}
+}
@@ -0,0 +1,259 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/dantedelordran/maniplacer/internal/policy"
+	"github.com/dantedelordran/maniplacer/internal/utils"
+)
+
+// generateTarget is a single repo/namespace pair rendered by generate
+type generateTarget struct {
+	Repo         string
+	Namespace    string
+	TemplateDir  string
+	ManifestsDir string
+	PatchesDir   string
+	PoliciesDir  string
+	SettingsPath string
+	ConfigPath   string
+	ConfigFormat ConfigFormat
+	ConfigErr    error
+}
+
+func (t generateTarget) String() string {
+	return fmt.Sprintf("%s/%s", t.Repo, t.Namespace)
+}
+
+func newGenerateTarget(baseDir, repo, namespace string) generateTarget {
+	return generateTarget{
+		Repo:         repo,
+		Namespace:    namespace,
+		TemplateDir:  filepath.Join(baseDir, repo, "templates", namespace),
+		ManifestsDir: filepath.Join(baseDir, repo, "manifests", namespace),
+		PatchesDir:   filepath.Join(baseDir, repo, patchesDirName, namespace),
+		PoliciesDir:  filepath.Join(baseDir, policy.DirName),
+		SettingsPath: filepath.Join(baseDir, repo, repoSettingsFileName),
+	}
+}
+
+// targetSelector describes which repos and namespaces generate should render
+type targetSelector struct {
+	Repo              string
+	Namespace         string
+	AllRepos          bool
+	AllNamespaces     bool
+	RepoPatterns      []string
+	NamespacePatterns []string
+}
+
+// isMulti reports whether the selector may match more than one target
+func (s targetSelector) isMulti() bool {
+	return s.AllRepos || s.AllNamespaces || len(s.RepoPatterns) > 0 || len(s.NamespacePatterns) > 0
+}
+
+func (s targetSelector) repoPatterns() []string {
+	if len(s.RepoPatterns) > 0 {
+		return s.RepoPatterns
+	}
+	if s.AllRepos || s.Repo == "" {
+		return []string{"*"}
+	}
+	return []string{s.Repo}
+}
+
+func (s targetSelector) namespacePatterns() []string {
+	if len(s.NamespacePatterns) > 0 {
+		return s.NamespacePatterns
+	}
+	if s.AllNamespaces {
+		return []string{"*"}
+	}
+	return []string{s.Namespace}
+}
+
+// matchesAny reports whether name matches at least one glob pattern
+func matchesAny(name string, patterns []string) (bool, error) {
+	for _, pattern := range patterns {
+		ok, err := path.Match(pattern, name)
+		if err != nil {
+			return false, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// discoverTargets scans baseDir for '<repo>/templates/<namespace>/' directories
+// matching the selector, in a stable repo then namespace order
+func discoverTargets(baseDir string, selector targetSelector) ([]generateTarget, error) {
+	repoPatterns := selector.repoPatterns()
+	namespacePatterns := selector.namespacePatterns()
+
+	repos, err := os.ReadDir(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read project directory: %w", err)
+	}
+
+	var targets []generateTarget
+	for _, repo := range repos {
+		if !repo.IsDir() || strings.HasPrefix(repo.Name(), ".") {
+			continue
+		}
+		if utils.ValidateRepoName(repo.Name()) != nil {
+			continue
+		}
+
+		ok, err := matchesAny(repo.Name(), repoPatterns)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		namespaces, err := templateNamespaces(baseDir, repo.Name())
+		if err != nil {
+			// Not a maniplacer repo, or one without templates yet
+			continue
+		}
+
+		for _, namespace := range namespaces {
+			ok, err := matchesAny(namespace, namespacePatterns)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				targets = append(targets, newGenerateTarget(baseDir, repo.Name(), namespace))
+			}
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no templates found matching repos %v and namespaces %v", repoPatterns, namespacePatterns)
+	}
+
+	return targets, nil
+}
+
+// targetManifestsDir returns where the runs of a target are written. A custom
+// output directory holds the runs directly for a single target, and one
+// '<repo>/<namespace>' folder per target otherwise.
+func targetManifestsDir(baseDir, output string, target generateTarget, multi bool) string {
+	if output == "" || output == stdoutOutput {
+		return target.ManifestsDir
+	}
+
+	dir := output
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(baseDir, dir)
+	}
+	if multi {
+		dir = filepath.Join(dir, target.Repo, target.Namespace)
+	}
+	return dir
+}
+
+// templateNamespaces lists the namespaces a repo has templates for, the
+// '<repo>/templates/<namespace>/' directories
+func templateNamespaces(baseDir, repo string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(baseDir, repo, "templates"))
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces []string
+	for _, entry := range entries {
+		if entry.IsDir() && utils.ValidateNamespace(entry.Name()) == nil {
+			namespaces = append(namespaces, entry.Name())
+		}
+	}
+	return namespaces, nil
+}
+
+// resolveTargetConfigs finds the config file of every target, once per repo.
+// Failures are recorded on the target so the other targets still run.
+func resolveTargetConfigs(baseDir string, targets []generateTarget, customConfigPath, formatFlag string) {
+	type resolved struct {
+		path   string
+		format ConfigFormat
+		err    error
+	}
+	cache := make(map[string]resolved)
+
+	for i := range targets {
+		r, ok := cache[targets[i].Repo]
+		if !ok {
+			r.path, r.format, r.err = resolveConfigPath(baseDir, targets[i].Repo, customConfigPath, formatFlag)
+			cache[targets[i].Repo] = r
+		}
+		targets[i].ConfigPath = r.path
+		targets[i].ConfigFormat = r.format
+		targets[i].ConfigErr = r.err
+	}
+}
+
+// runGenerateTargets generates every target using at most concurrency workers.
+// Each target reports into its own buffer so output is not interleaved.
+func runGenerateTargets(ctx context.Context, opts generateOptions, targets []generateTarget, concurrency int) []generateResult {
+	results := make([]generateResult, len(targets))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(concurrency, len(targets)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var buf bytes.Buffer
+				results[i] = runGenerateTarget(ctx, &buf, opts, targets[i])
+				results[i].Output = buf.String()
+			}
+		}()
+	}
+
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// printGenerateSummary prints one line per target and returns how many failed
+// and how many were skipped as unchanged
+func printGenerateSummary(out io.Writer, results []generateResult) (failed, unchanged int) {
+	fmt.Fprintf(out, "\nSummary:\n")
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Fprintf(w, "  %s\tFAILED\t%s\n", result.Target, result.Err)
+		case result.Unchanged:
+			unchanged++
+			fmt.Fprintf(w, "  %s\tunchanged\t%s\n", result.Target, result.Run)
+		case result.Run.Name != "":
+			fmt.Fprintf(w, "  %s\tok\t%d manifests in %s\n", result.Target, result.Success, result.Run)
+		default:
+			fmt.Fprintf(w, "  %s\tok\t%d manifests\n", result.Target, result.Success)
+		}
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\n%d targets: %d succeeded, %d unchanged, %d failed\n", len(results), len(results)-failed-unchanged, unchanged, failed)
+	return failed, unchanged
+}
@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestRepo creates a repo with a JSON config and one template per namespace
+func writeTestRepo(t *testing.T, baseDir, repo, config string, namespaces ...string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Join(baseDir, repo), 0755); err != nil {
+		t.Fatalf("Failed to create repo: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(baseDir, repo, "config.json"), []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	for _, namespace := range namespaces {
+		dir := filepath.Join(baseDir, repo, "templates", namespace)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create templates dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("name: {{ .name }}\n"), 0644); err != nil {
+			t.Fatalf("Failed to write template: %v", err)
+		}
+	}
+}
+
+func targetNames(targets []generateTarget) []string {
+	var names []string
+	for _, target := range targets {
+		names = append(names, target.String())
+	}
+	return names
+}
+
+func TestDiscoverTargets(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestRepo(t, tmpDir, "api", `{"name": "api"}`, "dev", "prod", "staging")
+	writeTestRepo(t, tmpDir, "web", `{"name": "web"}`, "dev", "prod")
+	writeTestRepo(t, tmpDir, "worker", `{"name": "worker"}`, "default")
+	// Directories that are not repos are ignored
+	if err := os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		selector targetSelector
+		expect   []string
+	}{
+		{
+			name:     "all repos default namespace",
+			selector: targetSelector{AllRepos: true, Namespace: "default"},
+			expect:   []string{"worker/default"},
+		},
+		{
+			name:     "all namespaces of one repo",
+			selector: targetSelector{Repo: "web", AllNamespaces: true},
+			expect:   []string{"web/dev", "web/prod"},
+		},
+		{
+			name:     "everything",
+			selector: targetSelector{AllRepos: true, AllNamespaces: true},
+			expect:   []string{"api/dev", "api/prod", "api/staging", "web/dev", "web/prod", "worker/default"},
+		},
+		{
+			name:     "glob selectors",
+			selector: targetSelector{RepoPatterns: []string{"a*", "w?b"}, NamespacePatterns: []string{"prod*", "staging"}},
+			expect:   []string{"api/prod", "api/staging", "web/prod"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := discoverTargets(tmpDir, tt.selector)
+			if err != nil {
+				t.Fatalf("discoverTargets() error = %v", err)
+			}
+			got := strings.Join(targetNames(targets), ",")
+			want := strings.Join(tt.expect, ",")
+			if got != want {
+				t.Errorf("discoverTargets() = %s, want %s", got, want)
+			}
+		})
+	}
+
+	if _, err := discoverTargets(tmpDir, targetSelector{RepoPatterns: []string{"missing-*"}, AllNamespaces: true}); err == nil {
+		t.Error("Expected error when nothing matches, got nil")
+	}
+	if _, err := discoverTargets(tmpDir, targetSelector{RepoPatterns: []string{"["}, AllNamespaces: true}); err == nil {
+		t.Error("Expected error for invalid pattern, got nil")
+	}
+}
+
+func TestRunGenerateTargetsReportsPerTargetFailures(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestRepo(t, tmpDir, "api", `{"name": "api"}`, "dev", "prod")
+	writeTestRepo(t, tmpDir, "web", `{"name": "web"}`, "dev")
+	// A repo without a config file fails on its own without affecting the others
+	if err := os.Remove(filepath.Join(tmpDir, "web", "config.json")); err != nil {
+		t.Fatalf("Failed to remove config: %v", err)
+	}
+
+	targets, err := discoverTargets(tmpDir, targetSelector{AllRepos: true, AllNamespaces: true})
+	if err != nil {
+		t.Fatalf("discoverTargets() error = %v", err)
+	}
+	resolveTargetConfigs(tmpDir, targets, "", "")
+
+	results := runGenerateTargets(context.Background(), generateOptions{}, targets, 2)
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	for _, result := range results[:2] {
+		if result.Err != nil {
+			t.Errorf("%s: unexpected error %v", result.Target, result.Err)
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(result.Target.ManifestsDir, result.Run.Name, "app.yaml"))
+		if err != nil {
+			t.Errorf("%s: could not read generated manifest: %v", result.Target, err)
+			continue
+		}
+		if string(content) != "name: api\n" {
+			t.Errorf("%s: generated %q", result.Target, content)
+		}
+	}
+
+	if results[2].Err == nil {
+		t.Errorf("%s: expected config error, got nil", results[2].Target)
+	}
+
+	var buf strings.Builder
+	failed, unchanged := printGenerateSummary(&buf, results)
+	if failed != 1 || unchanged != 0 {
+		t.Errorf("printGenerateSummary() = %d failed, %d unchanged, want 1, 0", failed, unchanged)
+	}
+	if !strings.Contains(buf.String(), "web/dev") || !strings.Contains(buf.String(), "FAILED") {
+		t.Errorf("summary does not mention the failed target:\n%s", buf.String())
+	}
+}
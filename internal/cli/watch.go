@@ -0,0 +1,458 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dantedelordran/maniplacer/internal/utils"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long generate --watch waits for more changes before re-rendering
+const watchDebounce = 300 * time.Millisecond
+
+// watchSession keeps the latest rendering of a target between file changes
+type watchSession struct {
+	target   generateTarget
+	out      io.Writer
+	write    bool
+	config   map[string]any
+	settings namespaceSettings
+	images   []imageOverride // From --image, replacing the settings images of the same name
+	rendered map[string][]byte
+	failed   map[string]error
+	patched  map[string][]patchResult
+	imaged   map[string][]imageResult
+}
+
+func newWatchSession(out io.Writer, target generateTarget, write bool, images []imageOverride) *watchSession {
+	return &watchSession{
+		target:   target,
+		out:      out,
+		write:    write,
+		images:   images,
+		rendered: make(map[string][]byte),
+		failed:   make(map[string]error),
+		patched:  make(map[string][]patchResult),
+		imaged:   make(map[string][]imageResult),
+	}
+}
+
+// isWatchedTemplate reports whether a file name is a template, as opposed to
+// hidden files and editor backups that show up next to them
+func isWatchedTemplate(name string) bool {
+	return !strings.HasPrefix(name, ".") && !strings.HasSuffix(name, "~")
+}
+
+// loadConfig reads the target config and settings files, keeping the previous values on failure
+func (w *watchSession) loadConfig() error {
+	loader := &ConfigLoader{
+		FilePath: w.target.ConfigPath,
+		Format:   w.target.ConfigFormat,
+	}
+
+	config, err := loader.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := ValidateConfig(config); err != nil {
+		return fmt.Errorf("configuration validation failed: %w", err)
+	}
+
+	settings, err := loadRepoSettings(w.target.SettingsPath)
+	if err != nil {
+		return err
+	}
+
+	w.config = config
+	w.settings = settings.forNamespace(w.target.Namespace)
+	return nil
+}
+
+// templateNames lists the templates currently present in the template directory
+func (w *watchSession) templateNames() ([]string, error) {
+	entries, err := os.ReadDir(w.target.TemplateDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read template directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isWatchedTemplate(entry.Name()) && !isPartialTemplate(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// update re-renders the given templates, or every template when names is nil,
+// and reports what changed since the previous rendering
+func (w *watchSession) update(ctx context.Context, names []string) {
+	if names == nil {
+		current, err := w.templateNames()
+		if err != nil {
+			fmt.Fprintf(w.out, "Error: %s\n", err)
+			return
+		}
+		// Templates that disappeared while nobody was looking are removals too
+		for name := range w.rendered {
+			if !slices.Contains(current, name) {
+				current = append(current, name)
+			}
+		}
+		for name := range w.failed {
+			if !slices.Contains(current, name) {
+				current = append(current, name)
+			}
+		}
+		names = current
+	}
+	slices.Sort(names)
+
+	partials, err := loadPartials(w.target.TemplateDir)
+	if err != nil {
+		fmt.Fprintf(w.out, "Error: %s\n", err)
+		return
+	}
+
+	patches, err := loadPatches(w.target.PatchesDir)
+	if err != nil {
+		fmt.Fprintf(w.out, "Error: %s\n", err)
+		return
+	}
+
+	changed := 0
+	for _, name := range names {
+		path := filepath.Join(w.target.TemplateDir, name)
+
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			_, wasRendered := w.rendered[name]
+			_, wasFailing := w.failed[name]
+			if wasRendered || wasFailing {
+				fmt.Fprintf(w.out, "Removed %s\n", name)
+				changed++
+			}
+			delete(w.rendered, name)
+			delete(w.failed, name)
+			delete(w.patched, name)
+			delete(w.imaged, name)
+			continue
+		}
+
+		content, err := renderTemplate(ctx, path, name, partials, w.config)
+		if err == nil {
+			manifests := []renderedManifest{{Name: name, Content: content}}
+			if manifests, err = injectSettings(manifests, w.settings); err == nil {
+				manifests, w.imaged[name], err = overrideImages(ctx, manifests, mergeImageOverrides(w.settings.Images, w.images), nil)
+			}
+			if err == nil {
+				manifests, w.patched[name], err = applyPatches(manifests, patches)
+			}
+			if err == nil {
+				content = manifests[0].Content
+			}
+		}
+		if err != nil {
+			w.failed[name] = err
+			fmt.Fprintf(w.out, "Error in %s: %s\n", name, err)
+			continue
+		}
+		delete(w.failed, name)
+
+		previous, existed := w.rendered[name]
+		w.rendered[name] = content
+
+		switch {
+		case !existed:
+			fmt.Fprintf(w.out, "Rendered %s\n", name)
+			changed++
+		case string(previous) != string(content):
+			fmt.Fprintf(w.out, "Updated %s:\n%s", name, compactDiff(string(previous), string(content)))
+			changed++
+		}
+	}
+
+	if changed == 0 && len(w.failed) == 0 {
+		fmt.Fprintf(w.out, "No changes in rendered output\n")
+	}
+
+	if w.write && changed > 0 {
+		w.writeRun()
+	}
+}
+
+// reportPolicies prints the findings of the project policies on the current rendering
+func (w *watchSession) reportPolicies() {
+	findings, err := checkPolicies(w.target.PoliciesDir, w.manifests(), w.settings.Lint)
+	if err != nil {
+		fmt.Fprintf(w.out, "Error: %s\n", err)
+		return
+	}
+	if len(findings) == 0 {
+		fmt.Fprintf(w.out, "No policy findings\n")
+	}
+	for _, finding := range findings {
+		fmt.Fprintf(w.out, "Policy: %s\n", formatFinding(finding))
+	}
+}
+
+// manifests returns the current rendering sorted by file name
+func (w *watchSession) manifests() []renderedManifest {
+	var manifests []renderedManifest
+	for name, content := range w.rendered {
+		manifests = append(manifests, renderedManifest{Name: name, Content: content})
+	}
+	slices.SortFunc(manifests, func(a, b renderedManifest) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return manifests
+}
+
+// metadata describes the current rendering, merging the objects each patch
+// and image override changed across templates
+func (w *watchSession) metadata() runMetadata {
+	metadata := runMetadata{Repo: w.target.Repo, Namespace: w.target.Namespace}
+
+	names := make([]string, 0, len(w.patched))
+	for name := range w.patched {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		for _, result := range w.patched[name] {
+			i := slices.IndexFunc(metadata.Patches, func(other patchResult) bool {
+				return other.File == result.File && other.Document == result.Document
+			})
+			if i < 0 {
+				i = len(metadata.Patches)
+				metadata.Patches = append(metadata.Patches, patchResult{File: result.File, Document: result.Document, Type: result.Type, Objects: []string{}})
+			}
+			metadata.Patches[i].Objects = append(metadata.Patches[i].Objects, result.Objects...)
+		}
+		for _, result := range w.imaged[name] {
+			i := slices.IndexFunc(metadata.Images, func(other imageResult) bool {
+				return other.Original == result.Original && other.Image == result.Image
+			})
+			if i < 0 {
+				i = len(metadata.Images)
+				metadata.Images = append(metadata.Images, imageResult{Original: result.Original, Image: result.Image, Objects: []string{}})
+			}
+			metadata.Images[i].Objects = append(metadata.Images[i].Objects, result.Objects...)
+		}
+	}
+	return metadata
+}
+
+// writeRun stores the current rendering as a new run, unless a template is
+// failing or the output matches the latest run
+func (w *watchSession) writeRun() {
+	if len(w.failed) > 0 {
+		fmt.Fprintf(w.out, "Not writing a run: %d templates are failing\n", len(w.failed))
+		return
+	}
+
+	manifests := w.manifests()
+	if latest, unchanged := latestRunMatches(w.target.ManifestsDir, manifests); unchanged {
+		fmt.Fprintf(w.out, "Output matches run %s, nothing written\n", latest)
+		return
+	}
+
+	metadata := w.metadata()
+	findings, err := checkPolicies(w.target.PoliciesDir, manifests, w.settings.Lint)
+	if err != nil {
+		fmt.Fprintf(w.out, "Error: %s\n", err)
+		return
+	}
+	metadata.PolicyFindings = findings
+	for _, finding := range findings {
+		fmt.Fprintf(w.out, "Policy: %s\n", formatFinding(finding))
+	}
+
+	metadataFile, err := metadata.manifest()
+	if err != nil {
+		fmt.Fprintf(w.out, "Error: %s\n", err)
+		return
+	}
+
+	outputDir, _, err := WriteRun(w.target.ManifestsDir, append(manifests, metadataFile), time.Now())
+	if err != nil {
+		fmt.Fprintf(w.out, "Error: could not write manifests: %s\n", err)
+		return
+	}
+	fmt.Fprintf(w.out, "Output directory: %s\n", outputDir)
+}
+
+// watchClosestDir watches dir, or its closest existing parent while dir does
+// not exist, so that its creation is noticed
+func watchClosestDir(watcher *fsnotify.Watcher, dir string) error {
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			if err := watcher.Add(dir); err != nil {
+				return fmt.Errorf("could not watch '%s': %w", dir, err)
+			}
+			return nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("no existing directory to watch for '%s'", dir)
+		}
+		dir = parent
+	}
+}
+
+// concernsDir reports whether a change to path affects the content of dir:
+// path is dir, a file in it, or a parent of dir created or removed
+func concernsDir(path, dir string) bool {
+	return path == dir || filepath.Dir(path) == dir || strings.HasPrefix(dir, path+string(filepath.Separator))
+}
+
+// watchTarget renders a target and re-renders it whenever one of its templates,
+// its config file or its patches change, and checks it again when the
+// policies change, until ctx is cancelled
+func watchTarget(ctx context.Context, out io.Writer, target generateTarget, write bool, images []imageOverride) error {
+	logger := utils.LoggerFromContext(ctx)
+
+	if target.ConfigErr != nil {
+		return target.ConfigErr
+	}
+	if _, err := os.Stat(target.TemplateDir); err != nil {
+		return fmt.Errorf("template directory '%s' not found: %w", target.TemplateDir, err)
+	}
+
+	session := newWatchSession(out, target, write, images)
+	if err := session.loadConfig(); err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("could not start file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// The config directory is watched rather than the file itself, editors
+	// often save by replacing the file which would drop a direct watch
+	configPath := filepath.Clean(target.ConfigPath)
+	settingsPath := filepath.Clean(target.SettingsPath)
+	dirs := []string{target.TemplateDir, filepath.Dir(configPath)}
+	if !slices.Contains(dirs, filepath.Dir(settingsPath)) {
+		dirs = append(dirs, filepath.Dir(settingsPath))
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("could not watch '%s': %w", dir, err)
+		}
+	}
+	patchesDir := filepath.Clean(target.PatchesDir)
+	policiesDir := filepath.Clean(target.PoliciesDir)
+	for _, dir := range []string{patchesDir, policiesDir} {
+		if err := watchClosestDir(watcher, dir); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("watching for changes", "templates", target.TemplateDir, "config", configPath)
+	fmt.Fprintf(out, "Watching %s and %s for changes (Ctrl+C to stop)\n", target.TemplateDir, configPath)
+	session.update(ctx, nil)
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	pending := make(map[string]bool)
+	configChanged := false
+	partialChanged := false
+	patchesChanged := false
+	policiesChanged := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintf(out, "Stopped watching\n")
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			name := filepath.Clean(event.Name)
+			switch {
+			case name == configPath || name == settingsPath:
+				configChanged = true
+			case filepath.Dir(name) == filepath.Clean(target.TemplateDir) && isPartialTemplate(filepath.Base(name)):
+				partialChanged = true
+			case filepath.Dir(name) == filepath.Clean(target.TemplateDir) && isWatchedTemplate(filepath.Base(name)):
+				pending[filepath.Base(name)] = true
+			case concernsDir(name, patchesDir):
+				if filepath.Dir(name) == patchesDir && !isWatchedTemplate(filepath.Base(name)) {
+					continue
+				}
+				// The directory may just have been created or removed
+				if err := watchClosestDir(watcher, patchesDir); err != nil {
+					fmt.Fprintf(out, "Warning: %s\n", err)
+				}
+				patchesChanged = true
+			case concernsDir(name, policiesDir):
+				if filepath.Dir(name) == policiesDir && !isWatchedTemplate(filepath.Base(name)) {
+					continue
+				}
+				if err := watchClosestDir(watcher, policiesDir); err != nil {
+					fmt.Fprintf(out, "Warning: %s\n", err)
+				}
+				policiesChanged = true
+			default:
+				continue
+			}
+			timer.Reset(watchDebounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warn("file watcher error", "error", err)
+			fmt.Fprintf(out, "Warning: file watcher error: %s\n", err)
+
+		case <-timer.C:
+			fmt.Fprintf(out, "\n[%s] Change detected\n", time.Now().Format("15:04:05"))
+
+			if configChanged {
+				if err := session.loadConfig(); err != nil {
+					fmt.Fprintf(out, "Error: %s\n", err)
+				} else {
+					// Every template may depend on the config
+					session.update(ctx, nil)
+				}
+			} else if partialChanged || patchesChanged {
+				// Every template may use what a partial defines, and every
+				// object may be the target of a patch
+				session.update(ctx, nil)
+			} else {
+				var names []string
+				for name := range pending {
+					names = append(names, name)
+				}
+				session.update(ctx, names)
+			}
+			if policiesChanged {
+				// The rendering is the same, only its findings change
+				session.reportPolicies()
+			}
+
+			pending = make(map[string]bool)
+			configChanged = false
+			partialChanged = false
+			patchesChanged = false
+			policiesChanged = false
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompactDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		old    string
+		new    string
+		expect string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"added line", "a\nb\n", "a\nb\nc\n", "     3 + c\n"},
+		{"removed line", "a\nb\nc\n", "a\nc\n", "     2 - b\n"},
+		{"changed line", "name: api\nport: 80\n", "name: web\nport: 80\n", "     1 - name: api\n     1 + name: web\n"},
+		{"from empty", "", "a\n", "     1 + a\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := compactDiff(tt.old, tt.new)
+			if result != tt.expect {
+				t.Errorf("compactDiff() = %q, want %q", result, tt.expect)
+			}
+		})
+	}
+}
+
+func TestWatchSessionUpdate(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestRepo(t, tmpDir, "api", `{"name": "api"}`, "dev")
+
+	target := newGenerateTarget(tmpDir, "api", "dev")
+	target.ConfigPath = filepath.Join(tmpDir, "api", "config.json")
+	target.ConfigFormat = FormatJSON
+
+	var out strings.Builder
+	session := newWatchSession(&out, target, true, nil)
+	if err := session.loadConfig(); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	ctx := context.Background()
+	session.update(ctx, nil)
+	if !strings.Contains(out.String(), "Rendered app.yaml") {
+		t.Errorf("initial update output = %q", out.String())
+	}
+
+	runs, err := ListRuns(target.ManifestsDir)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected one run after the first update, got %v (err %v)", runs, err)
+	}
+
+	// A config change re-renders the template and prints the diff
+	if err := os.WriteFile(target.ConfigPath, []byte(`{"name": "web"}`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := session.loadConfig(); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	out.Reset()
+	session.update(ctx, nil)
+	if !strings.Contains(out.String(), "- name: api") || !strings.Contains(out.String(), "+ name: web") {
+		t.Errorf("update output does not contain the diff: %q", out.String())
+	}
+
+	// A broken template is reported and blocks writing a run
+	broken := filepath.Join(target.TemplateDir, "broken.yaml")
+	if err := os.WriteFile(broken, []byte("{{ Nope }}"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	out.Reset()
+	session.update(ctx, []string{"broken.yaml"})
+	if !strings.Contains(out.String(), "Error in broken.yaml") {
+		t.Errorf("update output does not report the error: %q", out.String())
+	}
+
+	// Removing it again is reported as a removal
+	if err := os.Remove(broken); err != nil {
+		t.Fatalf("Failed to remove template: %v", err)
+	}
+	out.Reset()
+	session.update(ctx, []string{"broken.yaml"})
+	if !strings.Contains(out.String(), "Removed broken.yaml") {
+		t.Errorf("update output does not report the removal: %q", out.String())
+	}
+
+	// Unchanged output does not produce another run
+	out.Reset()
+	session.update(ctx, nil)
+	if !strings.Contains(out.String(), "No changes") {
+		t.Errorf("update output = %q, want no changes", out.String())
+	}
+
+	runs, err = ListRuns(target.ManifestsDir)
+	if err != nil || len(runs) != 2 {
+		t.Errorf("expected two runs, got %v (err %v)", runs, err)
+	}
+}
+
+// syncBuffer is an output safe to read while a watch writes to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitForOutput waits until the output of a watch contains want
+func waitForOutput(t *testing.T, out *syncBuffer, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("watch output does not contain %q:\n%s", want, out.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWatchTarget_Patches(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestRepo(t, tmpDir, "api", `{"name": "api"}`, "dev")
+	writeTestFiles(t, filepath.Join(tmpDir, "api", "templates", "dev"), map[string]string{
+		"app.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .name }}\ndata:\n  level: info\n",
+	})
+
+	target := newGenerateTarget(tmpDir, "api", "dev")
+	target.ConfigPath = filepath.Join(tmpDir, "api", "config.json")
+	target.ConfigFormat = FormatJSON
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &syncBuffer{}
+	done := make(chan error, 1)
+	go func() { done <- watchTarget(ctx, out, target, false, nil) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watchTarget() error = %v", err)
+		}
+	}()
+	waitForOutput(t, out, "Rendered app.yaml")
+
+	// The patches directory does not exist yet, creating it is picked up
+	writeTestFiles(t, target.PatchesDir, map[string]string{
+		"level.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: api\ndata:\n  level: debug\n",
+	})
+	waitForOutput(t, out, "+   level: debug")
+
+	// Later edits of a patch too
+	writeTestFiles(t, target.PatchesDir, map[string]string{
+		"level.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: api\ndata:\n  level: trace\n",
+	})
+	waitForOutput(t, out, "+   level: trace")
+}
+
+func TestWatchTarget_Policies(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestRepo(t, tmpDir, "api", `{"name": "api"}`, "dev")
+	writeTestFiles(t, filepath.Join(tmpDir, "api", "templates", "dev"), map[string]string{
+		"app.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .name }}\n",
+	})
+
+	target := newGenerateTarget(tmpDir, "api", "dev")
+	target.ConfigPath = filepath.Join(tmpDir, "api", "config.json")
+	target.ConfigFormat = FormatJSON
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &syncBuffer{}
+	done := make(chan error, 1)
+	go func() { done <- watchTarget(ctx, out, target, false, nil) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watchTarget() error = %v", err)
+		}
+	}()
+	waitForOutput(t, out, "Rendered app.yaml")
+
+	// The policies directory does not exist yet, creating it is picked up
+	writeTestFiles(t, target.PoliciesDir, map[string]string{
+		"naming.yaml": "name: named\nexpression: \"object.metadata.name.startsWith('team-')\"\n",
+	})
+	waitForOutput(t, out, "Policy: ")
+
+	// Fixing the policy clears the finding
+	writeTestFiles(t, target.PoliciesDir, map[string]string{
+		"naming.yaml": "name: named\nexpression: \"object.metadata.name.startsWith('a')\"\n",
+	})
+	waitForOutput(t, out, "No policy findings")
+}
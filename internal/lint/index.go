@@ -0,0 +1,51 @@
+package lint
+
+// objectKey identifies an object of a run. The API group is left out, the
+// references rules check name their targets by kind.
+type objectKey struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// Index looks the objects being linted up by kind, namespace and name
+type Index struct {
+	objects []Object
+	byKey   map[objectKey]Object
+	byKind  map[objectKey][]Object // Name left empty
+}
+
+// NewIndex indexes a set of objects. When several objects share a kind,
+// namespace and name the first one wins.
+func NewIndex(objects []Object) *Index {
+	index := &Index{
+		objects: objects,
+		byKey:   make(map[objectKey]Object),
+		byKind:  make(map[objectKey][]Object),
+	}
+	for _, obj := range objects {
+		key := objectKey{Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}
+		if _, ok := index.byKey[key]; !ok {
+			index.byKey[key] = obj
+		}
+		kindKey := objectKey{Kind: key.Kind, Namespace: key.Namespace}
+		index.byKind[kindKey] = append(index.byKind[kindKey], obj)
+	}
+	return index
+}
+
+// Objects returns every indexed object, in the order they were read
+func (i *Index) Objects() []Object {
+	return i.objects
+}
+
+// Find returns the object of a kind with the given namespace and name
+func (i *Index) Find(kind, namespace, name string) (Object, bool) {
+	obj, ok := i.byKey[objectKey{Kind: kind, Namespace: namespace, Name: name}]
+	return obj, ok
+}
+
+// Kind returns the objects of a kind in a namespace
+func (i *Index) Kind(kind, namespace string) []Object {
+	return i.byKind[objectKey{Kind: kind, Namespace: namespace}]
+}
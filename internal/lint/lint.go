@@ -0,0 +1,252 @@
+// Package lint checks rendered Kubernetes objects against a set of rules
+package lint
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// WaiverAnnotation lists, comma separated, the rules an object is exempt from
+const WaiverAnnotation = "maniplacer.io/lint-ignore"
+
+// Severity is how serious a finding is
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+	SeverityOff     Severity = "off" // Disables a rule
+)
+
+// rank orders severities, higher is more serious
+func (s Severity) rank() int {
+	switch s {
+	case SeverityError:
+		return 3
+	case SeverityWarning:
+		return 2
+	case SeverityInfo:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// AtLeast reports whether s is as serious as threshold
+func (s Severity) AtLeast(threshold Severity) bool {
+	return s.rank() >= threshold.rank() && s != SeverityOff
+}
+
+// ParseSeverity validates a severity name
+func ParseSeverity(name string) (Severity, error) {
+	severity := Severity(strings.ToLower(name))
+	if !slices.Contains([]Severity{SeverityError, SeverityWarning, SeverityInfo, SeverityOff}, severity) {
+		return "", fmt.Errorf("unknown severity '%s' (use error, warning, info or off)", name)
+	}
+	return severity, nil
+}
+
+// Object is a rendered object and where it was read from
+type Object struct {
+	Source string // File the object was read from
+	Line   int    // Line of the file the object starts at
+	*unstructured.Unstructured
+}
+
+// ID returns 'Kind/name' of the object
+func (o Object) ID() string {
+	return fmt.Sprintf("%s/%s", o.GetKind(), o.GetName())
+}
+
+// waives reports whether the object carries a waiver for the rule
+func (o Object) waives(rule string) bool {
+	for _, waived := range strings.Split(o.GetAnnotations()[WaiverAnnotation], ",") {
+		if strings.TrimSpace(waived) == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseObjects reads every object of a YAML stream, recording the line each starts at
+func ParseObjects(source string, content []byte) ([]Object, error) {
+	var objects []Object
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", source, err)
+		}
+
+		var doc map[string]any
+		if err := node.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", source, err)
+		}
+		if len(doc) == 0 {
+			continue
+		}
+
+		line := node.Line
+		if len(node.Content) > 0 {
+			line = node.Content[0].Line
+		}
+		obj := &unstructured.Unstructured{Object: doc}
+		if obj.GetKind() == "" {
+			continue
+		}
+		objects = append(objects, Object{Source: source, Line: line, Unstructured: obj})
+	}
+
+	return objects, nil
+}
+
+// Finding is a rule violation of an object
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Source   string   `json:"source"`
+	Line     int      `json:"line"`
+	Object   string   `json:"object"`
+	Message  string   `json:"message"`
+}
+
+// Report is the outcome of linting a set of objects
+type Report struct {
+	Findings []Finding `json:"findings"`
+	Waived   int       `json:"waived"` // Findings dropped by a waiver annotation
+	rules    []Rule    // Rules the objects were checked against
+}
+
+// Count returns the number of findings of a severity
+func (r Report) Count(severity Severity) int {
+	count := 0
+	for _, finding := range r.Findings {
+		if finding.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// Fails reports whether a finding is at least as serious as threshold. An
+// 'off' threshold never fails.
+func (r Report) Fails(threshold Severity) bool {
+	if threshold == SeverityOff {
+		return false
+	}
+	return slices.ContainsFunc(r.Findings, func(f Finding) bool { return f.Severity.AtLeast(threshold) })
+}
+
+// Config changes the severity of rules, by rule ID, and adds project rules
+// checked after the built-in ones
+type Config struct {
+	Severities   map[string]Severity
+	Rules        []Rule
+	SkipBuiltins bool // Only check the project rules
+}
+
+// rules returns the built-in rules followed by the project rules
+func (c Config) rules() []Rule {
+	return append(slices.Clone(Rules()), c.Rules...)
+}
+
+// enabledRules returns the rules Run checks
+func (c Config) enabledRules() []Rule {
+	if c.SkipBuiltins {
+		return slices.Clone(c.Rules)
+	}
+	return c.rules()
+}
+
+// Validate reports rules and severities the config names that do not exist,
+// and project rules reusing an ID
+func (c Config) Validate() error {
+	seen := make(map[string]bool)
+	for _, rule := range c.rules() {
+		if seen[rule.ID] {
+			return fmt.Errorf("lint rule '%s' is defined twice", rule.ID)
+		}
+		seen[rule.ID] = true
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(c.Severities)) {
+		if !seen[id] {
+			return fmt.Errorf("unknown lint rule '%s'", id)
+		}
+		if _, err := ParseSeverity(string(c.Severities[id])); err != nil {
+			return fmt.Errorf("lint rule '%s': %w", id, err)
+		}
+	}
+	return nil
+}
+
+// severity returns the configured severity of a rule
+func (c Config) severity(rule Rule) Severity {
+	if severity, ok := c.Severities[rule.ID]; ok {
+		return severity
+	}
+	return rule.Severity
+}
+
+// Run checks every object against every enabled rule. Findings are sorted
+// by source, line and rule.
+func Run(objects []Object, config Config) (Report, error) {
+	if err := config.Validate(); err != nil {
+		return Report{}, err
+	}
+
+	index := NewIndex(objects)
+	report := Report{Findings: []Finding{}, rules: config.enabledRules()}
+	for _, rule := range report.rules {
+		severity := config.severity(rule)
+		if severity == SeverityOff {
+			continue
+		}
+
+		for _, obj := range objects {
+			messages := rule.Check(obj, index)
+			if len(messages) == 0 {
+				continue
+			}
+			if obj.waives(rule.ID) {
+				report.Waived += len(messages)
+				continue
+			}
+			for _, message := range messages {
+				report.Findings = append(report.Findings, Finding{
+					Rule:     rule.ID,
+					Severity: severity,
+					Source:   obj.Source,
+					Line:     obj.Line,
+					Object:   obj.ID(),
+					Message:  message,
+				})
+			}
+		}
+	}
+
+	slices.SortStableFunc(report.Findings, func(a, b Finding) int {
+		if c := strings.Compare(a.Source, b.Source); c != 0 {
+			return c
+		}
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return strings.Compare(a.Rule, b.Rule)
+	})
+	return report, nil
+}
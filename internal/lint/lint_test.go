@@ -0,0 +1,115 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const lintTestObjects = `# A comment before the first object
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  annotations:
+    maniplacer.io/lint-ignore: "probes, resources"
+spec:
+  template:
+    spec:
+      containers:
+        - name: api
+          image: api:latest
+---
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: api
+spec:
+  minReplicas: 4
+  maxReplicas: 2
+`
+
+func TestParseObjects(t *testing.T) {
+	objects, err := ParseObjects("app.yaml", []byte(lintTestObjects+"---\n# empty\n---\nnot: an object\n"))
+	if err != nil {
+		t.Fatalf("ParseObjects() error = %v", err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("ParseObjects() returned %d objects, want 2", len(objects))
+	}
+	if objects[0].Line != 2 || objects[1].Line != 15 {
+		t.Errorf("lines = %d, %d, want 2, 15", objects[0].Line, objects[1].Line)
+	}
+	if objects[1].ID() != "HorizontalPodAutoscaler/api" {
+		t.Errorf("ID() = %s", objects[1].ID())
+	}
+
+	if _, err := ParseObjects("bad.yaml", []byte("kind: [")); err == nil {
+		t.Error("ParseObjects() expected an error for invalid YAML")
+	}
+}
+
+func TestRun(t *testing.T) {
+	objects, err := ParseObjects("app.yaml", []byte(lintTestObjects))
+	if err != nil {
+		t.Fatalf("ParseObjects() error = %v", err)
+	}
+
+	report, err := Run(objects, Config{Severities: map[string]Severity{"no-latest-tag": SeverityWarning, "run-as-non-root": SeverityOff}})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var got []string
+	for _, finding := range report.Findings {
+		got = append(got, finding.Rule+"="+string(finding.Severity))
+	}
+	want := "no-latest-tag=warning,hpa-min-max=error"
+	if strings.Join(got, ",") != want {
+		t.Errorf("findings = %s, want %s", strings.Join(got, ","), want)
+	}
+	if report.Waived != 2 {
+		t.Errorf("Waived = %d, want 2", report.Waived)
+	}
+	if !report.Fails(SeverityError) || !report.Fails(SeverityWarning) || report.Fails(SeverityOff) {
+		t.Error("Fails() does not follow the threshold")
+	}
+
+	for _, config := range []Config{
+		{Severities: map[string]Severity{"no-such-rule": SeverityError}},
+		{Severities: map[string]Severity{"probes": "fatal"}},
+	} {
+		if _, err := Run(objects, config); err == nil {
+			t.Errorf("Run() with %v expected an error", config.Severities)
+		}
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	report := Report{Findings: []Finding{
+		{Rule: "probes", Severity: SeverityInfo, Source: "manifests/app.yaml", Line: 3, Object: "Deployment/api", Message: "container 'api' has no livenessProbe"},
+	}}
+
+	var out bytes.Buffer
+	if err := Write(&out, report, FormatSARIF); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("SARIF output is not JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != len(Rules()) {
+		t.Fatalf("SARIF log = %+v", log)
+	}
+	result := log.Runs[0].Results[0]
+	location := result.Locations[0].PhysicalLocation
+	if result.RuleID != "probes" || result.Level != "note" || location.ArtifactLocation.URI != "manifests/app.yaml" || location.Region.StartLine != 3 {
+		t.Errorf("SARIF result = %+v", result)
+	}
+
+	if err := Write(&out, report, "xml"); err == nil {
+		t.Error("Write() expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,159 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Output formats of a report
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatSARIF = "sarif"
+)
+
+// Write writes a report in the given format
+func Write(w io.Writer, report Report, format string) error {
+	switch format {
+	case FormatText:
+		return WriteText(w, report)
+	case FormatJSON:
+		return writeIndentedJSON(w, report)
+	case FormatSARIF:
+		return WriteSARIF(w, report)
+	default:
+		return fmt.Errorf("unsupported lint format '%s'. Supported formats: text, json, sarif", format)
+	}
+}
+
+// WriteText writes one line per finding followed by a summary
+func WriteText(w io.Writer, report Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, finding := range report.Findings {
+		fmt.Fprintf(tw, "%s:%d\t%s\t%s\t%s\t%s\n", finding.Source, finding.Line, finding.Severity, finding.Rule, finding.Object, finding.Message)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	summary := fmt.Sprintf("%d findings: %d errors, %d warnings, %d info", len(report.Findings),
+		report.Count(SeverityError), report.Count(SeverityWarning), report.Count(SeverityInfo))
+	if report.Waived > 0 {
+		summary += fmt.Sprintf(" (%d waived)", report.Waived)
+	}
+	_, err := fmt.Fprintf(w, "%s\n", summary)
+	return err
+}
+
+func writeIndentedJSON(w io.Writer, value any) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// SARIF 2.1.0 types, limited to what code scanning tools read
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID                   string             `json:"id"`
+		ShortDescription     sarifMessage       `json:"shortDescription"`
+		DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+	}
+	sarifConfiguration struct {
+		Level string `json:"level"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           sarifRegion           `json:"region"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine int `json:"startLine"`
+	}
+)
+
+// sarifLevel maps a severity to a SARIF result level
+func sarifLevel(severity Severity) string {
+	switch severity {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// WriteSARIF writes a report as a SARIF 2.1.0 log, for CI code scanning
+func WriteSARIF(w io.Writer, report Report) error {
+	driver := sarifDriver{
+		Name:           "maniplacer",
+		InformationURI: "https://github.com/dantedelordran/maniplacer",
+		Rules:          []sarifRule{},
+	}
+	rules := report.rules
+	if rules == nil {
+		rules = Rules()
+	}
+	for _, rule := range rules {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   rule.ID,
+			ShortDescription:     sarifMessage{Text: rule.Description},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(rule.Severity)},
+		})
+	}
+
+	results := []sarifResult{}
+	for _, finding := range report.Findings {
+		results = append(results, sarifResult{
+			RuleID:  finding.Rule,
+			Level:   sarifLevel(finding.Severity),
+			Message: sarifMessage{Text: fmt.Sprintf("%s: %s", finding.Object, finding.Message)},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: finding.Source},
+				Region:           sarifRegion{StartLine: max(finding.Line, 1)},
+			}}},
+		})
+	}
+
+	return writeIndentedJSON(w, sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	})
+}
@@ -0,0 +1,362 @@
+package lint
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// localRef returns the kind and name of a reference, defaulting the kind, and
+// whether it points to the namespace of obj
+func localRef(obj Object, ref map[string]any, defaultKind string) (kind, name string, ok bool) {
+	kind, _ = ref["kind"].(string)
+	if kind == "" {
+		kind = defaultKind
+	}
+	name, _ = ref["name"].(string)
+	if namespace, _ := ref["namespace"].(string); namespace != "" && namespace != obj.GetNamespace() {
+		return "", "", false
+	}
+	return kind, name, name != ""
+}
+
+// listOfMaps returns the maps of a list field
+func listOfMaps(value any) []map[string]any {
+	list, _ := value.([]any)
+	var items []map[string]any
+	for _, item := range list {
+		if m, ok := item.(map[string]any); ok {
+			items = append(items, m)
+		}
+	}
+	return items
+}
+
+// serviceHasPort reports whether a Service defines a port, by number or name
+func serviceHasPort(service Object, port any) bool {
+	ports, _, _ := unstructured.NestedFieldNoCopy(service.Object, "spec", "ports")
+	for _, servicePort := range listOfMaps(ports) {
+		if name, ok := port.(string); ok {
+			if servicePort["name"] == name {
+				return true
+			}
+			continue
+		}
+		number, _ := toInt(port)
+		if value, ok := toInt(servicePort["port"]); ok && value == number {
+			return true
+		}
+	}
+	return false
+}
+
+// checkServiceRef reports a Service reference missing from the run, or naming
+// a port the Service does not define
+func checkServiceRef(obj Object, index *Index, field, name string, port any) []string {
+	service, ok := index.Find("Service", obj.GetNamespace(), name)
+	if !ok {
+		return []string{fmt.Sprintf("%s Service/%s is not part of the run", field, name)}
+	}
+	if port != nil && !serviceHasPort(service, port) {
+		return []string{fmt.Sprintf("%s Service/%s has no port %v", field, name, port)}
+	}
+	return nil
+}
+
+func checkDanglingRefs(obj Object, index *Index) []string {
+	var messages []string
+	missing := func(field, kind, name string) {
+		if _, ok := index.Find(kind, obj.GetNamespace(), name); !ok {
+			messages = append(messages, fmt.Sprintf("%s %s/%s is not part of the run", field, kind, name))
+		}
+	}
+
+	switch obj.GetKind() {
+	case "HorizontalPodAutoscaler":
+		ref, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "scaleTargetRef")
+		if fields, ok := ref.(map[string]any); ok {
+			if kind, name, ok := localRef(obj, fields, ""); ok && kind != "" {
+				missing("scaleTargetRef", kind, name)
+			}
+		}
+
+	case "HealthCheckPolicy":
+		ref, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "targetRef")
+		if fields, ok := ref.(map[string]any); ok {
+			if kind, name, ok := localRef(obj, fields, "Service"); ok {
+				missing("targetRef", kind, name)
+			}
+		}
+
+	case "HTTPRoute":
+		parents, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "parentRefs")
+		for _, parent := range listOfMaps(parents) {
+			if kind, name, ok := localRef(obj, parent, "Gateway"); ok && kind == "Gateway" {
+				missing("parentRef", kind, name)
+			}
+		}
+
+		rules, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "rules")
+		for _, rule := range listOfMaps(rules) {
+			for _, backend := range listOfMaps(rule["backendRefs"]) {
+				group, _ := backend["group"].(string)
+				kind, name, ok := localRef(obj, backend, "Service")
+				if !ok || group != "" || kind != "Service" {
+					continue
+				}
+				messages = append(messages, checkServiceRef(obj, index, "backendRef", name, backend["port"])...)
+			}
+		}
+
+	case "Ingress":
+		var backends []map[string]any
+		if backend, ok := unstructuredField(obj.Object, "spec", "defaultBackend").(map[string]any); ok {
+			backends = append(backends, backend)
+		}
+		rules, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "rules")
+		for _, rule := range listOfMaps(rules) {
+			paths, _, _ := unstructured.NestedFieldNoCopy(rule, "http", "paths")
+			for _, path := range listOfMaps(paths) {
+				if backend, ok := path["backend"].(map[string]any); ok {
+					backends = append(backends, backend)
+				}
+			}
+		}
+		for _, backend := range backends {
+			service, ok := backend["service"].(map[string]any)
+			if !ok {
+				continue
+			}
+			name, _ := service["name"].(string)
+			if name == "" {
+				continue
+			}
+			var port any
+			if number, ok := toInt(unstructuredField(service, "port", "number")); ok {
+				port = number
+			} else if portName, ok := unstructuredField(service, "port", "name").(string); ok {
+				port = portName
+			}
+			messages = append(messages, checkServiceRef(obj, index, "backend", name, port)...)
+		}
+	}
+
+	return dedupe(messages)
+}
+
+// unstructuredField returns a nested field, nil when it is missing
+func unstructuredField(obj map[string]any, path ...string) any {
+	value, _, _ := unstructured.NestedFieldNoCopy(obj, path...)
+	return value
+}
+
+// dedupe drops repeated messages, keeping the first of each
+func dedupe(messages []string) []string {
+	var unique []string
+	for _, message := range messages {
+		if !slices.Contains(unique, message) {
+			unique = append(unique, message)
+		}
+	}
+	return unique
+}
+
+// podTemplateLabels returns the labels of the pods a workload creates
+func podTemplateLabels(obj Object) (map[string]string, bool) {
+	path, ok := PodSpecPaths[obj.GetKind()]
+	if !ok {
+		return nil, false
+	}
+	if obj.GetKind() == "Pod" {
+		return obj.GetLabels(), true
+	}
+
+	metadataPath := append(slices.Clone(path[:len(path)-1]), "metadata", "labels")
+	fields, _ := unstructuredField(obj.Object, metadataPath...).(map[string]any)
+	podLabels := make(map[string]string, len(fields))
+	for key, value := range fields {
+		podLabels[key] = fmt.Sprint(value)
+	}
+	return podLabels, true
+}
+
+// serviceSelector returns the selector of a Service that selects pods
+func serviceSelector(obj Object) (labels.Set, bool) {
+	if obj.GetKind() != "Service" {
+		return nil, false
+	}
+	if serviceType, _ := unstructuredField(obj.Object, "spec", "type").(string); serviceType == "ExternalName" {
+		return nil, false
+	}
+	fields, _ := unstructuredField(obj.Object, "spec", "selector").(map[string]any)
+	if len(fields) == 0 {
+		return nil, false
+	}
+	selector := make(labels.Set, len(fields))
+	for key, value := range fields {
+		selector[key] = fmt.Sprint(value)
+	}
+	return selector, true
+}
+
+// selectedWorkloads returns the workloads of the run whose pods a Service selects
+func selectedWorkloads(service Object, selector labels.Set, index *Index) []Object {
+	var selected []Object
+	for _, kind := range slices.Sorted(maps.Keys(PodSpecPaths)) {
+		for _, workload := range index.Kind(kind, service.GetNamespace()) {
+			podLabels, _ := podTemplateLabels(workload)
+			if selector.AsSelector().Matches(labels.Set(podLabels)) {
+				selected = append(selected, workload)
+			}
+		}
+	}
+	return selected
+}
+
+func checkServiceSelector(obj Object, index *Index) []string {
+	selector, ok := serviceSelector(obj)
+	if !ok || len(selectedWorkloads(obj, selector, index)) > 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("selector %s matches no pod template of the run", selector)}
+}
+
+func checkServicePorts(obj Object, index *Index) []string {
+	selector, ok := serviceSelector(obj)
+	if !ok {
+		return nil
+	}
+	workloads := selectedWorkloads(obj, selector, index)
+	if len(workloads) == 0 {
+		return nil
+	}
+
+	var containerPorts []map[string]any
+	for _, workload := range workloads {
+		for _, c := range containers(workload) {
+			if !c.Init {
+				containerPorts = append(containerPorts, listOfMaps(c.Fields["ports"])...)
+			}
+		}
+	}
+
+	var messages []string
+	ports, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "ports")
+	for _, servicePort := range listOfMaps(ports) {
+		target := servicePort["targetPort"]
+		if target == nil {
+			target = servicePort["port"]
+		}
+
+		if name, ok := target.(string); ok {
+			if !slices.ContainsFunc(containerPorts, func(port map[string]any) bool { return port["name"] == name }) {
+				messages = append(messages, fmt.Sprintf("port %v targets the named port '%s', which no selected container defines", servicePort["port"], name))
+			}
+			continue
+		}
+
+		// Containers do not have to declare the ports they listen on, a
+		// number is only checked against containers declaring some
+		number, ok := toInt(target)
+		if !ok || len(containerPorts) == 0 {
+			continue
+		}
+		if !slices.ContainsFunc(containerPorts, func(port map[string]any) bool {
+			value, ok := toInt(port["containerPort"])
+			return ok && value == number
+		}) {
+			messages = append(messages, fmt.Sprintf("port %v targets container port %d, which no selected container exposes", servicePort["port"], number))
+		}
+	}
+	return messages
+}
+
+// configRef is a ConfigMap or Secret read by a pod
+type configRef struct {
+	From     string // What reads it, e.g. "container 'api'"
+	Kind     string
+	Name     string
+	Key      string // Read key, if a single one is
+	Optional bool
+}
+
+// configRefs returns the ConfigMaps and Secrets read by the pods of a workload
+func configRefs(obj Object) []configRef {
+	spec, ok := podSpec(obj)
+	if !ok {
+		return nil
+	}
+
+	var refs []configRef
+	add := func(from, kind string, fields any, nameField, keyField string) {
+		ref, ok := fields.(map[string]any)
+		if !ok {
+			return
+		}
+		name, _ := ref[nameField].(string)
+		key, _ := ref[keyField].(string)
+		optional, _ := ref["optional"].(bool)
+		if name != "" {
+			refs = append(refs, configRef{From: from, Kind: kind, Name: name, Key: key, Optional: optional})
+		}
+	}
+
+	for _, volume := range listOfMaps(spec["volumes"]) {
+		from := fmt.Sprintf("volume '%v'", volume["name"])
+		add(from, "ConfigMap", volume["configMap"], "name", "")
+		add(from, "Secret", volume["secret"], "secretName", "")
+		sources, _, _ := unstructured.NestedFieldNoCopy(volume, "projected", "sources")
+		for _, source := range listOfMaps(sources) {
+			add(from, "ConfigMap", source["configMap"], "name", "")
+			add(from, "Secret", source["secret"], "name", "")
+		}
+	}
+
+	for _, c := range containers(obj) {
+		for _, env := range listOfMaps(c.Fields["env"]) {
+			valueFrom, _ := env["valueFrom"].(map[string]any)
+			add(c.String(), "ConfigMap", valueFrom["configMapKeyRef"], "name", "key")
+			add(c.String(), "Secret", valueFrom["secretKeyRef"], "name", "key")
+		}
+		for _, envFrom := range listOfMaps(c.Fields["envFrom"]) {
+			add(c.String(), "ConfigMap", envFrom["configMapRef"], "name", "")
+			add(c.String(), "Secret", envFrom["secretRef"], "name", "")
+		}
+	}
+	return refs
+}
+
+// clusterConfigMaps are ConfigMaps Kubernetes creates in every namespace
+var clusterConfigMaps = []string{"kube-root-ca.crt"}
+
+// hasKey reports whether a ConfigMap or Secret defines a key
+func hasKey(obj Object, key string) bool {
+	for _, field := range []string{"data", "binaryData", "stringData"} {
+		if values, ok := obj.Object[field].(map[string]any); ok {
+			if _, ok := values[key]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func checkConfigRefs(obj Object, index *Index) []string {
+	var messages []string
+	for _, ref := range configRefs(obj) {
+		if ref.Optional || (ref.Kind == "ConfigMap" && slices.Contains(clusterConfigMaps, ref.Name)) {
+			continue
+		}
+		target, ok := index.Find(ref.Kind, obj.GetNamespace(), ref.Name)
+		switch {
+		case !ok:
+			messages = append(messages, fmt.Sprintf("%s reads %s '%s', which is not part of the run", ref.From, ref.Kind, ref.Name))
+		case ref.Key != "" && !hasKey(target, ref.Key):
+			messages = append(messages, fmt.Sprintf("%s reads key '%s' of %s '%s', which does not define it", ref.From, ref.Key, ref.Kind, ref.Name))
+		}
+	}
+	return dedupe(messages)
+}
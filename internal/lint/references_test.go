@@ -0,0 +1,210 @@
+package lint
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// referenceRuleIDs are the rules of references.go
+var referenceRuleIDs = []string{"dangling-ref", "service-selector", "service-ports", "config-refs"}
+
+const referencedApp = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      volumes:
+        - name: config
+          configMap:
+            name: app
+        - name: token
+          projected:
+            sources:
+              - configMap:
+                  name: kube-root-ca.crt
+      containers:
+        - name: app
+          image: app:1.0
+          ports:
+            - name: http
+              containerPort: 8080
+          env:
+            - name: PASSWORD
+              valueFrom:
+                secretKeyRef:
+                  name: app
+                  key: password
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  selector:
+    app: app
+  ports:
+    - name: http
+      port: 80
+      targetPort: http
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  level: info
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+stringData:
+  password: secret
+---
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: app
+spec:
+  minReplicas: 1
+  maxReplicas: 3
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: app
+---
+apiVersion: gateway.networking.k8s.io/v1
+kind: Gateway
+metadata:
+  name: app
+---
+apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: app
+spec:
+  parentRefs:
+    - name: app
+    - name: shared
+      namespace: infra
+  rules:
+    - backendRefs:
+        - name: app
+          port: 80
+---
+apiVersion: networking.gke.io/v1
+kind: HealthCheckPolicy
+metadata:
+  name: app
+spec:
+  targetRef:
+    group: ""
+    kind: Service
+    name: app
+`
+
+func TestReferenceRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		content string
+		want    []string // Substrings of the expected messages, in order
+	}{
+		{
+			name:    "consistent run",
+			content: referencedApp,
+		},
+		{
+			name:    "hpa targeting a missing deployment",
+			rule:    "dangling-ref",
+			content: "kind: HorizontalPodAutoscaler\nmetadata:\n  name: api\nspec:\n  scaleTargetRef:\n    kind: Deployment\n    name: api\n",
+			want:    []string{"scaleTargetRef Deployment/api is not part of the run"},
+		},
+		{
+			name:    "route to missing gateway, service and port",
+			rule:    "dangling-ref",
+			content: "kind: Service\nmetadata:\n  name: web\nspec:\n  ports:\n    - port: 80\n---\nkind: HTTPRoute\nmetadata:\n  name: web\nspec:\n  parentRefs:\n    - name: edge\n  rules:\n    - backendRefs:\n        - name: api\n          port: 80\n        - name: web\n          port: 8080\n        - group: example.com\n          kind: Bucket\n          name: assets\n",
+			want:    []string{"parentRef Gateway/edge is not part of the run", "backendRef Service/api is not part of the run", "backendRef Service/web has no port 8080"},
+		},
+		{
+			name:    "health check policy and ingress targets",
+			rule:    "dangling-ref",
+			content: "kind: HealthCheckPolicy\nmetadata:\n  name: api\nspec:\n  targetRef:\n    kind: Service\n    name: api\n---\nkind: Ingress\nmetadata:\n  name: web\nspec:\n  defaultBackend:\n    service:\n      name: web\n      port:\n        name: http\n  rules:\n    - http:\n        paths:\n          - path: /\n            backend:\n              service:\n                name: web\n                port:\n                  name: http\n",
+			want:    []string{"targetRef Service/api is not part of the run", "backend Service/web is not part of the run"},
+		},
+		{
+			name:    "references are looked up in the same namespace",
+			rule:    "dangling-ref",
+			content: "kind: Deployment\nmetadata:\n  name: api\n  namespace: staging\n---\nkind: HorizontalPodAutoscaler\nmetadata:\n  name: api\n  namespace: production\nspec:\n  scaleTargetRef:\n    kind: Deployment\n    name: api\n",
+			want:    []string{"scaleTargetRef Deployment/api is not part of the run"},
+		},
+		{
+			name:    "selector matching no pods",
+			rule:    "service-selector",
+			content: strings.Replace(referencedApp, "  selector:\n    app: app\n", "  selector:\n    app: web\n    tier: front\n", 1) + "---\nkind: Service\nmetadata:\n  name: external\nspec:\n  type: ExternalName\n  selector:\n    app: db\n",
+			want:    []string{"selector app=web,tier=front matches no pod template of the run"},
+		},
+		{
+			name:    "target ports no container exposes",
+			rule:    "service-ports",
+			content: strings.Replace(referencedApp, "      targetPort: http\n", "      targetPort: web\n    - name: metrics\n      port: 9090\n    - name: admin\n      port: 81\n      targetPort: 8080\n", 1),
+			want:    []string{"port 80 targets the named port 'web'", "port 9090 targets container port 9090"},
+		},
+		{
+			name:    "missing config maps, secrets and keys",
+			rule:    "config-refs",
+			content: strings.Replace(strings.Replace(referencedApp, "name: app\ndata:", "name: other\ndata:", 1), "key: password", "key: token", 1) + "---\nkind: Job\nmetadata:\n  name: migrate\nspec:\n  template:\n    spec:\n      containers:\n        - name: migrate\n          image: migrate:1.0\n          envFrom:\n            - secretRef:\n                name: db\n            - configMapRef:\n                name: flags\n                optional: true\n",
+			want:    []string{"volume 'config' reads ConfigMap 'app', which is not part of the run", "container 'app' reads key 'token' of Secret 'app'", "container 'migrate' reads Secret 'db'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := parseTestObjects(t, tt.content)
+			index := NewIndex(objects)
+
+			var got []string
+			for _, rule := range Rules() {
+				if (tt.rule != "" && rule.ID != tt.rule) || (tt.rule == "" && !slices.Contains(referenceRuleIDs, rule.ID)) {
+					continue
+				}
+				for _, obj := range objects {
+					got = append(got, rule.Check(obj, index)...)
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("messages = %q, want %d messages", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("messages[%d] = %q, want it to contain %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestIndex(t *testing.T) {
+	objects := parseTestObjects(t, referencedApp+"---\nkind: Service\nmetadata:\n  name: app\n  namespace: staging\n")
+	index := NewIndex(objects)
+
+	if len(index.Objects()) != len(objects) {
+		t.Errorf("Objects() = %d objects, want %d", len(index.Objects()), len(objects))
+	}
+	if obj, ok := index.Find("Service", "", "app"); !ok || obj.Line != 33 {
+		t.Errorf("Find(Service, app) = line %d, %v, want the Service of line 33", obj.Line, ok)
+	}
+	if _, ok := index.Find("Service", "", "web"); ok {
+		t.Error("Find() found a Service that is not part of the run")
+	}
+	if services := index.Kind("Service", "staging"); len(services) != 1 || services[0].GetNamespace() != "staging" {
+		t.Errorf("Kind(Service, staging) = %d objects, want the staging Service", len(services))
+	}
+}
@@ -0,0 +1,346 @@
+package lint
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Rule is a check run against every object. Check returns one message per
+// violation, index holds every object being linted for cross-object rules.
+type Rule struct {
+	ID          string
+	Description string
+	Severity    Severity // Default severity
+	Check       func(obj Object, index *Index) []string
+}
+
+// builtinRules are the rules every project is linted with
+var builtinRules = []Rule{
+	{
+		ID:          "no-latest-tag",
+		Description: "Container images are pinned to a tag other than latest, or to a digest",
+		Severity:    SeverityError,
+		Check:       checkImageTags,
+	},
+	{
+		ID:          "resources",
+		Description: "Containers set resource requests and limits",
+		Severity:    SeverityWarning,
+		Check:       checkResources,
+	},
+	{
+		ID:          "probes",
+		Description: "Containers of Deployments, StatefulSets and DaemonSets have readiness and liveness probes",
+		Severity:    SeverityWarning,
+		Check:       checkProbes,
+	},
+	{
+		ID:          "run-as-non-root",
+		Description: "Containers set securityContext.runAsNonRoot, directly or through the pod",
+		Severity:    SeverityError,
+		Check:       checkRunAsNonRoot,
+	},
+	{
+		ID:          "hpa-min-max",
+		Description: "HorizontalPodAutoscalers have minReplicas lower than or equal to maxReplicas",
+		Severity:    SeverityError,
+		Check:       checkHPAReplicas,
+	},
+	{
+		ID:          "pdb-present",
+		Description: "Deployments and StatefulSets with more than one replica are covered by a PodDisruptionBudget",
+		Severity:    SeverityWarning,
+		Check:       checkPDBPresent,
+	},
+	// Rules checking the objects of a run agree with each other. References
+	// naming another namespace are left alone, it is rarely part of the run.
+	{
+		ID:          "dangling-ref",
+		Description: "HPA scale targets, HTTPRoute parents and backends, Ingress backends and HealthCheckPolicy targets are part of the run",
+		Severity:    SeverityError,
+		Check:       checkDanglingRefs,
+	},
+	{
+		ID:          "service-selector",
+		Description: "Service selectors match the pod template of a workload of the run",
+		Severity:    SeverityWarning,
+		Check:       checkServiceSelector,
+	},
+	{
+		ID:          "service-ports",
+		Description: "Service target ports are exposed by the containers they select",
+		Severity:    SeverityWarning,
+		Check:       checkServicePorts,
+	},
+	{
+		ID:          "config-refs",
+		Description: "ConfigMaps and Secrets read by pods, and the keys they read, are part of the run",
+		Severity:    SeverityWarning,
+		Check:       checkConfigRefs,
+	},
+}
+
+// Rules returns the built-in rules
+func Rules() []Rule {
+	return builtinRules
+}
+
+// FindRule returns the rule with the given ID
+func FindRule(id string) (Rule, bool) {
+	for _, rule := range builtinRules {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// PodSpecPaths are the pod specs of each workload kind. It is the table of
+// workload kinds shared by lint, image overrides and settings injection.
+var PodSpecPaths = map[string][]string{
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"Pod":                   {"spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+}
+
+// PodTemplatePaths returns the metadata of every template on the way to the
+// pod spec of a workload kind: the pod template, and the Job template of
+// CronJobs. Pods have none.
+func PodTemplatePaths(kind string) [][]string {
+	var paths [][]string
+	for i, field := range PodSpecPaths[kind] {
+		if strings.HasSuffix(strings.ToLower(field), "template") {
+			paths = append(paths, append(slices.Clone(PodSpecPaths[kind][:i+1]), "metadata"))
+		}
+	}
+	return paths
+}
+
+// container is a container or init container of a pod spec
+type container struct {
+	Name   string
+	Init   bool
+	Fields map[string]any
+}
+
+func (c container) String() string {
+	if c.Init {
+		return fmt.Sprintf("init container '%s'", c.Name)
+	}
+	return fmt.Sprintf("container '%s'", c.Name)
+}
+
+// podSpec returns the pod spec of a workload
+func podSpec(obj Object) (map[string]any, bool) {
+	path, ok := PodSpecPaths[obj.GetKind()]
+	if !ok {
+		return nil, false
+	}
+	spec, _, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+	m, ok := spec.(map[string]any)
+	return m, ok
+}
+
+// containers returns the init containers and containers of a workload
+func containers(obj Object) []container {
+	spec, ok := podSpec(obj)
+	if !ok {
+		return nil
+	}
+
+	var all []container
+	for _, field := range []string{"initContainers", "containers"} {
+		list, _ := spec[field].([]any)
+		for _, item := range list {
+			fields, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			name, _ := fields["name"].(string)
+			all = append(all, container{Name: name, Init: field == "initContainers", Fields: fields})
+		}
+	}
+	return all
+}
+
+// toInt converts the numbers YAML and JSON decoding produce
+func toInt(value any) (int64, bool) {
+	switch n := value.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
+func checkImageTags(obj Object, _ *Index) []string {
+	var messages []string
+	for _, c := range containers(obj) {
+		image, _ := c.Fields["image"].(string)
+		if image == "" {
+			continue
+		}
+
+		name, digest, _ := strings.Cut(image, "@")
+		if digest != "" {
+			continue
+		}
+		tag := ""
+		if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+			tag = name[i+1:]
+		}
+		switch tag {
+		case "":
+			messages = append(messages, fmt.Sprintf("%s uses image '%s' without a tag, which means latest", c, image))
+		case "latest":
+			messages = append(messages, fmt.Sprintf("%s uses the latest tag of '%s'", c, image))
+		}
+	}
+	return messages
+}
+
+func checkResources(obj Object, _ *Index) []string {
+	var messages []string
+	for _, c := range containers(obj) {
+		var missing []string
+		for _, field := range []string{"requests", "limits"} {
+			values, _, _ := unstructured.NestedFieldNoCopy(c.Fields, "resources", field)
+			if m, _ := values.(map[string]any); len(m) == 0 {
+				missing = append(missing, field)
+			}
+		}
+		if len(missing) > 0 {
+			messages = append(messages, fmt.Sprintf("%s sets no resource %s", c, strings.Join(missing, " or ")))
+		}
+	}
+	return messages
+}
+
+func checkProbes(obj Object, _ *Index) []string {
+	switch obj.GetKind() {
+	case "Deployment", "StatefulSet", "DaemonSet":
+	default:
+		return nil
+	}
+
+	var messages []string
+	for _, c := range containers(obj) {
+		if c.Init {
+			continue
+		}
+		var missing []string
+		for _, probe := range []string{"readinessProbe", "livenessProbe"} {
+			if _, ok := c.Fields[probe]; !ok {
+				missing = append(missing, probe)
+			}
+		}
+		if len(missing) > 0 {
+			messages = append(messages, fmt.Sprintf("%s has no %s", c, strings.Join(missing, " or ")))
+		}
+	}
+	return messages
+}
+
+func checkRunAsNonRoot(obj Object, _ *Index) []string {
+	spec, ok := podSpec(obj)
+	if !ok {
+		return nil
+	}
+
+	podNonRoot, podSet, _ := unstructured.NestedBool(spec, "securityContext", "runAsNonRoot")
+	podUser, podUserSet, _ := unstructured.NestedFieldNoCopy(spec, "securityContext", "runAsUser")
+
+	var messages []string
+	for _, c := range containers(obj) {
+		nonRoot, set, _ := unstructured.NestedBool(c.Fields, "securityContext", "runAsNonRoot")
+		if !set {
+			nonRoot, set = podNonRoot, podSet
+		}
+		user, userSet, _ := unstructured.NestedFieldNoCopy(c.Fields, "securityContext", "runAsUser")
+		if !userSet {
+			user, userSet = podUser, podUserSet
+		}
+
+		if uid, ok := toInt(user); userSet && ok && uid == 0 {
+			messages = append(messages, fmt.Sprintf("%s runs as user 0 (root)", c))
+			continue
+		}
+		if !set || !nonRoot {
+			messages = append(messages, fmt.Sprintf("%s may run as root, set securityContext.runAsNonRoot: true", c))
+		}
+	}
+	return messages
+}
+
+func checkHPAReplicas(obj Object, _ *Index) []string {
+	if obj.GetKind() != "HorizontalPodAutoscaler" {
+		return nil
+	}
+
+	minReplicas := int64(1)
+	if value, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "minReplicas"); found {
+		if n, ok := toInt(value); ok {
+			minReplicas = n
+		}
+	}
+	value, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "maxReplicas")
+	maxReplicas, ok := toInt(value)
+	if !found || !ok {
+		return []string{"maxReplicas is not set"}
+	}
+	if minReplicas > maxReplicas {
+		return []string{fmt.Sprintf("minReplicas (%d) is greater than maxReplicas (%d)", minReplicas, maxReplicas)}
+	}
+	return nil
+}
+
+func checkPDBPresent(obj Object, index *Index) []string {
+	if obj.GetKind() != "Deployment" && obj.GetKind() != "StatefulSet" {
+		return nil
+	}
+
+	// Replicas default to 1, and are left out when an HPA owns them
+	value, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "replicas")
+	replicas, ok := toInt(value)
+	if !found || !ok || replicas <= 1 {
+		return nil
+	}
+
+	podLabels, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "labels")
+	for _, other := range index.Kind("PodDisruptionBudget", obj.GetNamespace()) {
+		selector, _, _ := unstructured.NestedFieldNoCopy(other.Object, "spec", "selector")
+		selectorFields, ok := selector.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		var labelSelector metav1.LabelSelector
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(selectorFields, &labelSelector); err != nil {
+			continue
+		}
+		parsed, err := metav1.LabelSelectorAsSelector(&labelSelector)
+		if err != nil || parsed.Empty() {
+			continue
+		}
+		if parsed.Matches(labels.Set(podLabels)) {
+			return nil
+		}
+	}
+
+	return []string{fmt.Sprintf("%d replicas and no PodDisruptionBudget selects its pods", replicas)}
+}
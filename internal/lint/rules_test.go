@@ -0,0 +1,173 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+)
+
+const compliantDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  labels:
+    app: api
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: api
+  template:
+    metadata:
+      labels:
+        app: api
+    spec:
+      securityContext:
+        runAsNonRoot: true
+      containers:
+        - name: api
+          image: ghcr.io/acme/api:1.4.2
+          resources:
+            requests:
+              cpu: 100m
+              memory: 128Mi
+            limits:
+              memory: 128Mi
+          readinessProbe:
+            httpGet:
+              path: /ready
+              port: 8080
+          livenessProbe:
+            httpGet:
+              path: /healthz
+              port: 8080
+---
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: api
+spec:
+  minAvailable: 1
+  selector:
+    matchLabels:
+      app: api
+`
+
+func parseTestObjects(t *testing.T, content string) []Object {
+	t.Helper()
+	objects, err := ParseObjects("test.yaml", []byte(content))
+	if err != nil {
+		t.Fatalf("ParseObjects() error = %v", err)
+	}
+	return objects
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		content string
+		want    []string // Substrings of the expected messages, in order
+	}{
+		{
+			name:    "compliant deployment",
+			content: compliantDeployment,
+		},
+		{
+			name:    "latest and untagged images",
+			rule:    "no-latest-tag",
+			content: "kind: Pod\nmetadata:\n  name: debug\nspec:\n  initContainers:\n    - name: init\n      image: busybox\n  containers:\n    - name: debug\n      image: registry:5000/debug:latest\n    - name: pinned\n      image: nginx@sha256:abc\n",
+			want:    []string{"init container 'init' uses image 'busybox' without a tag", "container 'debug' uses the latest tag"},
+		},
+		{
+			name:    "missing limits",
+			rule:    "resources",
+			content: "kind: Job\nmetadata:\n  name: migrate\nspec:\n  template:\n    spec:\n      containers:\n        - name: migrate\n          image: api:1.0\n          resources:\n            requests:\n              cpu: 1\n",
+			want:    []string{"container 'migrate' sets no resource limits"},
+		},
+		{
+			name:    "missing probes",
+			rule:    "probes",
+			content: "kind: StatefulSet\nmetadata:\n  name: db\nspec:\n  template:\n    spec:\n      containers:\n        - name: db\n          image: postgres:16\n          readinessProbe:\n            exec:\n              command: [pg_isready]\n",
+			want:    []string{"container 'db' has no livenessProbe"},
+		},
+		{
+			name:    "jobs need no probes",
+			rule:    "probes",
+			content: "kind: CronJob\nmetadata:\n  name: report\nspec:\n  jobTemplate:\n    spec:\n      template:\n        spec:\n          containers:\n            - name: report\n              image: report:1.0\n",
+		},
+		{
+			name:    "root containers",
+			rule:    "run-as-non-root",
+			content: "kind: DaemonSet\nmetadata:\n  name: agent\nspec:\n  template:\n    spec:\n      securityContext:\n        runAsNonRoot: true\n      containers:\n        - name: agent\n          image: agent:1.0\n          securityContext:\n            runAsUser: 0\n        - name: shipper\n          image: shipper:1.0\n          securityContext:\n            runAsNonRoot: false\n        - name: exporter\n          image: exporter:1.0\n",
+			want:    []string{"container 'agent' runs as user 0", "container 'shipper' may run as root"},
+		},
+		{
+			name:    "hpa min above max",
+			rule:    "hpa-min-max",
+			content: "kind: HorizontalPodAutoscaler\nmetadata:\n  name: api\nspec:\n  minReplicas: 5\n  maxReplicas: 3\n",
+			want:    []string{"minReplicas (5) is greater than maxReplicas (3)"},
+		},
+		{
+			name:    "hpa without max",
+			rule:    "hpa-min-max",
+			content: "kind: HorizontalPodAutoscaler\nmetadata:\n  name: api\nspec:\n  minReplicas: 2\n",
+			want:    []string{"maxReplicas is not set"},
+		},
+		{
+			name:    "pdb selecting other pods",
+			rule:    "pdb-present",
+			content: strings.Split(compliantDeployment, "---\n")[0] + "---\nkind: PodDisruptionBudget\nmetadata:\n  name: web\nspec:\n  selector:\n    matchLabels:\n      app: web\n",
+			want:    []string{"3 replicas and no PodDisruptionBudget selects its pods"},
+		},
+		{
+			name:    "single replica needs no pdb",
+			rule:    "pdb-present",
+			content: "kind: Deployment\nmetadata:\n  name: api\nspec:\n  replicas: 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := parseTestObjects(t, tt.content)
+			index := NewIndex(objects)
+
+			var got []string
+			for _, rule := range Rules() {
+				if tt.rule != "" && rule.ID != tt.rule {
+					continue
+				}
+				for _, obj := range objects {
+					got = append(got, rule.Check(obj, index)...)
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("messages = %q, want %d messages", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("messages[%d] = %q, want it to contain %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPodTemplatePaths(t *testing.T) {
+	tests := map[string]string{
+		"Deployment":            "spec.template.metadata",
+		"ReplicationController": "spec.template.metadata",
+		"CronJob":               "spec.jobTemplate.metadata,spec.jobTemplate.spec.template.metadata",
+		"Pod":                   "",
+		"Service":               "",
+	}
+	for kind, want := range tests {
+		var got []string
+		for _, path := range PodTemplatePaths(kind) {
+			got = append(got, strings.Join(path, "."))
+		}
+		if strings.Join(got, ",") != want {
+			t.Errorf("PodTemplatePaths(%s) = %v, want %s", kind, got, want)
+		}
+	}
+}
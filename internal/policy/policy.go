@@ -0,0 +1,213 @@
+// Package policy loads the project policies of the 'policies' directory,
+// CEL expressions checked against rendered objects like the built-in lint rules
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dantedelordran/maniplacer/internal/lint"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DirName is the directory of a project holding its policy files
+const DirName = "policies"
+
+// costLimit bounds the work a single evaluation may do, so a runaway
+// comprehension over every object cannot hang generate
+const costLimit = 10_000_000
+
+// Policy is a CEL check read from a policy file. Expression is evaluated with
+// 'object', the object being checked, and 'objects', every rendered object,
+// and must return true for the object to pass.
+type Policy struct {
+	Name              string   `yaml:"name"`
+	Description       string   `yaml:"description,omitempty"`
+	Severity          string   `yaml:"severity,omitempty"` // error unless set
+	Kinds             []string `yaml:"kinds,omitempty"`    // Kinds checked, every kind when empty
+	Expression        string   `yaml:"expression"`
+	Message           string   `yaml:"message,omitempty"`
+	MessageExpression string   `yaml:"messageExpression,omitempty"` // CEL string expression, wins over message
+	File              string   `yaml:"-"`
+}
+
+// Load reads and compiles every policy file of dir, in file name order. Each
+// file holds one or more '---' separated policies. A missing directory means
+// no policies.
+func Load(dir string) ([]lint.Rule, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read policies directory: %w", err)
+	}
+
+	env, err := newEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []lint.Rule
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not read policy file '%s': %w", entry.Name(), err)
+		}
+
+		policies, err := parse(entry.Name(), content)
+		if err != nil {
+			return nil, err
+		}
+		for _, policy := range policies {
+			rule, err := policy.compile(env)
+			if err != nil {
+				return nil, fmt.Errorf("policy '%s' of %s: %w", policy.Name, policy.File, err)
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+// parse reads the policies of a policy file
+func parse(file string, content []byte) ([]Policy, error) {
+	var policies []Policy
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	for i := 1; ; i++ {
+		var policy Policy
+		err := decoder.Decode(&policy)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse policy file '%s' (document %d): %w", file, i, err)
+		}
+		policy.File = file
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+// newEnv declares the variables and extension functions policies can use
+func newEnv() (*cel.Env, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("object", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("objects", cel.ListType(cel.MapType(cel.StringType, cel.DynType))),
+		ext.Strings(),
+		ext.Lists(),
+		ext.Sets(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create policy environment: %w", err)
+	}
+	return env, nil
+}
+
+// compile checks a policy and turns it into a lint rule
+func (p Policy) compile(env *cel.Env) (lint.Rule, error) {
+	if errs := validation.IsDNS1123Label(p.Name); len(errs) > 0 {
+		return lint.Rule{}, fmt.Errorf("invalid name: %s", strings.Join(errs, ", "))
+	}
+	if p.Expression == "" {
+		return lint.Rule{}, fmt.Errorf("expression is required")
+	}
+
+	severity := lint.SeverityError
+	if p.Severity != "" {
+		var err error
+		if severity, err = lint.ParseSeverity(p.Severity); err != nil {
+			return lint.Rule{}, err
+		}
+	}
+
+	program, err := compileExpression(env, p.Expression, cel.BoolType)
+	if err != nil {
+		return lint.Rule{}, fmt.Errorf("invalid expression: %w", err)
+	}
+
+	var messageProgram cel.Program
+	if p.MessageExpression != "" {
+		if messageProgram, err = compileExpression(env, p.MessageExpression, cel.StringType); err != nil {
+			return lint.Rule{}, fmt.Errorf("invalid messageExpression: %w", err)
+		}
+	}
+
+	description := p.Description
+	if description == "" {
+		description = p.Expression
+	}
+
+	return lint.Rule{
+		ID:          p.Name,
+		Description: description,
+		Severity:    severity,
+		Check: func(obj lint.Object, index *lint.Index) []string {
+			if len(p.Kinds) > 0 && !slices.Contains(p.Kinds, obj.GetKind()) {
+				return nil
+			}
+
+			all := make([]map[string]any, 0, len(index.Objects()))
+			for _, other := range index.Objects() {
+				all = append(all, other.Object)
+			}
+			activation := map[string]any{"object": obj.Object, "objects": all}
+
+			out, _, err := program.Eval(activation)
+			if err != nil {
+				return []string{fmt.Sprintf("policy could not be evaluated: %s", err)}
+			}
+			if passed, ok := out.Value().(bool); ok && passed {
+				return nil
+			}
+
+			return []string{p.message(messageProgram, activation)}
+		},
+	}, nil
+}
+
+// message describes a failure, falling back to the static message and then
+// to the expression itself
+func (p Policy) message(program cel.Program, activation map[string]any) string {
+	if program != nil {
+		if out, _, err := program.Eval(activation); err == nil {
+			if message, ok := out.Value().(string); ok && message != "" {
+				return message
+			}
+		}
+	}
+	if p.Message != "" {
+		return p.Message
+	}
+	return fmt.Sprintf("failed '%s'", p.Expression)
+}
+
+// compileExpression compiles a CEL expression that must return want
+func compileExpression(env *cel.Env, expression string, want *cel.Type) (cel.Program, error) {
+	ast, issues := env.Compile(expression)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if !ast.OutputType().IsExactType(want) && !ast.OutputType().IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("expression returns %s, want %s", ast.OutputType(), want)
+	}
+	return env.Program(ast, cel.CostLimit(costLimit))
+}
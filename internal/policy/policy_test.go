@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dantedelordran/maniplacer/internal/lint"
+)
+
+const testObjects = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  labels:
+    team: payments
+spec:
+  replicas: 3
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  replicas: 1
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: api
+`
+
+const testPolicies = `name: team-label
+description: Every object has a team label
+expression: "has(object.metadata.labels) && 'team' in object.metadata.labels"
+message: missing the team label
+---
+name: max-replicas
+severity: warning
+kinds: [Deployment]
+expression: "!has(object.spec.replicas) || object.spec.replicas <= 2"
+messageExpression: "'runs ' + string(object.spec.replicas) + ' replicas, at most 2 are allowed'"
+---
+name: has-service
+kinds: [Deployment]
+expression: "objects.exists(o, o.kind == 'Service' && o.metadata.name == object.metadata.name)"
+`
+
+func writePolicies(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"org.yaml":  testPolicies,
+		"README.md": "not a policy",
+		".hidden":   "name: [",
+	})
+
+	rules, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("Load() returned %d rules, want 3", len(rules))
+	}
+	if rules[0].Severity != lint.SeverityError || rules[1].Severity != lint.SeverityWarning {
+		t.Errorf("severities = %s, %s, want error, warning", rules[0].Severity, rules[1].Severity)
+	}
+	if rules[2].Description != "objects.exists(o, o.kind == 'Service' && o.metadata.name == object.metadata.name)" {
+		t.Errorf("description without one = %q, want the expression", rules[2].Description)
+	}
+
+	objects, err := lint.ParseObjects("app.yaml", []byte(testObjects))
+	if err != nil {
+		t.Fatalf("ParseObjects() error = %v", err)
+	}
+	report, err := lint.Run(objects, lint.Config{Rules: rules, SkipBuiltins: true})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var got []string
+	for _, finding := range report.Findings {
+		got = append(got, finding.Object+" "+finding.Rule+": "+finding.Message)
+	}
+	want := []string{
+		"Deployment/api max-replicas: runs 3 replicas, at most 2 are allowed",
+		"Deployment/worker has-service: failed 'objects.exists(o, o.kind == 'Service' && o.metadata.name == object.metadata.name)'",
+		"Deployment/worker team-label: missing the team label",
+		"Service/api team-label: missing the team label",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLoadEvaluationErrorFails(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"owner.yaml": "name: owner\nexpression: object.metadata.labels.owner == 'me'\n",
+	})
+	rules, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	objects, err := lint.ParseObjects("app.yaml", []byte(testObjects))
+	if err != nil {
+		t.Fatalf("ParseObjects() error = %v", err)
+	}
+	messages := rules[0].Check(objects[1], lint.NewIndex(objects))
+	if len(messages) != 1 || !strings.HasPrefix(messages[0], "policy could not be evaluated") {
+		t.Errorf("Check() on an object without labels = %v, want an evaluation failure", messages)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if rules, err := Load(filepath.Join(t.TempDir(), "missing")); err != nil || rules != nil {
+		t.Errorf("Load() on a missing directory = %v, %v, want no rules", rules, err)
+	}
+
+	tests := map[string]string{
+		"invalid yaml":      "name: [",
+		"unknown field":     "name: a\nexpression: 'true'\nmatch: {}\n",
+		"bad name":          "name: Not_A_Name\nexpression: 'true'\n",
+		"no expression":     "name: a\n",
+		"bad severity":      "name: a\nseverity: fatal\nexpression: 'true'\n",
+		"syntax error":      "name: a\nexpression: 'object.'\n",
+		"not a bool":        "name: a\nexpression: \"'yes'\"\n",
+		"unknown variable":  "name: a\nexpression: 'cluster.ready'\n",
+		"message not a str": "name: a\nexpression: 'true'\nmessageExpression: '1 + 1'\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := writePolicies(t, map[string]string{"policy.yaml": content})
+			if _, err := Load(dir); err == nil {
+				t.Error("Load() expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"filippo.io/age"
+	"gopkg.in/yaml.v3"
+)
+
+// Variables age identities are read from, the same SOPS reads
+const (
+	KeyEnv     = "SOPS_AGE_KEY"      // Identities themselves
+	KeyFileEnv = "SOPS_AGE_KEY_FILE" // Path of a key file
+)
+
+// ConfigFileName is the SOPS config file holding creation rules
+const ConfigFileName = ".sops.yaml"
+
+// DefaultKeyFile returns the key file read when SOPS_AGE_KEY_FILE is not set,
+// 'sops/age/keys.txt' in the user config directory
+func DefaultKeyFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find the user config directory: %w", err)
+	}
+	return filepath.Join(dir, "sops", "age", "keys.txt"), nil
+}
+
+// LoadIdentities reads the age identities of SOPS_AGE_KEY, of the key file
+// named by SOPS_AGE_KEY_FILE or of the default key file, in that order
+func LoadIdentities() ([]age.Identity, error) {
+	if keys := os.Getenv(KeyEnv); keys != "" {
+		identities, err := age.ParseIdentities(strings.NewReader(keys))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age identities in %s: %w", KeyEnv, err)
+		}
+		return identities, nil
+	}
+
+	path := os.Getenv(KeyFileEnv)
+	if path == "" {
+		var err error
+		if path, err = DefaultKeyFile(); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no age key file at %s (create one with 'age-keygen -o %s' or set %s)", path, path, KeyFileEnv)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read age key file: %w", err)
+	}
+	defer file.Close()
+
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age key file %s: %w", path, err)
+	}
+	return identities, nil
+}
+
+// IdentityRecipients returns the public keys of age identities
+func IdentityRecipients(identities []age.Identity) []string {
+	var recipients []string
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			recipients = append(recipients, x25519.Recipient().String())
+		}
+	}
+	return recipients
+}
+
+// creationRule is a rule of .sops.yaml, picking the recipients of new files
+type creationRule struct {
+	PathRegex string `yaml:"path_regex"`
+	Age       string `yaml:"age"` // Comma separated recipients
+}
+
+// RecipientsFor returns the age recipients of the first .sops.yaml creation
+// rule matching path. The config is looked up in the directory of path and
+// its parents, and rules match the slash separated path relative to it. No
+// config, or no matching rule, returns no recipients.
+func RecipientsFor(path string) ([]string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		content, err := os.ReadFile(filepath.Join(dir, ConfigFileName))
+		if err == nil {
+			rel, err := filepath.Rel(dir, abs)
+			if err != nil {
+				return nil, err
+			}
+			return matchCreationRules(content, filepath.ToSlash(rel))
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("could not read %s: %w", ConfigFileName, err)
+		}
+		if filepath.Dir(dir) == dir {
+			return nil, nil
+		}
+	}
+}
+
+// matchCreationRules returns the recipients of the first rule matching path
+func matchCreationRules(content []byte, path string) ([]string, error) {
+	var config struct {
+		CreationRules []creationRule `yaml:"creation_rules"`
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", ConfigFileName, err)
+	}
+
+	for i, rule := range config.CreationRules {
+		pattern, err := regexp.Compile(rule.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("%s: creation_rules[%d]: invalid path_regex: %w", ConfigFileName, i, err)
+		}
+		if !pattern.MatchString(path) {
+			continue
+		}
+
+		var recipients []string
+		for _, recipient := range strings.Split(rule.Age, ",") {
+			if recipient = strings.TrimSpace(recipient); recipient != "" {
+				recipients = append(recipients, recipient)
+			}
+		}
+		if len(recipients) == 0 {
+			return nil, fmt.Errorf("%s: creation_rules[%d] matches '%s' but has no age recipients", ConfigFileName, i, path)
+		}
+		return recipients, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,666 @@
+// Package secrets reads and writes SOPS encrypted files using age keys, so
+// config values can be committed encrypted and only decrypted in memory
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the syntax of an encrypted file
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+)
+
+// DefaultUnencryptedSuffix marks keys whose values are left in plaintext
+const DefaultUnencryptedSuffix = "_unencrypted"
+
+const (
+	metadataKey = "sops"  // Top-level key holding the SOPS metadata
+	sopsVersion = "3.9.0" // SOPS release whose file format is written
+	dataKeySize = 32      // AES-256
+	nonceSize   = 32      // SOPS uses 32 byte GCM nonces
+	tagSize     = 16      // GCM authentication tag
+	macType     = "str"   // Type the MAC is encrypted as
+	valueFormat = "ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]"
+)
+
+// encryptedValue matches a value encrypted by SOPS
+var encryptedValue = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+// ageEntry is the data key encrypted to one age recipient
+type ageEntry struct {
+	Recipient string `yaml:"recipient"`
+	Enc       string `yaml:"enc"`
+}
+
+// metadata is the part of the 'sops' key this package reads and writes.
+// Other fields, such as the data key encrypted with other key types, are
+// kept as they are when a file is encrypted again.
+type metadata struct {
+	Age               []ageEntry `yaml:"age"`
+	LastModified      string     `yaml:"lastmodified"`
+	MAC               string     `yaml:"mac"`
+	UnencryptedSuffix string     `yaml:"unencrypted_suffix,omitempty"`
+	MACOnlyEncrypted  bool       `yaml:"mac_only_encrypted,omitempty"`
+	Version           string     `yaml:"version"`
+}
+
+// Key is the data key the values of a file are encrypted with, and the
+// recipients it is encrypted to
+type Key struct {
+	dataKey  []byte
+	age      []ageEntry
+	suffix   string
+	original *yaml.Node // Metadata of the file the key was read from
+}
+
+// NewKey returns a new random data key encrypted to the given age recipients
+func NewKey(recipients []string) (*Key, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("at least one age recipient is required")
+	}
+
+	key := &Key{dataKey: make([]byte, dataKeySize), suffix: DefaultUnencryptedSuffix}
+	if _, err := rand.Read(key.dataKey); err != nil {
+		return nil, fmt.Errorf("could not generate data key: %w", err)
+	}
+
+	for _, recipient := range recipients {
+		parsed, err := age.ParseX25519Recipient(strings.TrimSpace(recipient))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient '%s': %w", recipient, err)
+		}
+
+		var buf bytes.Buffer
+		armored := armor.NewWriter(&buf)
+		w, err := age.Encrypt(armored, parsed)
+		if err != nil {
+			return nil, fmt.Errorf("could not encrypt data key to '%s': %w", recipient, err)
+		}
+		if _, err := w.Write(key.dataKey); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		if err := armored.Close(); err != nil {
+			return nil, err
+		}
+		key.age = append(key.age, ageEntry{Recipient: parsed.String(), Enc: buf.String()})
+	}
+	return key, nil
+}
+
+// Recipients returns the age recipients the data key is encrypted to
+func (k *Key) Recipients() []string {
+	recipients := make([]string, 0, len(k.age))
+	for _, entry := range k.age {
+		recipients = append(recipients, entry.Recipient)
+	}
+	return recipients
+}
+
+// IsEncrypted reports whether content is a SOPS encrypted file
+func IsEncrypted(content []byte) bool {
+	var doc struct {
+		Sops *struct {
+			MAC string `yaml:"mac"`
+		} `yaml:"sops"`
+	}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return false
+	}
+	return doc.Sops != nil && doc.Sops.MAC != ""
+}
+
+// Decrypt decrypts a SOPS file with the first of identities its data key is
+// encrypted to, checks its MAC and returns the plaintext in the same format.
+// The returned key encrypts the file again without changing its recipients.
+func Decrypt(content []byte, format Format, identities []age.Identity) ([]byte, *Key, error) {
+	doc, root, err := parseDocument(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadataNode := removeKey(root, metadataKey)
+	if metadataNode == nil {
+		return nil, nil, errors.New("file is not SOPS encrypted")
+	}
+	var meta metadata
+	if err := metadataNode.Decode(&meta); err != nil {
+		return nil, nil, fmt.Errorf("invalid SOPS metadata: %w", err)
+	}
+	if len(meta.Age) == 0 {
+		return nil, nil, errors.New("the data key is not encrypted to any age recipient, only age keys are supported")
+	}
+
+	key := &Key{age: meta.Age, suffix: meta.UnencryptedSuffix, original: metadataNode}
+	if key.dataKey, err = unwrapDataKey(meta.Age, identities); err != nil {
+		return nil, nil, err
+	}
+
+	sum, err := key.decryptValues(root, meta.MACOnlyEncrypted)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mac, _, err := key.decryptValue(meta.MAC, meta.LastModified)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not decrypt MAC: %w", err)
+	}
+	if mac != sum {
+		return nil, nil, errors.New("MAC mismatch, the file was modified without its key")
+	}
+
+	plaintext, err := encode(doc, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plaintext, key, nil
+}
+
+// Encrypt encrypts every value of a plaintext file with the data key, except
+// the values under keys ending in the unencrypted suffix. Comments are kept
+// in plaintext.
+func (k *Key) Encrypt(plaintext []byte, format Format) ([]byte, error) {
+	doc, root, err := parseDocument(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if valueOf(root, metadataKey) != nil {
+		return nil, errors.New("file is already SOPS encrypted")
+	}
+
+	hash := sha512.New()
+	err = walk(root, nil, func(node *yaml.Node, path []string) error {
+		value, err := valueBytes(node)
+		if err != nil {
+			return err
+		}
+		hash.Write(value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := k.EncryptValues(root); err != nil {
+		return nil, err
+	}
+
+	lastModified := time.Now().UTC().Format(time.RFC3339)
+	mac, err := k.encryptValue([]byte(fmt.Sprintf("%X", hash.Sum(nil))), macType, lastModified)
+	if err != nil {
+		return nil, err
+	}
+
+	metadataNode, err := k.metadataNode(lastModified, mac)
+	if err != nil {
+		return nil, err
+	}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: metadataKey}, metadataNode)
+
+	return encode(doc, format)
+}
+
+// EncryptValues encrypts in place the values of a map node of top-level keys,
+// except those under keys ending in the unencrypted suffix, so they can be
+// added to a file encrypted with the key
+func (k *Key) EncryptValues(root *yaml.Node) error {
+	return walk(root, nil, func(node *yaml.Node, path []string) error {
+		if k.suffix != "" && slices.ContainsFunc(path, func(key string) bool { return strings.HasSuffix(key, k.suffix) }) {
+			return nil
+		}
+		value, err := valueBytes(node)
+		if err != nil {
+			return err
+		}
+		return k.encryptNode(node, value, additionalData(path))
+	})
+}
+
+// UpdateMAC authenticates again an encrypted file whose values were changed
+// or added with the key. Only the MAC and lastmodified of its metadata are
+// replaced, the rest of the content is kept byte for byte.
+func (k *Key) UpdateMAC(content []byte) ([]byte, error) {
+	_, root, err := parseDocument(content)
+	if err != nil {
+		return nil, err
+	}
+	metadataNode := removeKey(root, metadataKey)
+	if metadataNode == nil {
+		return nil, errors.New("file is not SOPS encrypted")
+	}
+	var meta metadata
+	if err := metadataNode.Decode(&meta); err != nil {
+		return nil, fmt.Errorf("invalid SOPS metadata: %w", err)
+	}
+
+	sum, err := k.decryptValues(root, meta.MACOnlyEncrypted)
+	if err != nil {
+		return nil, err
+	}
+	lastModified := time.Now().UTC().Format(time.RFC3339)
+	mac, err := k.encryptValue([]byte(sum), macType, lastModified)
+	if err != nil {
+		return nil, err
+	}
+
+	// The MAC is unique thanks to its random IV, the timestamp is only
+	// replaced where it follows its key
+	if !bytes.Contains(content, []byte(meta.MAC)) {
+		return nil, errors.New("could not find the MAC of the file")
+	}
+	content = bytes.Replace(content, []byte(meta.MAC), []byte(mac), 1)
+	lastModifiedField := regexp.MustCompile(`(lastmodified"?\s*:\s*["']?)` + regexp.QuoteMeta(meta.LastModified))
+	return lastModifiedField.ReplaceAll(content, []byte("${1}"+lastModified)), nil
+}
+
+// decryptValues decrypts in place the encrypted values under root and
+// returns the MAC of the file, computed over every value or only the
+// encrypted ones
+func (k *Key) decryptValues(root *yaml.Node, onlyEncrypted bool) (string, error) {
+	hash := sha512.New()
+	err := walk(root, nil, func(node *yaml.Node, path []string) error {
+		encrypted := false
+		if node.Tag == "!!str" && encryptedValue.MatchString(node.Value) {
+			if err := k.decryptNode(node, additionalData(path)); err != nil {
+				return fmt.Errorf("could not decrypt '%s': %w", strings.Join(path, "."), err)
+			}
+			encrypted = true
+		}
+		if !onlyEncrypted || encrypted {
+			value, err := valueBytes(node)
+			if err != nil {
+				return err
+			}
+			hash.Write(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%X", hash.Sum(nil)), nil
+}
+
+// metadataNode returns the 'sops' metadata of a file encrypted with the key,
+// starting from the metadata the key was read from
+func (k *Key) metadataNode(lastModified, mac string) (*yaml.Node, error) {
+	var node yaml.Node
+	if err := node.Encode(metadata{
+		Age:               k.age,
+		LastModified:      lastModified,
+		MAC:               mac,
+		UnencryptedSuffix: k.suffix,
+		Version:           sopsVersion,
+	}); err != nil {
+		return nil, err
+	}
+	if k.original == nil {
+		return &node, nil
+	}
+
+	merged := *k.original
+	merged.Content = slices.Clone(k.original.Content)
+	// Only the unencrypted suffix is applied when encrypting, a selection
+	// made with other settings is dropped rather than half honored
+	for _, field := range []string{"encrypted_suffix", "encrypted_regex", "unencrypted_regex", "encrypted_comment_regex", "unencrypted_comment_regex", "mac_only_encrypted", "unencrypted_suffix"} {
+		removeKey(&merged, field)
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		removeKey(&merged, node.Content[i].Value)
+		merged.Content = append(merged.Content, node.Content[i], node.Content[i+1])
+	}
+	return &merged, nil
+}
+
+// unwrapDataKey decrypts the data key with the first identity it is encrypted to
+func unwrapDataKey(entries []ageEntry, identities []age.Identity) ([]byte, error) {
+	if len(identities) == 0 {
+		return nil, errors.New("no age identity to decrypt with")
+	}
+
+	for _, entry := range entries {
+		r, err := age.Decrypt(armor.NewReader(strings.NewReader(entry.Enc)), identities...)
+		if err != nil {
+			var noMatch *age.NoIdentityMatchError
+			if errors.As(err, &noMatch) {
+				continue
+			}
+			return nil, fmt.Errorf("could not decrypt data key of '%s': %w", entry.Recipient, err)
+		}
+		dataKey, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("could not decrypt data key of '%s': %w", entry.Recipient, err)
+		}
+		if len(dataKey) != dataKeySize {
+			return nil, fmt.Errorf("data key of '%s' is %d bytes, want %d", entry.Recipient, len(dataKey), dataKeySize)
+		}
+		return dataKey, nil
+	}
+
+	return nil, errors.New("none of the age identities can decrypt the data key, the file is encrypted to " + strings.Join((&Key{age: entries}).Recipients(), ", "))
+}
+
+// additionalData authenticates a value together with the keys leading to it
+func additionalData(path []string) string {
+	return strings.Join(path, ":") + ":"
+}
+
+// valueType returns the SOPS type of a scalar
+func valueType(node *yaml.Node) string {
+	switch node.Tag {
+	case "!!int":
+		return "int"
+	case "!!float":
+		return "float"
+	case "!!bool":
+		return "bool"
+	default:
+		return "str"
+	}
+}
+
+// valueBytes returns the bytes SOPS encrypts and authenticates for a scalar
+func valueBytes(node *yaml.Node) ([]byte, error) {
+	switch valueType(node) {
+	case "int":
+		var n int64
+		if err := node.Decode(&n); err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatInt(n, 10)), nil
+	case "float":
+		var f float64
+		if err := node.Decode(&f); err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatFloat(f, 'f', -1, 64)), nil
+	case "bool":
+		var b bool
+		if err := node.Decode(&b); err != nil {
+			return nil, err
+		}
+		// SOPS writes booleans the way its original Python version did
+		if b {
+			return []byte("True"), nil
+		}
+		return []byte("False"), nil
+	default:
+		return []byte(node.Value), nil
+	}
+}
+
+func (k *Key) encryptNode(node *yaml.Node, value []byte, additionalData string) error {
+	// SOPS leaves empty strings as they are
+	if len(value) == 0 {
+		return nil
+	}
+	encrypted, err := k.encryptValue(value, valueType(node), additionalData)
+	if err != nil {
+		return err
+	}
+	node.Value, node.Tag, node.Style = encrypted, "!!str", 0
+	return nil
+}
+
+func (k *Key) decryptNode(node *yaml.Node, additionalData string) error {
+	value, valueType, err := k.decryptValue(node.Value, additionalData)
+	if err != nil {
+		return err
+	}
+
+	node.Value, node.Style = value, 0
+	switch valueType {
+	case "int":
+		node.Tag = "!!int"
+	case "float":
+		node.Tag = "!!float"
+	case "bool":
+		// 'True' and 'False' become the usual YAML and JSON spelling
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid bool %q: %w", value, err)
+		}
+		node.Tag, node.Value = "!!bool", strconv.FormatBool(b)
+	default:
+		node.Tag = "!!str"
+		if strings.Contains(value, "\n") {
+			node.Style = yaml.LiteralStyle
+		}
+	}
+	return nil
+}
+
+func (k *Key) encryptValue(value []byte, valueType, additionalData string) (string, error) {
+	gcm, err := k.cipher(nonceSize)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, nonceSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", fmt.Errorf("could not generate IV: %w", err)
+	}
+
+	sealed := gcm.Seal(nil, iv, value, []byte(additionalData))
+	data, tag := sealed[:len(sealed)-tagSize], sealed[len(sealed)-tagSize:]
+	encode := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf(valueFormat, encode(data), encode(iv), encode(tag), valueType), nil
+}
+
+func (k *Key) decryptValue(value, additionalData string) (string, string, error) {
+	match := encryptedValue.FindStringSubmatch(value)
+	if match == nil {
+		return "", "", errors.New("value is not SOPS encrypted")
+	}
+
+	var parts [3][]byte
+	for i := range parts {
+		decoded, err := base64.StdEncoding.DecodeString(match[i+1])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid encrypted value: %w", err)
+		}
+		parts[i] = decoded
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+
+	gcm, err := k.cipher(len(iv))
+	if err != nil {
+		return "", "", err
+	}
+	plaintext, err := gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return "", "", errors.New("authentication failed, wrong key or tampered value")
+	}
+	return string(plaintext), match[4], nil
+}
+
+// cipher returns the AES-GCM cipher of the data key for nonces of the given size
+func (k *Key) cipher(nonceSize int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, nonceSize)
+}
+
+// parseDocument parses a YAML or JSON file whose top level is a map
+func parseDocument(content []byte) (*yaml.Node, *yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, nil, fmt.Errorf("could not parse file: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, errors.New("the top level of the file must be a map")
+	}
+	return &doc, root, nil
+}
+
+// walk calls fn with every scalar value under node and the keys leading to
+// it. List items share the path of their list.
+func walk(node *yaml.Node, path []string, fn func(node *yaml.Node, path []string) error) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := walk(node.Content[i+1], append(slices.Clip(path), node.Content[i].Value), fn); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if err := walk(item, path, fn); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return nil
+		}
+		return fn(node, path)
+	case yaml.AliasNode:
+		return fmt.Errorf("'%s': YAML aliases are not supported in encrypted files", strings.Join(path, "."))
+	}
+	return nil
+}
+
+// valueOf returns the value of a key of a map node
+func valueOf(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// removeKey removes a key of a map node and returns its value
+func removeKey(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			value := node.Content[i+1]
+			node.Content = slices.Delete(node.Content, i, i+2)
+			return value
+		}
+	}
+	return nil
+}
+
+// encode writes a document back in its format, keeping the order of keys
+func encode(doc *yaml.Node, format Format) ([]byte, error) {
+	switch format {
+	case FormatYAML:
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return nil, fmt.Errorf("could not encode file: %w", err)
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatJSON:
+		var compact bytes.Buffer
+		if err := writeJSON(&compact, doc); err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, compact.Bytes(), "", "  "); err != nil {
+			return nil, fmt.Errorf("could not encode file: %w", err)
+		}
+		out.WriteByte('\n')
+		return out.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// writeJSON writes a node as compact JSON
+func writeJSON(buf *bytes.Buffer, node *yaml.Node) error {
+	writeValue := func(value any) error {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		return writeJSON(buf, node.Content[0])
+	case yaml.AliasNode:
+		return writeJSON(buf, node.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeValue(node.Content[i].Value); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeJSON(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!null":
+			buf.WriteString("null")
+		case "!!int", "!!float":
+			value, err := valueBytes(node)
+			if err != nil {
+				return err
+			}
+			buf.Write(value)
+		case "!!bool":
+			var b bool
+			if err := node.Decode(&b); err != nil {
+				return err
+			}
+			buf.WriteString(strconv.FormatBool(b))
+		default:
+			return writeValue(node.Value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+const plainConfig = `name: api
+replicas: 3
+ratio: 0.5
+debug: false
+empty: ""
+nothing: null
+database:
+  password: s3cr3t
+  hosts:
+    - db-1
+    - db-2
+  port_unencrypted: 5432
+certificate: |
+  -----BEGIN CERTIFICATE-----
+  MIIB
+  -----END CERTIFICATE-----
+`
+
+func newTestIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+func TestEncryptDecryptYAML(t *testing.T) {
+	identity := newTestIdentity(t)
+	key, err := NewKey([]string{identity.Recipient().String()})
+	if err != nil {
+		t.Fatalf("NewKey() error = %v", err)
+	}
+
+	encrypted, err := key.Encrypt([]byte(plainConfig), FormatYAML)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	for _, leaked := range []string{"s3cr3t", "db-1", "BEGIN CERTIFICATE"} {
+		if strings.Contains(string(encrypted), leaked) {
+			t.Errorf("encrypted file contains %q:\n%s", leaked, encrypted)
+		}
+	}
+	for _, kept := range []string{"port_unencrypted: 5432", `empty: ""`, "nothing: null", "type:int]", "type:float]", "type:bool]", "recipient: " + identity.Recipient().String()} {
+		if !strings.Contains(string(encrypted), kept) {
+			t.Errorf("encrypted file does not contain %q:\n%s", kept, encrypted)
+		}
+	}
+	if !IsEncrypted(encrypted) || IsEncrypted([]byte(plainConfig)) {
+		t.Error("IsEncrypted() does not tell the encrypted file from the plaintext")
+	}
+
+	decrypted, decryptedKey, err := Decrypt(encrypted, FormatYAML, []age.Identity{identity})
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	var want, got map[string]any
+	if err := yaml.Unmarshal([]byte(plainConfig), &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(decrypted, &got); err != nil {
+		t.Fatalf("decrypted file does not parse: %v\n%s", err, decrypted)
+	}
+	if !yamlEqual(t, got, want) {
+		t.Errorf("decrypted file:\n%s\nwant:\n%s", decrypted, plainConfig)
+	}
+	if !slices.Equal(decryptedKey.Recipients(), key.Recipients()) {
+		t.Errorf("Recipients() = %v, want %v", decryptedKey.Recipients(), key.Recipients())
+	}
+	if _, err := key.Encrypt(encrypted, FormatYAML); err == nil {
+		t.Error("Encrypt() of an encrypted file expected an error")
+	}
+}
+
+func yamlEqual(t *testing.T, a, b map[string]any) bool {
+	t.Helper()
+	left, err := yaml.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	right, err := yaml.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(left) == string(right)
+}
+
+func TestEncryptDecryptJSON(t *testing.T) {
+	identity := newTestIdentity(t)
+	key, err := NewKey([]string{identity.Recipient().String()})
+	if err != nil {
+		t.Fatalf("NewKey() error = %v", err)
+	}
+
+	plain := "{\n  \"name\": \"api\",\n  \"replicas\": 3,\n  \"tls\": {\n    \"enabled\": true,\n    \"key\": \"secret\"\n  },\n  \"tags\": [\n    \"a\",\n    \"b\"\n  ]\n}\n"
+	encrypted, err := key.Encrypt([]byte(plain), FormatJSON)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if strings.Contains(string(encrypted), "secret") || !strings.Contains(string(encrypted), `"sops": {`) {
+		t.Errorf("encrypted JSON file:\n%s", encrypted)
+	}
+
+	decrypted, _, err := Decrypt(encrypted, FormatJSON, []age.Identity{identity})
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if string(decrypted) != plain {
+		t.Errorf("decrypted file:\n%s\nwant the original, keys in order:\n%s", decrypted, plain)
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	identity := newTestIdentity(t)
+	key, err := NewKey([]string{identity.Recipient().String()})
+	if err != nil {
+		t.Fatalf("NewKey() error = %v", err)
+	}
+	encrypted, err := key.Encrypt([]byte(plainConfig), FormatYAML)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	// Swapping two encrypted values keeps each of them valid on its own
+	var doc map[string]any
+	if err := yaml.Unmarshal(encrypted, &doc); err != nil {
+		t.Fatal(err)
+	}
+	swapped := strings.Replace(string(encrypted), doc["name"].(string), doc["certificate"].(string), 1)
+
+	tests := map[string]struct {
+		content    string
+		identities []age.Identity
+		want       string
+	}{
+		"not encrypted":        {content: plainConfig, identities: []age.Identity{identity}, want: "not SOPS encrypted"},
+		"wrong identity":       {content: string(encrypted), identities: []age.Identity{newTestIdentity(t)}, want: "none of the age identities"},
+		"no identity":          {content: string(encrypted), want: "no age identity"},
+		"tampered plaintext":   {content: strings.Replace(string(encrypted), "port_unencrypted: 5432", "port_unencrypted: 5433", 1), identities: []age.Identity{identity}, want: "MAC mismatch"},
+		"moved value":          {content: swapped, identities: []age.Identity{identity}, want: "could not decrypt 'name'"},
+		"other key types only": {content: "a: ENC[AES256_GCM,data:AA==,iv:AA==,tag:AA==,type:str]\nsops:\n  pgp: []\n  mac: x\n", identities: []age.Identity{identity}, want: "only age keys"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := Decrypt([]byte(tt.content), FormatYAML, tt.identities)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decrypt() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReencryptKeepsMetadata(t *testing.T) {
+	identity, other := newTestIdentity(t), newTestIdentity(t)
+	key, err := NewKey([]string{identity.Recipient().String(), other.Recipient().String()})
+	if err != nil {
+		t.Fatalf("NewKey() error = %v", err)
+	}
+	encrypted, err := key.Encrypt([]byte("token: abc\n"), FormatYAML)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	// Keys of other types are kept, the data key does not change
+	encrypted = []byte(strings.Replace(string(encrypted), "sops:\n", "sops:\n  pgp:\n    - fp: ABCDEF\n      enc: blob\n", 1))
+
+	_, decryptedKey, err := Decrypt(encrypted, FormatYAML, []age.Identity{other})
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	reencrypted, err := decryptedKey.Encrypt([]byte("token: def\n"), FormatYAML)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if !strings.Contains(string(reencrypted), "fp: ABCDEF") {
+		t.Errorf("re-encrypted file lost the pgp key:\n%s", reencrypted)
+	}
+
+	decrypted, _, err := Decrypt(reencrypted, FormatYAML, []age.Identity{identity})
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if string(decrypted) != "token: def\n" {
+		t.Errorf("decrypted = %q, want the new value for the first recipient too", decrypted)
+	}
+}
+
+func TestNewKeyErrors(t *testing.T) {
+	if _, err := NewKey(nil); err == nil {
+		t.Error("NewKey() without recipients expected an error")
+	}
+	if _, err := NewKey([]string{"age1notakey"}); err == nil {
+		t.Error("NewKey() with an invalid recipient expected an error")
+	}
+}
+
+func TestLoadIdentities(t *testing.T) {
+	identity := newTestIdentity(t)
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(keyFile, []byte("# created: today\n"+identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(KeyEnv, "")
+	t.Setenv(KeyFileEnv, keyFile)
+	identities, err := LoadIdentities()
+	if err != nil {
+		t.Fatalf("LoadIdentities() error = %v", err)
+	}
+	if recipients := IdentityRecipients(identities); len(recipients) != 1 || recipients[0] != identity.Recipient().String() {
+		t.Errorf("IdentityRecipients() = %v", recipients)
+	}
+
+	t.Setenv(KeyEnv, newTestIdentity(t).String())
+	if identities, err := LoadIdentities(); err != nil || IdentityRecipients(identities)[0] == identity.Recipient().String() {
+		t.Errorf("LoadIdentities() = %v, %v, want the identity of %s", identities, err, KeyEnv)
+	}
+
+	t.Setenv(KeyEnv, "")
+	t.Setenv(KeyFileEnv, filepath.Join(t.TempDir(), "missing.txt"))
+	if _, err := LoadIdentities(); err == nil || !strings.Contains(err.Error(), "age-keygen") {
+		t.Errorf("LoadIdentities() error = %v, want a hint to create the key file", err)
+	}
+}
+
+func TestRecipientsFor(t *testing.T) {
+	dir := t.TempDir()
+	config := "creation_rules:\n  - path_regex: ^prod/\n    age: age1prod, age1ops\n  - path_regex: config\\.ya?ml$\n    age: age1dev\n"
+	if err := os.WriteFile(filepath.Join(dir, ConfigFileName), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]string{
+		"prod/config.yaml": {"age1prod", "age1ops"},
+		"dev/config.yml":   {"age1dev"},
+		"dev/config.json":  nil,
+	}
+	for path, want := range tests {
+		got, err := RecipientsFor(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatalf("RecipientsFor(%s) error = %v", path, err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("RecipientsFor(%s) = %v, want %v", path, got, want)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ConfigFileName), []byte("creation_rules:\n  - path_regex: .*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RecipientsFor(filepath.Join(dir, "config.yaml")); err == nil {
+		t.Error("RecipientsFor() with a rule without recipients expected an error")
+	}
+}
+
+// sealLikeSOPS encrypts a value the way the sops tool does, independently of
+// Key, so files written by sops can be checked without the sops binary
+func sealLikeSOPS(t *testing.T, dataKey []byte, plaintext, valueType, additionalData string) string {
+	t.Helper()
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, 32)
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatal(err)
+	}
+	sealed := gcm.Seal(nil, iv, []byte(plaintext), []byte(additionalData))
+	encode := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]", encode(sealed[:len(sealed)-16]), encode(iv), encode(sealed[len(sealed)-16:]), valueType)
+}
+
+func TestDecryptSOPSValueEncoding(t *testing.T) {
+	identity := newTestIdentity(t)
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		t.Fatal(err)
+	}
+
+	var armored strings.Builder
+	armorWriter := armor.NewWriter(&armored)
+	w, err := age.Encrypt(armorWriter, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(dataKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := armorWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// sops encrypts and authenticates booleans as True and False, and
+	// floats without trailing zeros
+	values := []struct{ key, plaintext, valueType string }{
+		{"name", "api", "str"},
+		{"replicas", "3", "int"},
+		{"ratio", "0.5", "float"},
+		{"debug", "False", "bool"},
+		{"enabled", "True", "bool"},
+	}
+	lastModified := "2024-01-01T00:00:00Z"
+	hash := sha512.New()
+	var file strings.Builder
+	for _, value := range values {
+		hash.Write([]byte(value.plaintext))
+		fmt.Fprintf(&file, "%s: %s\n", value.key, sealLikeSOPS(t, dataKey, value.plaintext, value.valueType, value.key+":"))
+	}
+	mac := sealLikeSOPS(t, dataKey, fmt.Sprintf("%X", hash.Sum(nil)), "str", lastModified)
+	fmt.Fprintf(&file, "sops:\n  age:\n    - recipient: %s\n      enc: |\n", identity.Recipient())
+	for _, line := range strings.Split(strings.TrimSpace(armored.String()), "\n") {
+		fmt.Fprintf(&file, "        %s\n", line)
+	}
+	fmt.Fprintf(&file, "  lastmodified: \"%s\"\n  mac: %s\n  unencrypted_suffix: _unencrypted\n  version: 3.9.0\n", lastModified, mac)
+
+	decrypted, key, err := Decrypt([]byte(file.String()), FormatYAML, []age.Identity{identity})
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v\n%s", err, file.String())
+	}
+	if want := "name: api\nreplicas: 3\nratio: 0.5\ndebug: false\nenabled: true\n"; string(decrypted) != want {
+		t.Errorf("decrypted = %q, want %q", decrypted, want)
+	}
+
+	// Encrypting writes the same bytes sops would
+	encrypted, err := key.Encrypt(decrypted, FormatYAML)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(encrypted, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range values {
+		plaintext, valueType, err := key.decryptValue(doc[value.key].(string), value.key+":")
+		if err != nil {
+			t.Fatalf("decryptValue(%s) error = %v", value.key, err)
+		}
+		if plaintext != value.plaintext || valueType != value.valueType {
+			t.Errorf("%s encrypted as %q (%s), want %q (%s)", value.key, plaintext, valueType, value.plaintext, value.valueType)
+		}
+	}
+
+	// JSON output keeps JSON booleans
+	decryptedJSON, _, err := Decrypt([]byte(file.String()), FormatJSON, []age.Identity{identity})
+	if err != nil {
+		t.Fatalf("Decrypt() as JSON error = %v", err)
+	}
+	if !strings.Contains(string(decryptedJSON), `"debug": false`) || !strings.Contains(string(decryptedJSON), `"enabled": true`) {
+		t.Errorf("decrypted JSON:\n%s", decryptedJSON)
+	}
+}
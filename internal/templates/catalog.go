@@ -0,0 +1,142 @@
+package templates
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Component sources, from lowest to highest precedence
+const (
+	SourceBuiltin = "builtin"
+	SourceUser    = "user"
+	SourceProject = "project"
+)
+
+// componentExtensions are the file extensions recognized as components in a catalog directory
+var componentExtensions = []string{".yaml", ".yml", ".tmpl"}
+
+// Component is a template that add can scaffold into a repo
+type Component struct {
+	Name        string
+	Source      string
+	Description string
+	Path        string
+	Overrides   string
+	Content     []byte
+}
+
+// Catalog resolves components from the embedded registry and from component directories
+type Catalog struct {
+	components map[string]Component
+}
+
+// CatalogDir is a directory of component files and the source it represents
+type CatalogDir struct {
+	Path   string
+	Source string
+}
+
+// LoadCatalog builds a catalog from the built-in components plus every given
+// directory. Later directories take precedence over earlier ones and over
+// built-ins, missing directories are skipped.
+func LoadCatalog(dirs ...CatalogDir) (*Catalog, error) {
+	catalog := &Catalog{components: make(map[string]Component)}
+
+	for _, name := range AllowedComponents {
+		catalog.components[name] = Component{
+			Name:        name,
+			Source:      SourceBuiltin,
+			Description: ComponentDescriptions[name],
+			Content:     TemplateRegistry[name],
+		}
+	}
+
+	for _, dir := range dirs {
+		if err := catalog.loadDir(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return catalog, nil
+}
+
+func (c *Catalog) loadDir(dir CatalogDir) error {
+	entries, err := os.ReadDir(dir.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read %s components directory '%s': %w", dir.Source, dir.Path, err)
+	}
+
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !slices.Contains(componentExtensions, ext) {
+			continue
+		}
+
+		path := filepath.Join(dir.Path, entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read component '%s': %w", path, err)
+		}
+
+		name := strings.ToLower(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		component := Component{
+			Name:        name,
+			Source:      dir.Source,
+			Description: componentDescription(content),
+			Path:        path,
+			Content:     content,
+		}
+		if existing, ok := c.components[name]; ok {
+			component.Overrides = existing.Source
+		}
+
+		c.components[name] = component
+	}
+
+	return nil
+}
+
+// componentDescription reads the description from a leading
+// '# description: ...' comment of a component file
+func componentDescription(content []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+
+		comment := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		key, value, found := strings.Cut(comment, ":")
+		if found && strings.EqualFold(strings.TrimSpace(key), "description") {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// Get returns the component with the given name
+func (c *Catalog) Get(name string) (Component, bool) {
+	component, ok := c.components[strings.ToLower(name)]
+	return component, ok
+}
+
+// List returns every component sorted by name
+func (c *Catalog) List() []Component {
+	components := make([]Component, 0, len(c.components))
+	for _, component := range c.components {
+		components = append(components, component)
+	}
+	slices.SortFunc(components, func(a, b Component) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return components
+}
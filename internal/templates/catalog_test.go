@@ -0,0 +1,101 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCatalogBuiltins(t *testing.T) {
+	catalog, err := LoadCatalog()
+	if err != nil {
+		t.Fatalf("LoadCatalog() error = %v", err)
+	}
+
+	for _, name := range AllowedComponents {
+		component, ok := catalog.Get(name)
+		if !ok {
+			t.Errorf("built-in component %s missing from catalog", name)
+			continue
+		}
+		if component.Source != SourceBuiltin {
+			t.Errorf("%s source = %q, want %q", name, component.Source, SourceBuiltin)
+		}
+		if component.Description == "" {
+			t.Errorf("%s has no description", name)
+		}
+	}
+
+	if len(catalog.List()) != len(AllowedComponents) {
+		t.Errorf("catalog has %d components, want %d", len(catalog.List()), len(AllowedComponents))
+	}
+}
+
+func TestLoadCatalogPrecedence(t *testing.T) {
+	userDir := t.TempDir()
+	projectDir := t.TempDir()
+
+	files := map[string]string{
+		filepath.Join(userDir, "deployment.yaml"):      "# description: user deployment\nkind: Deployment\n",
+		filepath.Join(userDir, "worker.tmpl"):          "# description: user worker\nkind: Deployment\n",
+		filepath.Join(userDir, "notes.txt"):            "not a component",
+		filepath.Join(projectDir, "worker.yml"):        "# Description: project worker\nkind: Deployment\n",
+		filepath.Join(projectDir, "backup.yaml"):       "kind: CronJob\n",
+		filepath.Join(projectDir, "Redis.yaml"):        "# some comment\n# description: redis\nkind: StatefulSet\n",
+		filepath.Join(projectDir, "ignored", "x.yaml"): "kind: Pod\n",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	catalog, err := LoadCatalog(
+		CatalogDir{Path: userDir, Source: SourceUser},
+		CatalogDir{Path: projectDir, Source: SourceProject},
+		CatalogDir{Path: filepath.Join(projectDir, "missing"), Source: SourceProject},
+	)
+	if err != nil {
+		t.Fatalf("LoadCatalog() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		source      string
+		overrides   string
+		description string
+	}{
+		{"deployment", SourceUser, SourceBuiltin, "user deployment"},
+		{"worker", SourceProject, SourceUser, "project worker"},
+		{"backup", SourceProject, "", ""},
+		{"redis", SourceProject, "", "redis"},
+		{"service", SourceBuiltin, "", ComponentDescriptions["service"]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			component, ok := catalog.Get(tt.name)
+			if !ok {
+				t.Fatalf("component %s not found", tt.name)
+			}
+			if component.Source != tt.source {
+				t.Errorf("source = %q, want %q", component.Source, tt.source)
+			}
+			if component.Overrides != tt.overrides {
+				t.Errorf("overrides = %q, want %q", component.Overrides, tt.overrides)
+			}
+			if component.Description != tt.description {
+				t.Errorf("description = %q, want %q", component.Description, tt.description)
+			}
+		})
+	}
+
+	for _, name := range []string{"notes", "x", "ignored"} {
+		if _, ok := catalog.Get(name); ok {
+			t.Errorf("unexpected component %s in catalog", name)
+		}
+	}
+}
@@ -3,23 +3,72 @@ package templates
 type component string
 
 const (
-	deployment component = "deployment"
-	service    component = "service"
-	httpRoute  component = "httproute"
-	secret     component = "secret"
-	configmap  component = "configmap"
-	hpa        component = "hpa"
-	hcpolicy   component = "hcpolicy"
+	deployment     component = "deployment"
+	service        component = "service"
+	httpRoute      component = "httproute"
+	secret         component = "secret"
+	configmap      component = "configmap"
+	hpa            component = "hpa"
+	hcpolicy       component = "hcpolicy"
+	statefulset    component = "statefulset"
+	daemonset      component = "daemonset"
+	job            component = "job"
+	cronjob        component = "cronjob"
+	ingress        component = "ingress"
+	networkpolicy  component = "networkpolicy"
+	pdb            component = "pdb"
+	gateway        component = "gateway"
+	serviceaccount component = "serviceaccount"
+	role           component = "role"
+	clusterrole    component = "clusterrole"
+	pvc            component = "pvc"
 )
 
-var AllowedComponents = []string{string(deployment), string(service), string(httpRoute), string(secret), string(configmap), string(hpa), string(hcpolicy)}
+var AllowedComponents = []string{string(deployment), string(service), string(httpRoute), string(secret), string(configmap), string(hpa), string(hcpolicy),
+	string(statefulset), string(daemonset), string(job), string(cronjob),
+	string(ingress), string(networkpolicy), string(pdb), string(gateway),
+	string(serviceaccount), string(role), string(clusterrole), string(pvc)}
 
 var TemplateRegistry = map[string][]byte{
-	string(deployment): deploymentTemplate,
-	string(service):    serviceTemplate,
-	string(httpRoute):  httpRouteTemplate,
-	string(secret):     secretTemplate,
-	string(configmap):  configMapTemplate,
-	string(hpa):        hpaTemplate,
-	string(hcpolicy):   hcPolicyTemplate,
+	string(deployment):     deploymentTemplate,
+	string(service):        serviceTemplate,
+	string(httpRoute):      httpRouteTemplate,
+	string(secret):         secretTemplate,
+	string(configmap):      configMapTemplate,
+	string(hpa):            hpaTemplate,
+	string(hcpolicy):       hcPolicyTemplate,
+	string(statefulset):    statefulSetTemplate,
+	string(daemonset):      daemonSetTemplate,
+	string(job):            jobTemplate,
+	string(cronjob):        cronJobTemplate,
+	string(ingress):        ingressTemplate,
+	string(networkpolicy):  networkPolicyTemplate,
+	string(pdb):            pdbTemplate,
+	string(gateway):        gatewayTemplate,
+	string(serviceaccount): serviceAccountTemplate,
+	string(role):           roleTemplate,
+	string(clusterrole):    clusterRoleTemplate,
+	string(pvc):            pvcTemplate,
+}
+
+var ComponentDescriptions = map[string]string{
+	string(deployment):     "Define workloads with containers, replicas, and rollout strategy",
+	string(service):        "Expose your application as a network-accessible service",
+	string(httpRoute):      "Configure HTTP routing rules for ingress traffic",
+	string(secret):         "Securely store sensitive values like tokens, passwords, and certificates",
+	string(configmap):      "Provide configuration values and environment variables as key-value pairs",
+	string(hpa):            "Horizontal Pod Autoscaler for automatic scaling",
+	string(hcpolicy):       "Health Check Policy configuration",
+	string(statefulset):    "Stateful workload with stable identities, per-pod volumes and its headless Service",
+	string(daemonset):      "Run a pod on every node, e.g. for log collectors or node agents",
+	string(job):            "Run pods to completion for one-off tasks",
+	string(cronjob):        "Run a Job on a schedule",
+	string(ingress):        "Route external HTTP traffic to a Service through an Ingress controller",
+	string(networkpolicy):  "Deny ingress traffic by default and allow it from a namespace",
+	string(pdb):            "Keep a minimum of pods available during voluntary disruptions",
+	string(gateway):        "Gateway API entry point for the HTTPRoute component",
+	string(serviceaccount): "Identity the app pods run as, picked up by workloads added with it",
+	string(role):           "Namespaced Role and the RoleBinding granting it to the ServiceAccount",
+	string(clusterrole):    "ClusterRole and the ClusterRoleBinding granting it to the ServiceAccount",
+	string(pvc):            "Request persistent storage for the app",
 }
@@ -0,0 +1,304 @@
+package templates
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// HelmFuncs maps Maniplacer template functions to their Helm (Sprig) equivalents
+var HelmFuncs = map[string]string{
+	"Base64":  "b64enc",
+	"ToUpper": "upper",
+	"ToLower": "lower",
+	"Quote":   "quote",
+}
+
+// HelmTemplate is a Maniplacer template translated for a Helm chart
+type HelmTemplate struct {
+	Content []byte
+	Defines []string // Names of the templates it defines, global across a chart in Helm
+}
+
+// textEdit replaces the source bytes in [start, end) with text
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// ToHelmTemplate translates a Maniplacer template to a Helm chart template:
+// config values move under '.Values' and functions are renamed to their
+// Sprig equivalents. Everything outside template actions is kept byte for byte.
+func ToHelmTemplate(name string, content []byte) (*HelmTemplate, error) {
+	tmpl, err := template.New(name).Funcs(ManiplacerFuncs).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template: %w", err)
+	}
+
+	translator := &helmTranslator{}
+	result := &HelmTemplate{}
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		// Defined templates get whatever dot they are called with, only the
+		// main template starts at the root of the values
+		root := t.Name() == name
+		if !root {
+			result.Defines = append(result.Defines, t.Name())
+		}
+		translator.walk(t.Tree.Root, root, root)
+	}
+	slices.Sort(result.Defines)
+
+	result.Content = translator.apply(content)
+	return result, nil
+}
+
+type helmTranslator struct {
+	edits []textEdit
+}
+
+// walk collects the edits of a node. atRoot tells whether dot is the root of
+// the config there, rootVars whether '$' is.
+func (h *helmTranslator) walk(node parse.Node, atRoot, rootVars bool) {
+	visitTemplate(node, atRoot, rootVars, func(node parse.Node, atRoot, rootVars bool) bool {
+		switch n := node.(type) {
+		case *parse.IdentifierNode:
+			if helmName, ok := HelmFuncs[n.Ident]; ok {
+				start := int(n.Position())
+				h.edits = append(h.edits, textEdit{start, start + len(n.Ident), helmName})
+			}
+		case *parse.DotNode:
+			if atRoot {
+				start := int(n.Position())
+				h.edits = append(h.edits, textEdit{start, start + 1, ".Values"})
+			}
+		case *parse.FieldNode:
+			if atRoot {
+				h.edits = append(h.edits, textEdit{fieldStart(n), fieldStart(n), ".Values"})
+			}
+		case *parse.VariableNode:
+			if rootVars && n.Ident[0] == "$" {
+				start := variableStart(n)
+				h.edits = append(h.edits, textEdit{start + 1, start + 1, ".Values"})
+			}
+		}
+		return true
+	})
+}
+
+// visitTemplate calls visit on node and, unless visit returns false, on every
+// node below it. atRoot tells whether dot is the root of the data there,
+// rootVars whether '$' is.
+func visitTemplate(node parse.Node, atRoot, rootVars bool, visit func(node parse.Node, atRoot, rootVars bool) bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+	}
+	if !visit(node, atRoot, rootVars) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		for _, child := range n.Nodes {
+			visitTemplate(child, atRoot, rootVars, visit)
+		}
+	case *parse.ActionNode:
+		visitTemplate(n.Pipe, atRoot, rootVars, visit)
+	case *parse.PipeNode:
+		for _, decl := range n.Decl {
+			visitTemplate(decl, atRoot, rootVars, visit)
+		}
+		for _, cmd := range n.Cmds {
+			visitTemplate(cmd, atRoot, rootVars, visit)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			visitTemplate(arg, atRoot, rootVars, visit)
+		}
+	case *parse.ChainNode:
+		visitTemplate(n.Node, atRoot, rootVars, visit)
+	case *parse.IfNode:
+		visitTemplate(n.Pipe, atRoot, rootVars, visit)
+		visitTemplate(n.List, atRoot, rootVars, visit)
+		visitTemplate(n.ElseList, atRoot, rootVars, visit)
+	case *parse.RangeNode:
+		// Dot is each element inside range, back to the original dot in else
+		visitTemplate(n.Pipe, atRoot, rootVars, visit)
+		visitTemplate(n.List, false, rootVars, visit)
+		visitTemplate(n.ElseList, atRoot, rootVars, visit)
+	case *parse.WithNode:
+		visitTemplate(n.Pipe, atRoot, rootVars, visit)
+		visitTemplate(n.List, false, rootVars, visit)
+		visitTemplate(n.ElseList, atRoot, rootVars, visit)
+	case *parse.TemplateNode:
+		visitTemplate(n.Pipe, atRoot, rootVars, visit)
+	}
+}
+
+// variableStart returns where a variable node starts in the source. '$' and
+// '$.x' are lexed together, chained fields move the node position to the second segment.
+func variableStart(n *parse.VariableNode) int {
+	start := int(n.Position())
+	if len(n.Ident) > 1 {
+		start -= len(n.Ident[0])
+	}
+	return start
+}
+
+// fieldStart returns where a field node starts in the source. The parser
+// places chained fields like '.a.b' at their second segment.
+func fieldStart(n *parse.FieldNode) int {
+	start := int(n.Position())
+	if len(n.Ident) > 1 {
+		start -= len(n.Ident[0]) + 1
+	}
+	return start
+}
+
+// apply returns content with every edit applied
+func (h *helmTranslator) apply(content []byte) []byte {
+	edits := slices.Clone(h.edits)
+	slices.SortFunc(edits, func(a, b textEdit) int { return a.start - b.start })
+
+	var b strings.Builder
+	last := 0
+	for _, edit := range edits {
+		b.Write(content[last:edit.start])
+		b.WriteString(edit.text)
+		last = edit.end
+	}
+	b.Write(content[last:])
+	return []byte(b.String())
+}
+
+// helmBuiltinObjects are the top level objects Helm provides besides .Values,
+// none of which exist in Maniplacer
+var helmBuiltinObjects = []string{"Release", "Chart", "Capabilities", "Template", "Files", "Subcharts"}
+
+// templateBuiltins are the functions text/template itself provides
+var templateBuiltins = []string{
+	"and", "call", "html", "index", "slice", "js", "len", "not", "or", "print", "printf", "println", "urlquery",
+	"eq", "ge", "gt", "le", "lt", "ne",
+}
+
+// ManiplacerTemplate is a Helm chart template translated for Maniplacer
+type ManiplacerTemplate struct {
+	Content     []byte
+	Unsupported []string // Helm features the template uses that Maniplacer cannot render
+}
+
+// FromHelmTemplate translates a Helm chart template to a Maniplacer template,
+// the reverse of ToHelmTemplate: '.Values' references point at the config,
+// Sprig functions with a Maniplacer equivalent are renamed and
+// '{{ include "name" . }}' actions become '{{ template "name" . }}'. Built-in
+// objects such as .Release and functions Maniplacer does not provide are
+// listed as unsupported, everything else is kept byte for byte.
+func FromHelmTemplate(name string, content []byte) (*ManiplacerTemplate, error) {
+	// Helm templates use Sprig functions text/template does not know about
+	tree := parse.New(name)
+	tree.Mode = parse.SkipFuncCheck
+	trees := make(map[string]*parse.Tree)
+	if _, err := tree.Parse(string(content), "{{", "}}", trees); err != nil {
+		return nil, fmt.Errorf("could not parse template: %w", err)
+	}
+
+	maniplacerNames := make(map[string]string, len(HelmFuncs))
+	for maniplacerName, helmName := range HelmFuncs {
+		maniplacerNames[helmName] = maniplacerName
+	}
+
+	importer := &helmTranslator{}
+	unsupported := make(map[string]bool)
+	includes := make(map[*parse.IdentifierNode]bool)
+
+	for _, t := range trees {
+		visitTemplate(t.Root, true, true, func(node parse.Node, _, _ bool) bool {
+			switch n := node.(type) {
+			case *parse.ActionNode:
+				if include, ok := standaloneInclude(n); ok {
+					start := int(include.Position())
+					importer.edits = append(importer.edits, textEdit{start, start + len(include.Ident), "template"})
+					includes[include] = true
+				}
+			case *parse.IdentifierNode:
+				if includes[n] {
+					break
+				}
+				if maniplacerName, ok := maniplacerNames[n.Ident]; ok {
+					start := int(n.Position())
+					importer.edits = append(importer.edits, textEdit{start, start + len(n.Ident), maniplacerName})
+				} else if _, ok := ManiplacerFuncs[n.Ident]; !ok && !slices.Contains(templateBuiltins, n.Ident) {
+					unsupported[fmt.Sprintf("function '%s'", n.Ident)] = true
+				}
+			case *parse.FieldNode, *parse.VariableNode:
+				importer.walkValues(n, unsupported)
+			}
+			return true
+		})
+	}
+
+	result := &ManiplacerTemplate{Content: importer.apply(content)}
+	for feature := range unsupported {
+		result.Unsupported = append(result.Unsupported, feature)
+	}
+	slices.Sort(result.Unsupported)
+	return result, nil
+}
+
+// walkValues drops '.Values' from a field or '$' variable, recording the
+// other Helm built-in objects as unsupported
+func (h *helmTranslator) walkValues(node parse.Node, unsupported map[string]bool) {
+	var idents []string
+	var start int
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		idents, start = n.Ident, fieldStart(n)
+	case *parse.VariableNode:
+		if n.Ident[0] != "$" || len(n.Ident) < 2 {
+			return
+		}
+		// Skip the '$', what follows reads like a field
+		idents, start = n.Ident[1:], variableStart(n)+1
+	default:
+		return
+	}
+
+	switch {
+	case idents[0] == "Values" && len(idents) == 1 && node.Type() == parse.NodeField:
+		h.edits = append(h.edits, textEdit{start, start + len(".Values"), "."})
+	case idents[0] == "Values":
+		h.edits = append(h.edits, textEdit{start, start + len(".Values"), ""})
+	case slices.Contains(helmBuiltinObjects, idents[0]):
+		unsupported["."+idents[0]] = true
+	}
+}
+
+// standaloneInclude returns the 'include' identifier of an action that only
+// includes a named template, which Maniplacer renders with the template action
+func standaloneInclude(action *parse.ActionNode) (*parse.IdentifierNode, bool) {
+	pipe := action.Pipe
+	if len(pipe.Decl) > 0 || len(pipe.Cmds) != 1 {
+		return nil, false
+	}
+
+	args := pipe.Cmds[0].Args
+	include, ok := args[0].(*parse.IdentifierNode)
+	if !ok || include.Ident != "include" || len(args) > 3 || len(args) < 2 {
+		return nil, false
+	}
+	if _, ok := args[1].(*parse.StringNode); !ok {
+		return nil, false
+	}
+	return include, true
+}
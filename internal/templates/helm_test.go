@@ -0,0 +1,131 @@
+package templates
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestToHelmTemplate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"field", "image: {{ .image }}", "image: {{ .Values.image }}"},
+		{"chained field", "port: {{ .service.port }}", "port: {{ .Values.service.port }}"},
+		{"dot", `{{ printf "%v" . }}`, `{{ printf "%v" .Values }}`},
+		{"root variable", "{{ $.namespace }}", "{{ $.Values.namespace }}"},
+		{"chained root variable", "{{ $.db.host }}", "{{ $.Values.db.host }}"},
+		{"functions", "{{ Base64 .password }} {{ .name | ToUpper | Quote }}", "{{ b64enc .Values.password }} {{ .Values.name | upper | quote }}"},
+		{"index", `{{ index .labels "app" }}`, `{{ index .Values.labels "app" }}`},
+		{"if else", "{{ if .debug }}on{{ else }}{{ .mode }}{{ end }}", "{{ if .Values.debug }}on{{ else }}{{ .Values.mode }}{{ end }}"},
+		{
+			"range keeps element fields",
+			"{{ range .ports }}- {{ .port }} {{ $.name }}\n{{ end }}",
+			"{{ range .Values.ports }}- {{ .port }} {{ $.Values.name }}\n{{ end }}",
+		},
+		{"with", "{{ with .db }}{{ .host }}{{ else }}{{ .fallback }}{{ end }}", "{{ with .Values.db }}{{ .host }}{{ else }}{{ .Values.fallback }}{{ end }}"},
+		{"variables", "{{ $n := .name }}{{ $n }}", "{{ $n := .Values.name }}{{ $n }}"},
+		{"trim markers and text kept", "a: 1 # {{- .x -}} \n", "a: 1 # {{- .Values.x -}} \n"},
+		{
+			"define takes the dot it is given",
+			`{{ define "labels" }}app: {{ .name }}{{ end }}{{ template "labels" . }}`,
+			`{{ define "labels" }}app: {{ .name }}{{ end }}{{ template "labels" .Values }}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToHelmTemplate("test.yaml", []byte(tt.input))
+			if err != nil {
+				t.Fatalf("ToHelmTemplate() error = %v", err)
+			}
+			if string(got.Content) != tt.want {
+				t.Errorf("ToHelmTemplate() =\n%s\nwant\n%s", got.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestToHelmTemplateDefines(t *testing.T) {
+	got, err := ToHelmTemplate("test.yaml", []byte(`{{ define "b" }}{{ end }}{{ define "a" }}{{ end }}kind: Service`))
+	if err != nil {
+		t.Fatalf("ToHelmTemplate() error = %v", err)
+	}
+	if !slices.Equal(got.Defines, []string{"a", "b"}) {
+		t.Errorf("Defines = %v, want [a b]", got.Defines)
+	}
+}
+
+func TestToHelmTemplateParseError(t *testing.T) {
+	if _, err := ToHelmTemplate("test.yaml", []byte("{{ unknownFunc .x }}")); err == nil {
+		t.Error("ToHelmTemplate() expected an error for an unknown function")
+	}
+}
+
+func TestFromHelmTemplate(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		want            string
+		wantUnsupported []string
+	}{
+		{"values field", "image: {{ .Values.image }}", "image: {{ .image }}", nil},
+		{"chained values field", "port: {{ .Values.service.port }}", "port: {{ .service.port }}", nil},
+		{"values alone", `{{ printf "%v" .Values }}`, `{{ printf "%v" . }}`, nil},
+		{"root variable", "{{ $.Values.namespace }}", "{{ $.namespace }}", nil},
+		{"root variable alone", `{{ printf "%v" $.Values }}`, `{{ printf "%v" $ }}`, nil},
+		{"sprig functions", "{{ .Values.password | b64enc | quote }}", "{{ .password | Base64 | Quote }}", nil},
+		{"range", "{{ range .Values.ports }}- {{ .port }}{{ end }}", "{{ range .ports }}- {{ .port }}{{ end }}", nil},
+		{"standalone include", `{{ include "app.labels" . }}`, `{{ template "app.labels" . }}`, nil},
+		{
+			"piped include",
+			`{{ include "app.labels" . | nindent 4 }}`,
+			`{{ include "app.labels" . | nindent 4 }}`,
+			[]string{"function 'include'", "function 'nindent'"},
+		},
+		{
+			"built-in objects",
+			"{{ .Release.Name }}-{{ $.Chart.Version }}-{{ .Values.name }}",
+			"{{ .Release.Name }}-{{ $.Chart.Version }}-{{ .name }}",
+			[]string{".Chart", ".Release"},
+		},
+		{
+			"define",
+			`{{- define "app.name" -}}{{ default .Chart.Name .Values.nameOverride }}{{- end }}`,
+			`{{- define "app.name" -}}{{ default .Chart.Name .nameOverride }}{{- end }}`,
+			[]string{".Chart", "function 'default'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromHelmTemplate("test.yaml", []byte(tt.input))
+			if err != nil {
+				t.Fatalf("FromHelmTemplate() error = %v", err)
+			}
+			if string(got.Content) != tt.want {
+				t.Errorf("FromHelmTemplate() =\n%s\nwant\n%s", got.Content, tt.want)
+			}
+			if !slices.Equal(got.Unsupported, tt.wantUnsupported) {
+				t.Errorf("Unsupported = %v, want %v", got.Unsupported, tt.wantUnsupported)
+			}
+		})
+	}
+}
+
+func TestHelmRoundTrip(t *testing.T) {
+	input := "{{ range $k, $v := .labels }}{{ $k }}: {{ $v | ToLower | Quote }}\n{{ end }}name: {{ $.name }}\n"
+
+	helm, err := ToHelmTemplate("test.yaml", []byte(input))
+	if err != nil {
+		t.Fatalf("ToHelmTemplate() error = %v", err)
+	}
+	back, err := FromHelmTemplate("test.yaml", helm.Content)
+	if err != nil {
+		t.Fatalf("FromHelmTemplate() error = %v", err)
+	}
+	if string(back.Content) != input {
+		t.Errorf("round trip =\n%s\nwant\n%s", back.Content, input)
+	}
+}
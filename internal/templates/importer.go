@@ -0,0 +1,381 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ImportSource is a manifest file, or any other stream of YAML documents, to import
+type ImportSource struct {
+	Path    string
+	Content []byte
+}
+
+// ImportedTemplate is a single Kubernetes object turned into a template
+type ImportedTemplate struct {
+	FileName string
+	Kind     string
+	Name     string
+	Source   string
+	Content  []byte
+}
+
+// ImportResult holds the templates created by ImportManifests and the values
+// lifted out of them, which belong in the repo config
+type ImportResult struct {
+	Templates []ImportedTemplate
+	Values    map[string]any
+}
+
+// importedObject is a parsed object waiting to be written as a template
+type importedObject struct {
+	doc    *yaml.Node
+	kind   string
+	name   string
+	source string
+}
+
+// importOccurrence is a field whose value may be lifted into the repo config.
+// Candidates are config paths ordered from the most shared to the most specific.
+type importOccurrence struct {
+	node       *yaml.Node
+	value      any
+	candidates [][]string
+}
+
+// identifierRegex matches the names text/template accepts after a dot
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// fileNameRegex matches the characters replaced when naming an imported template
+var fileNameRegex = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// podSpecPaths are the places a pod spec is found in the objects import knows about
+var podSpecPaths = []string{"spec.template.spec", "spec.jobTemplate.spec.template.spec", "spec"}
+
+// labelPaths are the label maps of an object that import lifts common labels from
+var labelPaths = []string{
+	"metadata.labels",
+	"spec.selector.matchLabels",
+	"spec.template.metadata.labels",
+	"spec.jobTemplate.spec.template.metadata.labels",
+}
+
+// ImportManifests splits every document of sources into one template per
+// object. With extract, the namespace, container images, replicas and labels
+// are replaced by template expressions and returned as config values. A value
+// shared by every object goes under a single key (e.g. 'image'), differing
+// values get more specific keys (e.g. 'workerImage').
+func ImportManifests(sources []ImportSource, extract bool) (*ImportResult, error) {
+	var objects []importedObject
+	for _, source := range sources {
+		parsed, err := parseObjects(source)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, parsed...)
+	}
+
+	result := &ImportResult{Values: make(map[string]any)}
+
+	expressions := make(map[string]string)
+	if extract {
+		var occurrences []importOccurrence
+		for _, object := range objects {
+			occurrences = append(occurrences, objectOccurrences(object)...)
+		}
+		liftValues(occurrences, result.Values, expressions)
+	}
+
+	taken := make(map[string]int)
+	for _, object := range objects {
+		content, err := encodeTemplate(object.doc, expressions)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", object.source, err)
+		}
+
+		base := templateFileBase(object.kind, object.name)
+		taken[base]++
+		fileName := base + ".yaml"
+		if taken[base] > 1 {
+			fileName = fmt.Sprintf("%s-%d.yaml", base, taken[base])
+		}
+
+		result.Templates = append(result.Templates, ImportedTemplate{
+			FileName: fileName,
+			Kind:     object.kind,
+			Name:     object.name,
+			Source:   object.source,
+			Content:  content,
+		})
+	}
+
+	return result, nil
+}
+
+// parseObjects returns every object of a source, expanding 'kind: List' documents
+func parseObjects(source ImportSource) ([]importedObject, error) {
+	docs, err := decodeNodes(source.Content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source.Path, err)
+	}
+
+	var objects []importedObject
+	for i, doc := range docs {
+		if len(doc.Content) == 0 || doc.Content[0].Kind == yaml.ScalarNode && doc.Content[0].Tag == "!!null" {
+			continue // Empty document
+		}
+
+		if DocumentKind(doc) == "List" {
+			items := LookupPath(doc, "items")
+			if items == nil || items.Kind != yaml.SequenceNode {
+				return nil, fmt.Errorf("%s: document %d is a List without items", source.Path, i+1)
+			}
+			for j, item := range items.Content {
+				object, err := newImportedObject(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{item}}, source.Path)
+				if err != nil {
+					return nil, fmt.Errorf("%s: item %d of document %d: %w", source.Path, j+1, i+1, err)
+				}
+				objects = append(objects, object)
+			}
+			continue
+		}
+
+		object, err := newImportedObject(doc, source.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: document %d: %w", source.Path, i+1, err)
+		}
+		objects = append(objects, object)
+	}
+
+	return objects, nil
+}
+
+func newImportedObject(doc *yaml.Node, source string) (importedObject, error) {
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return importedObject{}, fmt.Errorf("not a Kubernetes object")
+	}
+
+	kind := DocumentKind(doc)
+	name := LookupPath(doc, "metadata.name")
+	if kind == "" || name == nil || name.Value == "" {
+		return importedObject{}, fmt.Errorf("not a Kubernetes object, kind and metadata.name are required")
+	}
+
+	return importedObject{doc: doc, kind: kind, name: name.Value, source: source}, nil
+}
+
+// objectOccurrences lists the fields of an object that import can lift into the config
+func objectOccurrences(object importedObject) []importOccurrence {
+	var occurrences []importOccurrence
+
+	if node := LookupPath(object.doc, "metadata.namespace"); isPlainString(node) {
+		occurrences = append(occurrences, importOccurrence{
+			node:       node,
+			value:      node.Value,
+			candidates: [][]string{{"namespace"}},
+		})
+	}
+
+	switch object.kind {
+	case "Deployment", "StatefulSet", "ReplicaSet":
+		if node := LookupPath(object.doc, "spec.replicas"); node != nil && node.Kind == yaml.ScalarNode && node.Tag == "!!int" {
+			var replicas int
+			if err := node.Decode(&replicas); err == nil {
+				occurrences = append(occurrences, importOccurrence{
+					node:       node,
+					value:      replicas,
+					candidates: configPaths([]string{"replicas"}, []string{object.name, "replicas"}),
+				})
+			}
+		}
+	}
+
+	for _, podSpec := range podSpecPaths {
+		spec := LookupPath(object.doc, podSpec)
+		if spec == nil || LookupPath(spec, "containers") == nil {
+			continue
+		}
+		for _, field := range []string{"initContainers", "containers"} {
+			containers := LookupPath(spec, field)
+			if containers == nil || containers.Kind != yaml.SequenceNode {
+				continue
+			}
+			for _, container := range containers.Content {
+				image := LookupPath(container, "image")
+				if !isPlainString(image) {
+					continue
+				}
+				containerName := ""
+				if name := LookupPath(container, "name"); name != nil {
+					containerName = name.Value
+				}
+				occurrences = append(occurrences, importOccurrence{
+					node:  image,
+					value: image.Value,
+					candidates: configPaths(
+						[]string{"image"},
+						[]string{containerName, "image"},
+						[]string{object.name, containerName, "image"},
+					),
+				})
+			}
+		}
+		break
+	}
+
+	paths := labelPaths
+	if object.kind == "Service" {
+		paths = append(slices.Clone(paths), "spec.selector")
+	}
+	for _, path := range paths {
+		labels := LookupPath(object.doc, path)
+		if labels == nil || labels.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(labels.Content); i += 2 {
+			key, value := labels.Content[i].Value, labels.Content[i+1]
+			if !isPlainString(value) {
+				continue
+			}
+			occurrences = append(occurrences, importOccurrence{
+				node:       value,
+				value:      value.Value,
+				candidates: [][]string{{"labels", key}},
+			})
+		}
+	}
+
+	return occurrences
+}
+
+// liftValues picks the config path of every occurrence, stores the values and
+// records the expression replacing each occurrence, keyed by a sentinel written in its place
+func liftValues(occurrences []importOccurrence, values map[string]any, expressions map[string]string) {
+	// Every occurrence sharing a config path must hold the same value
+	consistent := func(path []string, value any) bool {
+		for _, other := range occurrences {
+			for _, candidate := range other.candidates {
+				if slices.Equal(candidate, path) && other.value != value {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	for i, occurrence := range occurrences {
+		for _, path := range occurrence.candidates {
+			if !consistent(path, occurrence.value) {
+				continue
+			}
+
+			setConfigValue(values, path, occurrence.value)
+
+			sentinel := fmt.Sprintf("MANIPLACER_IMPORT_%d_", i)
+			expressions[sentinel] = pathExpression(path)
+			setPlainScalar(occurrence.node, sentinel)
+			break
+		}
+	}
+}
+
+// configPaths turns name parts into camelCase config keys, dropping the ones
+// that would not be valid template identifiers and duplicates
+func configPaths(parts ...[]string) [][]string {
+	var paths [][]string
+	for _, words := range parts {
+		key := camelCase(words...)
+		if !identifierRegex.MatchString(key) {
+			continue
+		}
+		if !slices.ContainsFunc(paths, func(path []string) bool { return path[0] == key }) {
+			paths = append(paths, []string{key})
+		}
+	}
+	return paths
+}
+
+// camelCase joins words split on anything but letters and digits, e.g. 'api-server' and 'image' become 'apiServerImage'
+func camelCase(words ...string) string {
+	var b strings.Builder
+	for _, word := range words {
+		for _, part := range strings.FieldsFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if b.Len() == 0 {
+				b.WriteString(strings.ToLower(part[:1]) + part[1:])
+			} else {
+				b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+			}
+		}
+	}
+	return b.String()
+}
+
+// pathExpression is the template expression reading a config path, falling
+// back to index for keys that are not identifiers such as 'app.kubernetes.io/name'
+func pathExpression(path []string) string {
+	if !slices.ContainsFunc(path, func(segment string) bool { return !identifierRegex.MatchString(segment) }) {
+		return fmt.Sprintf("{{ .%s }}", strings.Join(path, "."))
+	}
+
+	args := make([]string, 0, len(path)-1)
+	for _, segment := range path[1:] {
+		args = append(args, fmt.Sprintf("%q", segment))
+	}
+	return fmt.Sprintf("{{ index .%s %s }}", path[0], strings.Join(args, " "))
+}
+
+func setConfigValue(values map[string]any, path []string, value any) {
+	for _, segment := range path[:len(path)-1] {
+		next, ok := values[segment].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			values[segment] = next
+		}
+		values = next
+	}
+	values[path[len(path)-1]] = value
+}
+
+// isPlainString reports whether a node is a string that reads back as a
+// string when written unquoted, which is how template expressions render it
+func isPlainString(node *yaml.Node) bool {
+	if node == nil || node.Kind != yaml.ScalarNode || node.Tag != "!!str" || node.Value == "" {
+		return false
+	}
+
+	var decoded any
+	if err := yaml.Unmarshal([]byte(node.Value), &decoded); err != nil {
+		return false
+	}
+	_, ok := decoded.(string)
+	return ok
+}
+
+// encodeTemplate writes an object as a template: literal '{{' is escaped so
+// the object renders back to itself, then sentinels become their expressions
+func encodeTemplate(doc *yaml.Node, expressions map[string]string) ([]byte, error) {
+	out, err := encodeNodes([]*yaml.Node{doc})
+	if err != nil {
+		return nil, err
+	}
+
+	out = bytes.ReplaceAll(out, []byte("{{"), []byte(`{{ "{{" }}`))
+	for sentinel, expression := range expressions {
+		out = bytes.ReplaceAll(out, []byte(sentinel), []byte(expression))
+	}
+	return out, nil
+}
+
+// templateFileBase names the template of an object after its kind and name
+func templateFileBase(kind, name string) string {
+	base := strings.ToLower(kind + "-" + name)
+	return strings.Trim(fileNameRegex.ReplaceAllString(base, "-"), "-")
+}
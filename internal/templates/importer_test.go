@@ -0,0 +1,240 @@
+package templates
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const importManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: prod
+  labels:
+    app: api
+    app.kubernetes.io/part-of: shop
+  annotations:
+    note: "{{ literal }}"
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: api
+  template:
+    metadata:
+      labels:
+        app: api
+    spec:
+      containers:
+      - name: api
+        image: repo/api:1.2
+      - name: proxy
+        image: envoy:1.30
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+  namespace: prod
+  labels:
+    app: worker
+    app.kubernetes.io/part-of: shop
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: worker
+  template:
+    metadata:
+      labels:
+        app: worker
+    spec:
+      containers:
+      - name: worker
+        image: repo/worker:1.2
+      - name: proxy
+        image: envoy:1.30
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: api
+    namespace: prod
+  spec:
+    selector:
+      app: api
+    ports:
+    - port: 80
+`
+
+func TestImportManifestsSplitsObjects(t *testing.T) {
+	result, err := ImportManifests([]ImportSource{{Path: "app.yaml", Content: []byte(importManifests)}}, false)
+	if err != nil {
+		t.Fatalf("ImportManifests() error = %v", err)
+	}
+
+	var names []string
+	for _, tmpl := range result.Templates {
+		names = append(names, tmpl.FileName)
+	}
+	want := []string{"deployment-api.yaml", "deployment-worker.yaml", "service-api.yaml"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("templates = %v, want %v", names, want)
+	}
+	if len(result.Values) != 0 {
+		t.Errorf("values = %v, want none without extract", result.Values)
+	}
+}
+
+func TestImportManifestsExtract(t *testing.T) {
+	result, err := ImportManifests([]ImportSource{{Path: "app.yaml", Content: []byte(importManifests)}}, true)
+	if err != nil {
+		t.Fatalf("ImportManifests() error = %v", err)
+	}
+
+	wantValues := map[string]any{
+		"namespace":      "prod",
+		"apiReplicas":    3,
+		"workerReplicas": 2,
+		"apiImage":       "repo/api:1.2",
+		"workerImage":    "repo/worker:1.2",
+		"proxyImage":     "envoy:1.30",
+		"labels":         map[string]any{"app.kubernetes.io/part-of": "shop"},
+	}
+	if !reflect.DeepEqual(result.Values, wantValues) {
+		t.Errorf("values = %v, want %v", result.Values, wantValues)
+	}
+
+	api := string(result.Templates[0].Content)
+	for _, expression := range []string{
+		"namespace: {{ .namespace }}",
+		"replicas: {{ .apiReplicas }}",
+		"image: {{ .apiImage }}",
+		"image: {{ .proxyImage }}",
+		`app.kubernetes.io/part-of: {{ index .labels "app.kubernetes.io/part-of" }}`,
+		"app: api", // Differs between objects, left as is
+	} {
+		if !strings.Contains(api, expression) {
+			t.Errorf("expected %q in:\n%s", expression, api)
+		}
+	}
+
+	// Every template renders back to the object it was imported from
+	original, err := decodeNodes([]byte(importManifests))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []any{decodeAny(t, original[0]), decodeAny(t, original[1]), decodeAny(t, LookupPath(original[2], "items.0"))}
+
+	for i, tmpl := range result.Templates {
+		parsed, err := template.New(tmpl.FileName).Parse(string(tmpl.Content))
+		if err != nil {
+			t.Fatalf("%s is not a valid template: %v", tmpl.FileName, err)
+		}
+		var rendered bytes.Buffer
+		if err := parsed.Execute(&rendered, result.Values); err != nil {
+			t.Fatalf("could not render %s: %v", tmpl.FileName, err)
+		}
+
+		var got any
+		if err := yaml.Unmarshal(rendered.Bytes(), &got); err != nil {
+			t.Fatalf("rendered %s is not valid YAML: %v", tmpl.FileName, err)
+		}
+		if !reflect.DeepEqual(got, expected[i]) {
+			t.Errorf("%s renders to\n%v\nwant\n%v", tmpl.FileName, got, expected[i])
+		}
+	}
+}
+
+func TestImportManifestsSharedValues(t *testing.T) {
+	content := `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  schedule: "0 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: report
+            image: repo/tools:2
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  schedule: "0 0 * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: cleanup
+            image: repo/tools:2
+`
+	result, err := ImportManifests([]ImportSource{{Path: "jobs.yaml", Content: []byte(content)}}, true)
+	if err != nil {
+		t.Fatalf("ImportManifests() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(result.Values, map[string]any{"image": "repo/tools:2"}) {
+		t.Errorf("values = %v", result.Values)
+	}
+	if result.Templates[1].FileName != "cronjob-report-2.yaml" {
+		t.Errorf("second template named %s, want cronjob-report-2.yaml", result.Templates[1].FileName)
+	}
+}
+
+func TestImportManifestsRejectsNonObjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"scalar", "just a string\n"},
+		{"missing name", "kind: ConfigMap\nmetadata: {}\n"},
+		{"invalid yaml", "kind: [\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ImportManifests([]ImportSource{{Path: "bad.yaml", Content: []byte(tt.content)}}, false); err == nil {
+				t.Error("ImportManifests() expected error")
+			}
+		})
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	tests := map[string][]string{
+		"image":          {"image"},
+		"apiServerImage": {"api-server", "image"},
+		"myAppReplicas":  {"my_app", "replicas"},
+		"image2":         {"", "image2"},
+	}
+	for want, words := range tests {
+		if got := camelCase(words...); got != want {
+			t.Errorf("camelCase(%q) = %q, want %q", words, got, want)
+		}
+	}
+}
+
+func decodeAny(t *testing.T, node *yaml.Node) any {
+	t.Helper()
+
+	var value any
+	if err := node.Decode(&value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
@@ -0,0 +1,88 @@
+package templates
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Preset is a named bundle of components that add scaffolds together
+type Preset struct {
+	Name        string
+	Source      string
+	Description string
+	Components  []string
+}
+
+// builtinPresets are the bundles available in every project
+var builtinPresets = []Preset{
+	{
+		Name:        "web-service",
+		Description: "HTTP service exposed through the Gateway API",
+		Components:  []string{string(deployment), string(service), string(httpRoute), string(hpa), string(pdb)},
+	},
+	{
+		Name:        "worker",
+		Description: "Background worker without inbound traffic",
+		Components:  []string{string(deployment), string(configmap), string(hpa), string(pdb)},
+	},
+	{
+		Name:        "cron-task",
+		Description: "Scheduled task with its configuration and credentials",
+		Components:  []string{string(cronjob), string(configmap), string(secret)},
+	},
+}
+
+// LoadPresets returns the built-in presets plus the project-defined ones,
+// which take precedence over built-ins with the same name
+func LoadPresets(project map[string][]string) map[string]Preset {
+	presets := make(map[string]Preset, len(builtinPresets)+len(project))
+	for _, preset := range builtinPresets {
+		preset.Source = SourceBuiltin
+		presets[preset.Name] = preset
+	}
+
+	for name, components := range project {
+		name = strings.ToLower(name)
+		presets[name] = Preset{
+			Name:       name,
+			Source:     SourceProject,
+			Components: components,
+		}
+	}
+
+	return presets
+}
+
+// ExpandPresets resolves the named presets and appends the given components,
+// dropping duplicates while keeping the first occurrence of each
+func ExpandPresets(presets map[string]Preset, names []string, components []string) ([]string, error) {
+	var expanded []string
+	add := func(component string) {
+		component = strings.ToLower(component)
+		if !slices.Contains(expanded, component) {
+			expanded = append(expanded, component)
+		}
+	}
+
+	for _, name := range names {
+		preset, ok := presets[strings.ToLower(name)]
+		if !ok {
+			available := make([]string, 0, len(presets))
+			for presetName := range presets {
+				available = append(available, presetName)
+			}
+			slices.Sort(available)
+			return nil, fmt.Errorf("unknown preset '%s' (available: %s)", name, strings.Join(available, ", "))
+		}
+		for _, component := range preset.Components {
+			add(component)
+		}
+	}
+
+	for _, component := range components {
+		add(component)
+	}
+
+	return expanded, nil
+}
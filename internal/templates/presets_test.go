@@ -0,0 +1,66 @@
+package templates
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBuiltinPresetsUseBuiltinComponents(t *testing.T) {
+	for _, preset := range builtinPresets {
+		if preset.Description == "" {
+			t.Errorf("preset %s has no description", preset.Name)
+		}
+		for _, component := range preset.Components {
+			if !slices.Contains(AllowedComponents, component) {
+				t.Errorf("preset %s references unknown component %s", preset.Name, component)
+			}
+		}
+	}
+}
+
+func TestLoadPresetsProjectOverrides(t *testing.T) {
+	presets := LoadPresets(map[string][]string{
+		"Worker":       {"job"},
+		"grpc-service": {"deployment", "service"},
+	})
+
+	if preset := presets["worker"]; preset.Source != SourceProject || !slices.Equal(preset.Components, []string{"job"}) {
+		t.Errorf("worker = %+v, want the project definition", preset)
+	}
+	if preset := presets["grpc-service"]; preset.Source != SourceProject {
+		t.Errorf("grpc-service source = %q, want %q", preset.Source, SourceProject)
+	}
+	if preset := presets["web-service"]; preset.Source != SourceBuiltin {
+		t.Errorf("web-service source = %q, want %q", preset.Source, SourceBuiltin)
+	}
+}
+
+func TestExpandPresets(t *testing.T) {
+	presets := LoadPresets(nil)
+
+	tests := []struct {
+		name       string
+		presets    []string
+		components []string
+		want       []string
+		wantErr    bool
+	}{
+		{"single preset", []string{"web-service"}, nil, []string{"deployment", "service", "httproute", "hpa", "pdb"}, false},
+		{"preset plus components", []string{"cron-task"}, []string{"ServiceAccount", "secret"}, []string{"cronjob", "configmap", "secret", "serviceaccount"}, false},
+		{"overlapping presets", []string{"web-service", "worker"}, nil, []string{"deployment", "service", "httproute", "hpa", "pdb", "configmap"}, false},
+		{"no presets", nil, []string{"service"}, []string{"service"}, false},
+		{"unknown preset", []string{"nope"}, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandPresets(presets, tt.presets, tt.components)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandPresets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ExpandPresets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package templates
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// sampleConfig is the repo config scaffolded components are rendered with
+var sampleConfig = map[string]any{
+	ParamName:  "api",
+	ParamImage: "registry.example.com/api:1.4.0",
+	ParamPort:  8080,
+}
+
+// customResourceFields are the kinds of built-in components whose types are
+// not part of client-go. They are not validated against their CRD schemas,
+// only the fields their CRDs require are checked: every list path must be a
+// non-empty list whose items have the listed fields, set to non-empty values.
+var customResourceFields = map[string]map[string][]string{
+	"Gateway": {
+		"spec":           {"gatewayClassName", "listeners"},
+		"spec.listeners": {"name", "protocol", "port"},
+	},
+	"HTTPRoute": {
+		"spec":                     {"parentRefs", "rules"},
+		"spec.parentRefs":          {"name"},
+		"spec.rules":               {"backendRefs"},
+		"spec.rules.0.backendRefs": {"name", "port"},
+	},
+	"HealthCheckPolicy": {
+		"spec":           {"default", "targetRef"},
+		"spec.targetRef": {"kind", "name"},
+	},
+}
+
+// strictDecoder rejects unknown and duplicated fields
+var strictDecoder = serializer.NewCodecFactory(scheme.Scheme, serializer.EnableStrict).UniversalDeserializer()
+
+func TestRegistryComponentsAreValidObjects(t *testing.T) {
+	for _, name := range AllowedComponents {
+		t.Run(name, func(t *testing.T) {
+			validateObjects(t, renderSample(t, name, TemplateRegistry[name]))
+		})
+	}
+}
+
+func TestScaffoldedComponentsAreValidObjects(t *testing.T) {
+	params := []string{ParamName, ParamImage, ParamPort}
+
+	for _, name := range AllowedComponents {
+		t.Run(name, func(t *testing.T) {
+			content := TemplateRegistry[name]
+			bindings := slices.Clone(ComponentParams[name])
+
+			if binding, ok := ServiceAccountBinding(name); ok {
+				linked, err := LinkServiceAccount(name, content)
+				if err != nil {
+					t.Fatalf("LinkServiceAccount() error = %v", err)
+				}
+				content = linked
+				bindings = append(bindings, binding)
+			}
+
+			scaffolded, err := Scaffold(content, bindings, params)
+			if err != nil {
+				t.Fatalf("Scaffold() error = %v", err)
+			}
+
+			rendered := renderSample(t, name, scaffolded)
+			validateObjects(t, rendered)
+
+			if _, ok := ComponentParams[name]; ok && !strings.Contains(string(rendered), sampleConfig[ParamName].(string)) {
+				t.Errorf("rendered %s does not use the name from the config:\n%s", name, rendered)
+			}
+		})
+	}
+}
+
+func TestComponentsDoNotClash(t *testing.T) {
+	params := []string{ParamName, ParamImage, ParamPort}
+
+	// Adding every component to one namespace must not create an object twice
+	owners := make(map[string]string)
+	for _, name := range AllowedComponents {
+		content := TemplateRegistry[name]
+		if bindings, ok := ComponentParams[name]; ok {
+			scaffolded, err := Scaffold(content, bindings, params)
+			if err != nil {
+				t.Fatalf("Scaffold(%s) error = %v", name, err)
+			}
+			content = scaffolded
+		}
+
+		docs, err := decodeNodes(renderSample(t, name, content))
+		if err != nil {
+			t.Fatalf("rendered %s is not valid YAML: %v", name, err)
+		}
+		for _, doc := range docs {
+			key := DocumentKind(doc) + "/" + LookupPath(doc, "metadata.name").Value
+			if owner, ok := owners[key]; ok {
+				t.Errorf("%s is created by both the %s and %s components", key, owner, name)
+			}
+			owners[key] = name
+		}
+	}
+}
+
+// renderSample executes a component as generate would, with the sample config
+func renderSample(t *testing.T, name string, content []byte) []byte {
+	t.Helper()
+
+	tmpl, err := template.New(name).Funcs(ManiplacerFuncs).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		t.Fatalf("%s is not a valid template: %v", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, sampleConfig); err != nil {
+		t.Fatalf("could not render %s: %v", name, err)
+	}
+	return buf.Bytes()
+}
+
+// validateObjects checks that every document of a rendered component is an
+// object the API server would accept
+func validateObjects(t *testing.T, content []byte) {
+	t.Helper()
+
+	docs, err := decodeNodes(content)
+	if err != nil {
+		t.Fatalf("not valid YAML: %v\n%s", err, content)
+	}
+	if len(docs) == 0 {
+		t.Fatal("no documents")
+	}
+
+	for _, doc := range docs {
+		data, err := encodeNodes([]*yaml.Node{doc})
+		if err != nil {
+			t.Fatalf("could not encode document: %v", err)
+		}
+
+		obj, gvk, err := strictDecoder.Decode(data, nil, nil)
+		if kind := DocumentKind(doc); runtime.IsNotRegisteredError(err) && customResourceFields[kind] != nil {
+			validateName(t, kind, LookupPath(doc, "metadata.name"))
+			validateRequiredFields(t, kind, doc)
+			continue
+		}
+		if err != nil {
+			t.Errorf("invalid %s: %v\n%s", DocumentKind(doc), err, data)
+			continue
+		}
+
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			t.Errorf("%s has no object metadata: %v", gvk.Kind, err)
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(accessor.GetName()); len(errs) > 0 {
+			t.Errorf("%s name %q is invalid: %s", gvk.Kind, accessor.GetName(), strings.Join(errs, ", "))
+		}
+
+		validateWorkload(t, obj)
+		validateAutoscaler(t, obj)
+	}
+}
+
+func validateName(t *testing.T, kind string, node *yaml.Node) {
+	t.Helper()
+
+	if node == nil {
+		t.Errorf("%s has no metadata.name", kind)
+		return
+	}
+	if errs := validation.IsDNS1123Subdomain(node.Value); len(errs) > 0 {
+		t.Errorf("%s name %q is invalid: %s", kind, node.Value, strings.Join(errs, ", "))
+	}
+}
+
+// validateRequiredFields checks the fields customResourceFields requires for a kind
+func validateRequiredFields(t *testing.T, kind string, doc *yaml.Node) {
+	t.Helper()
+
+	for _, path := range slices.Sorted(maps.Keys(customResourceFields[kind])) {
+		node := LookupPath(doc, path)
+		if node == nil {
+			t.Errorf("%s has no %s", kind, path)
+			continue
+		}
+
+		items := []*yaml.Node{node}
+		if node.Kind == yaml.SequenceNode {
+			if len(node.Content) == 0 {
+				t.Errorf("%s %s is empty", kind, path)
+			}
+			items = node.Content
+		}
+
+		for i, item := range items {
+			for _, field := range customResourceFields[kind][path] {
+				value := LookupPath(item, field)
+				if value == nil || (value.Kind == yaml.ScalarNode && value.Value == "") || (value.Kind != yaml.ScalarNode && len(value.Content) == 0) {
+					t.Errorf("%s %s[%d] has no %s", kind, path, i, field)
+				}
+				if field == "port" && value != nil {
+					if port, err := strconv.Atoi(value.Value); err != nil || port < 1 || port > 65535 {
+						t.Errorf("%s %s[%d] port %q is not a valid port", kind, path, i, value.Value)
+					}
+				}
+			}
+		}
+	}
+}
+
+// validateWorkload checks that a workload selects its own pods and runs
+// containers with a name and an image
+func validateWorkload(t *testing.T, obj runtime.Object) {
+	t.Helper()
+
+	var selector *metav1.LabelSelector
+	var pod corev1.PodTemplateSpec
+
+	switch workload := obj.(type) {
+	case *appsv1.Deployment:
+		selector, pod = workload.Spec.Selector, workload.Spec.Template
+	case *appsv1.StatefulSet:
+		selector, pod = workload.Spec.Selector, workload.Spec.Template
+	case *appsv1.DaemonSet:
+		selector, pod = workload.Spec.Selector, workload.Spec.Template
+	case *batchv1.Job:
+		pod = workload.Spec.Template
+	case *batchv1.CronJob:
+		pod = workload.Spec.JobTemplate.Spec.Template
+	default:
+		return
+	}
+
+	if selector != nil {
+		s, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			t.Errorf("invalid selector: %v", err)
+		} else if s.Empty() || !s.Matches(labels.Set(pod.Labels)) {
+			t.Errorf("selector %v does not match pod labels %v", selector.MatchLabels, pod.Labels)
+		}
+	}
+
+	if len(pod.Spec.Containers) == 0 {
+		t.Error("pod template has no containers")
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == "" || container.Image == "" {
+			t.Errorf("container %q must have a name and an image (image %q)", container.Name, container.Image)
+		}
+	}
+}
+
+// validateAutoscaler checks that resource metrics name a resource the metrics server reports
+func validateAutoscaler(t *testing.T, obj runtime.Object) {
+	t.Helper()
+
+	hpa, ok := obj.(*autoscalingv2.HorizontalPodAutoscaler)
+	if !ok {
+		return
+	}
+
+	for _, metric := range hpa.Spec.Metrics {
+		if metric.Resource == nil {
+			continue
+		}
+		if name := metric.Resource.Name; name != corev1.ResourceCPU && name != corev1.ResourceMemory {
+			t.Errorf("unknown resource metric %q", name)
+		}
+	}
+}
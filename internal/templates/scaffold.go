@@ -0,0 +1,342 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scaffold parameters understood by add. Each one becomes a top-level key of
+// the repo config and a '{{ .<param> }}' expression in the scaffolded template.
+const (
+	ParamName  = "name"
+	ParamImage = "image"
+	ParamPort  = "port"
+)
+
+// DefaultComponentName is the name built-in components use for themselves and
+// for the components they refer to, until scaffolded with the name parameter
+const DefaultComponentName = "app"
+
+// ParamBinding ties a scaffold parameter to a field of a component
+type ParamBinding struct {
+	Param  string
+	Kind   string // Kind of the document the field belongs to, empty for any
+	Path   string // Dot separated field path, numbers index into lists
+	Suffix string // Appended to the parameter, for names derived from it
+}
+
+// workloadBindings returns the bindings of a workload whose pod template lives
+// at podSpec, selector and port tell whether it has a label selector and serves traffic
+func workloadBindings(kind, podSpec string, selector, port bool) []ParamBinding {
+	bindings := []ParamBinding{
+		{Param: ParamName, Kind: kind, Path: "metadata.name"},
+		{Param: ParamName, Kind: kind, Path: "metadata.labels.app"},
+	}
+	if selector {
+		bindings = append(bindings, ParamBinding{Param: ParamName, Kind: kind, Path: "spec.selector.matchLabels.app"})
+	}
+	bindings = append(bindings,
+		ParamBinding{Param: ParamName, Kind: kind, Path: podSpec + ".metadata.labels.app"},
+		ParamBinding{Param: ParamName, Kind: kind, Path: podSpec + ".spec.containers.0.name"},
+		ParamBinding{Param: ParamImage, Kind: kind, Path: podSpec + ".spec.containers.0.image"},
+	)
+	if port {
+		bindings = append(bindings, ParamBinding{Param: ParamPort, Kind: kind, Path: podSpec + ".spec.containers.0.ports.0.containerPort"})
+	}
+	return bindings
+}
+
+// headlessSuffix names the headless Service of the statefulset component after it
+const headlessSuffix = "-headless"
+
+// ComponentParams lists which fields of each built-in component are filled by scaffold parameters
+var ComponentParams = map[string][]ParamBinding{
+	string(deployment): workloadBindings("Deployment", "spec.template", true, true),
+	string(service): {
+		{Param: ParamName, Path: "metadata.name"},
+		{Param: ParamName, Path: "metadata.labels.app"},
+		{Param: ParamName, Path: "spec.selector.app"},
+		{Param: ParamPort, Path: "spec.ports.0.port"},
+		{Param: ParamPort, Path: "spec.ports.0.targetPort"},
+	},
+	string(httpRoute): {
+		{Param: ParamName, Path: "metadata.name"},
+		{Param: ParamName, Path: "spec.parentRefs.0.name"},
+		{Param: ParamName, Path: "spec.rules.0.backendRefs.0.name"},
+		{Param: ParamPort, Path: "spec.rules.0.backendRefs.0.port"},
+	},
+	string(secret): {
+		{Param: ParamName, Path: "metadata.name"},
+	},
+	string(configmap): {
+		{Param: ParamName, Path: "metadata.name"},
+	},
+	string(hpa): {
+		{Param: ParamName, Path: "metadata.name"},
+		{Param: ParamName, Path: "spec.scaleTargetRef.name"},
+	},
+	string(hcpolicy): {
+		{Param: ParamName, Path: "metadata.name"},
+		{Param: ParamName, Path: "spec.targetRef.name"},
+	},
+	string(statefulset): append(workloadBindings("StatefulSet", "spec.template", true, true),
+		// The headless Service must not clash with the service component
+		ParamBinding{Param: ParamName, Kind: "StatefulSet", Path: "spec.serviceName", Suffix: headlessSuffix},
+		ParamBinding{Param: ParamName, Kind: "Service", Path: "metadata.name", Suffix: headlessSuffix},
+		ParamBinding{Param: ParamName, Kind: "Service", Path: "metadata.labels.app"},
+		ParamBinding{Param: ParamName, Kind: "Service", Path: "spec.selector.app"},
+		ParamBinding{Param: ParamPort, Kind: "Service", Path: "spec.ports.0.port"},
+	),
+	string(daemonset): workloadBindings("DaemonSet", "spec.template", true, false),
+	string(job):       workloadBindings("Job", "spec.template", false, false),
+	string(cronjob):   workloadBindings("CronJob", "spec.jobTemplate.spec.template", false, false),
+	string(ingress): {
+		{Param: ParamName, Path: "metadata.name"},
+		{Param: ParamName, Path: "spec.rules.0.http.paths.0.backend.service.name"},
+		{Param: ParamPort, Path: "spec.rules.0.http.paths.0.backend.service.port.number"},
+	},
+	// Only the allow policy selects the app, the default deny policy applies to the whole namespace
+	string(networkpolicy): {
+		{Param: ParamName, Path: "spec.podSelector.matchLabels.app"},
+		{Param: ParamPort, Path: "spec.ingress.0.ports.0.port"},
+	},
+	string(pdb): {
+		{Param: ParamName, Path: "metadata.name"},
+		{Param: ParamName, Path: "spec.selector.matchLabels.app"},
+	},
+	string(gateway): {
+		{Param: ParamName, Path: "metadata.name"},
+	},
+	string(serviceaccount): {
+		{Param: ParamName, Path: "metadata.name"},
+	},
+	string(role):        rbacBindings,
+	string(clusterrole): rbacBindings,
+	string(pvc): {
+		{Param: ParamName, Path: "metadata.name"},
+	},
+}
+
+// rbacBindings name a role, its binding and the ServiceAccount it is bound to
+// after the app, matching the ServiceAccount component
+var rbacBindings = []ParamBinding{
+	{Param: ParamName, Path: "metadata.name"},
+	{Param: ParamName, Path: "roleRef.name"},
+	{Param: ParamName, Path: "subjects.0.name"},
+}
+
+// WorkloadPodSpecs holds the path to the pod spec of every built-in workload component
+var WorkloadPodSpecs = map[string]string{
+	string(deployment):  "spec.template.spec",
+	string(statefulset): "spec.template.spec",
+	string(daemonset):   "spec.template.spec",
+	string(job):         "spec.template.spec",
+	string(cronjob):     "spec.jobTemplate.spec.template.spec",
+}
+
+// ServiceAccountComponent is the component workloads are linked to by LinkServiceAccount
+const ServiceAccountComponent = string(serviceaccount)
+
+// LinkServiceAccount makes the pods of a built-in workload component run as
+// the ServiceAccount component, using the default name like the
+// ServiceAccount itself. Scaffold fills it from the name parameter through
+// ServiceAccountBinding. Components that are not workloads are returned as they are.
+func LinkServiceAccount(name string, content []byte) ([]byte, error) {
+	podSpec, ok := WorkloadPodSpecs[name]
+	if !ok {
+		return content, nil
+	}
+
+	docs, err := decodeNodes(content)
+	if err != nil {
+		return nil, err
+	}
+
+	linked := false
+	for _, doc := range docs {
+		spec := LookupPath(doc, podSpec)
+		if spec == nil || spec.Kind != yaml.MappingNode {
+			continue
+		}
+
+		if LookupPath(spec, "serviceAccountName") == nil {
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "serviceAccountName"}
+			value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: DefaultComponentName}
+			spec.Content = append([]*yaml.Node{key, value}, spec.Content...)
+		}
+		linked = true
+	}
+
+	if !linked {
+		return nil, fmt.Errorf("pod spec '%s' not found in component", podSpec)
+	}
+	return encodeNodes(docs)
+}
+
+// ServiceAccountBinding returns the binding of the serviceAccountName set by
+// LinkServiceAccount, it reports false for components that are not workloads
+func ServiceAccountBinding(name string) (ParamBinding, bool) {
+	podSpec, ok := WorkloadPodSpecs[name]
+	if !ok {
+		return ParamBinding{}, false
+	}
+	return ParamBinding{Param: ParamName, Path: podSpec + ".serviceAccountName"}, true
+}
+
+// paramSentinel is written in place of a parameter while the YAML is encoded,
+// since the encoder would quote a template expression
+func paramSentinel(param string) string {
+	return "MANIPLACER_PARAM_" + strings.ToUpper(param)
+}
+
+// ParamExpression is the template expression that reads a parameter from the repo config
+func ParamExpression(param string) string {
+	return fmt.Sprintf("{{ .%s }}", param)
+}
+
+// Scaffold replaces every field bound to one of params with the template
+// expression reading that parameter from the repo config. Documents without
+// a bound field are left alone, but every binding must match at least one document.
+func Scaffold(content []byte, bindings []ParamBinding, params []string) ([]byte, error) {
+	docs, err := decodeNodes(content)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, binding := range bindings {
+		if !slices.Contains(params, binding.Param) {
+			continue
+		}
+
+		found := false
+		for _, doc := range docs {
+			if binding.Kind != "" && binding.Kind != DocumentKind(doc) {
+				continue
+			}
+
+			node := LookupPath(doc, binding.Path)
+			if node == nil || node.Kind != yaml.ScalarNode {
+				continue
+			}
+			setPlainScalar(node, paramSentinel(binding.Param)+binding.Suffix)
+			found = true
+		}
+
+		if !found {
+			return nil, fmt.Errorf("field '%s' not found in component", binding.Path)
+		}
+	}
+
+	return encodeWithParams(docs, params)
+}
+
+// encodeWithParams encodes documents and swaps the sentinels of params for
+// their template expressions
+func encodeWithParams(docs []*yaml.Node, params []string) ([]byte, error) {
+	out, err := encodeNodes(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, param := range params {
+		out = bytes.ReplaceAll(out, []byte(paramSentinel(param)), []byte(ParamExpression(param)))
+	}
+	return out, nil
+}
+
+// decodeNodes parses every YAML document in content
+func decodeNodes(content []byte) ([]*yaml.Node, error) {
+	var docs []*yaml.Node
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse component: %w", err)
+		}
+		docs = append(docs, &doc)
+	}
+
+	return docs, nil
+}
+
+// encodeNodes writes documents back as a '---' separated YAML stream
+func encodeNodes(docs []*yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			return nil, fmt.Errorf("could not encode component: %w", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("could not encode component: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func setPlainScalar(node *yaml.Node, value string) {
+	node.Kind = yaml.ScalarNode
+	node.Tag = "!!str"
+	node.Style = 0
+	node.Value = value
+}
+
+// DocumentKind returns the kind of a parsed YAML document
+func DocumentKind(doc *yaml.Node) string {
+	if node := LookupPath(doc, "kind"); node != nil {
+		return node.Value
+	}
+	return ""
+}
+
+// LookupPath finds the node at a dot separated path inside a parsed YAML
+// document, numeric segments index into lists. It returns nil if any segment
+// is missing.
+func LookupPath(doc *yaml.Node, path string) *yaml.Node {
+	node := doc
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, segment := range strings.Split(path, ".") {
+		switch node.Kind {
+		case yaml.MappingNode:
+			var next *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == segment {
+					next = node.Content[i+1]
+					break
+				}
+			}
+			if next == nil {
+				return nil
+			}
+			node = next
+		case yaml.SequenceNode:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[index]
+		default:
+			return nil
+		}
+	}
+
+	return node
+}
@@ -0,0 +1,119 @@
+package templates
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestScaffoldBuiltinComponents(t *testing.T) {
+	params := []string{ParamName, ParamImage, ParamPort}
+	values := map[string]any{
+		ParamName:  "api",
+		ParamImage: "registry.example.com/api:1.4.0",
+		ParamPort:  8080,
+	}
+	want := map[string]string{
+		ParamName:  "api",
+		ParamImage: "registry.example.com/api:1.4.0",
+		ParamPort:  "8080",
+	}
+
+	for name, bindings := range ComponentParams {
+		t.Run(name, func(t *testing.T) {
+			scaffolded, err := Scaffold(TemplateRegistry[name], bindings, params)
+			if err != nil {
+				t.Fatalf("Scaffold() error = %v", err)
+			}
+
+			tmpl, err := template.New(name).Parse(string(scaffolded))
+			if err != nil {
+				t.Fatalf("scaffolded %s is not a valid template: %v\n%s", name, err, scaffolded)
+			}
+			var rendered bytes.Buffer
+			if err := tmpl.Execute(&rendered, values); err != nil {
+				t.Fatalf("could not render scaffolded %s: %v", name, err)
+			}
+
+			docs, err := decodeNodes(rendered.Bytes())
+			if err != nil {
+				t.Fatalf("rendered %s is not valid YAML: %v\n%s", name, err, rendered.String())
+			}
+
+			for _, binding := range bindings {
+				found := false
+				for _, doc := range docs {
+					if binding.Kind != "" && binding.Kind != DocumentKind(doc) {
+						continue
+					}
+					node := LookupPath(doc, binding.Path)
+					if node == nil {
+						continue
+					}
+					found = true
+					if node.Value != want[binding.Param]+binding.Suffix {
+						t.Errorf("%s = %q, want %q", binding.Path, node.Value, want[binding.Param]+binding.Suffix)
+					}
+					if binding.Param == ParamPort && node.Tag != "!!int" {
+						t.Errorf("%s rendered as %s, want an unquoted integer", binding.Path, node.Tag)
+					}
+				}
+				if !found {
+					t.Errorf("field %s not found in rendered %s", binding.Path, name)
+				}
+			}
+		})
+	}
+}
+
+func TestScaffoldOnlyGivenParams(t *testing.T) {
+	scaffolded, err := Scaffold(TemplateRegistry[string(deployment)], ComponentParams[string(deployment)], []string{ParamImage})
+	if err != nil {
+		t.Fatalf("Scaffold() error = %v", err)
+	}
+
+	content := string(scaffolded)
+	if !strings.Contains(content, "image: {{ .image }}") {
+		t.Errorf("image expression missing from:\n%s", content)
+	}
+	if strings.Contains(content, ParamExpression(ParamName)) || strings.Contains(content, ParamExpression(ParamPort)) {
+		t.Errorf("parameters that were not given were scaffolded:\n%s", content)
+	}
+}
+
+func TestScaffoldMissingField(t *testing.T) {
+	bindings := []ParamBinding{{Param: ParamName, Path: "spec.missing"}}
+	if _, err := Scaffold([]byte("kind: Service\nspec: {}\n"), bindings, []string{ParamName}); err == nil {
+		t.Error("Scaffold() expected error for a missing field")
+	}
+}
+
+func TestLinkServiceAccount(t *testing.T) {
+	for name := range WorkloadPodSpecs {
+		t.Run(name, func(t *testing.T) {
+			linked, err := LinkServiceAccount(name, TemplateRegistry[name])
+			if err != nil {
+				t.Fatalf("LinkServiceAccount() error = %v", err)
+			}
+
+			binding, ok := ServiceAccountBinding(name)
+			if !ok {
+				t.Fatalf("ServiceAccountBinding(%q) not found", name)
+			}
+			scaffolded, err := Scaffold(linked, append(ComponentParams[name], binding), []string{ParamName})
+			if err != nil {
+				t.Fatalf("Scaffold() error = %v", err)
+			}
+			if !strings.Contains(string(scaffolded), "serviceAccountName: {{ .name }}") {
+				t.Errorf("serviceAccountName not linked in:\n%s", scaffolded)
+			}
+		})
+	}
+
+	content := TemplateRegistry[string(service)]
+	linked, err := LinkServiceAccount(string(service), content)
+	if err != nil || !bytes.Equal(linked, content) {
+		t.Errorf("LinkServiceAccount() changed a component that is not a workload")
+	}
+}
@@ -52,3 +52,87 @@ var hcPolicyTemplate []byte
 func (t Template) HCPolicy() []byte {
 	return hcPolicyTemplate
 }
+
+//go:embed files/statefulset.tmpl
+var statefulSetTemplate []byte
+
+func (t Template) StatefulSet() []byte {
+	return statefulSetTemplate
+}
+
+//go:embed files/daemonset.tmpl
+var daemonSetTemplate []byte
+
+func (t Template) DaemonSet() []byte {
+	return daemonSetTemplate
+}
+
+//go:embed files/job.tmpl
+var jobTemplate []byte
+
+func (t Template) Job() []byte {
+	return jobTemplate
+}
+
+//go:embed files/cronjob.tmpl
+var cronJobTemplate []byte
+
+func (t Template) CronJob() []byte {
+	return cronJobTemplate
+}
+
+//go:embed files/ingress.tmpl
+var ingressTemplate []byte
+
+func (t Template) Ingress() []byte {
+	return ingressTemplate
+}
+
+//go:embed files/networkpolicy.tmpl
+var networkPolicyTemplate []byte
+
+func (t Template) NetworkPolicy() []byte {
+	return networkPolicyTemplate
+}
+
+//go:embed files/pdb.tmpl
+var pdbTemplate []byte
+
+func (t Template) PDB() []byte {
+	return pdbTemplate
+}
+
+//go:embed files/gateway.tmpl
+var gatewayTemplate []byte
+
+func (t Template) Gateway() []byte {
+	return gatewayTemplate
+}
+
+//go:embed files/serviceaccount.tmpl
+var serviceAccountTemplate []byte
+
+func (t Template) ServiceAccount() []byte {
+	return serviceAccountTemplate
+}
+
+//go:embed files/role.tmpl
+var roleTemplate []byte
+
+func (t Template) Role() []byte {
+	return roleTemplate
+}
+
+//go:embed files/clusterrole.tmpl
+var clusterRoleTemplate []byte
+
+func (t Template) ClusterRole() []byte {
+	return clusterRoleTemplate
+}
+
+//go:embed files/pvc.tmpl
+var pvcTemplate []byte
+
+func (t Template) PVC() []byte {
+	return pvcTemplate
+}
@@ -162,6 +162,18 @@ func TestAllowedComponents(t *testing.T) {
 		"configmap",
 		"hpa",
 		"hcpolicy",
+		"statefulset",
+		"daemonset",
+		"job",
+		"cronjob",
+		"ingress",
+		"networkpolicy",
+		"pdb",
+		"gateway",
+		"serviceaccount",
+		"role",
+		"clusterrole",
+		"pvc",
 	}
 
 	if len(AllowedComponents) != len(expectedComponents) {
@@ -12,6 +12,7 @@ const (
 	DefaultPort      = "8000"
 	ConfigFileName   = "config"
 	ManiplacerMarker = ".maniplacer"
+	ComponentsDir    = "components"
 )
 
 // Supported config formats
@@ -81,6 +82,21 @@ func ValidateProjectName(name string) error {
 	return nil
 }
 
+// ValidateResourceName validates the name given to scaffolded resources, which
+// is also used as their app label and container name
+func ValidateResourceName(name string) error {
+	if name == "" {
+		return fmt.Errorf("resource name cannot be empty")
+	}
+	if len(name) > 63 {
+		return fmt.Errorf("resource name must be 63 characters or less")
+	}
+	if !dns1123LabelRegex.MatchString(name) {
+		return fmt.Errorf("resource name must consist of lowercase alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name', '123-abc')")
+	}
+	return nil
+}
+
 // SanitizeName sanitizes a name to be K8s-compliant
 func SanitizeName(name string) string {
 	// Convert to lowercase
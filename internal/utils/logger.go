@@ -9,7 +9,7 @@ import (
 var Log *slog.Logger
 
 func init() {
-	Log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	Log = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 		Level: getLogLevel(),
 	}))
 }
@@ -10,9 +10,10 @@ import (
 )
 
 type ManiplacerProject struct {
-	Version     string `json:"version"`
-	Author      string `json:"author"`
-	Description string `json:"description"`
+	Version     string              `json:"version"`
+	Author      string              `json:"author"`
+	Description string              `json:"description"`
+	Presets     map[string][]string `json:"presets,omitempty"` // Project-defined component bundles for add --preset
 }
 
 func CreateManiplacerProject(path string) error {
@@ -43,6 +44,21 @@ func IsValidProject() bool {
 	return true
 }
 
+// LoadManiplacerProject reads the project file of the current directory
+func LoadManiplacerProject() (ManiplacerProject, error) {
+	var cfg ManiplacerProject
+
+	data, err := os.ReadFile(ManiplacerMarker)
+	if err != nil {
+		return cfg, fmt.Errorf("could not read project file: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("could not parse project file: %w", err)
+	}
+
+	return cfg, nil
+}
+
 func ConfirmMessage(message string) bool {
 	fmt.Printf("%s [y/N]: ", message)
 	reader := bufio.NewReader(os.Stdin)
@@ -63,3 +79,18 @@ func CreateConfigFile(path string, filetype string) error {
 		return nil
 	}
 }
+
+// UserComponentsDir returns the user-level directory holding custom components,
+// MANIPLACER_COMPONENTS_DIR overrides the default under the user config dir
+func UserComponentsDir() (string, error) {
+	if dir := os.Getenv("MANIPLACER_COMPONENTS_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get user config dir: %w", err)
+	}
+
+	return filepath.Join(configDir, "maniplacer", ComponentsDir), nil
+}